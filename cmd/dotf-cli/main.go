@@ -6,6 +6,7 @@ import (
 	"github.com/mortenskoett/dotf-go/pkg/cli"
 	"github.com/mortenskoett/dotf-go/pkg/logging"
 	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
 )
 
 const logo = `    _       _     __             _  _
@@ -19,6 +20,7 @@ var programVersion = "" // Inserted by build process using -ldflags
 // Global dotf-cli flags
 var (
 	flagConfig = parsing.NewFlag("config", "Path to dotf configuration file")
+	flagDryRun = parsing.NewFlag(cli.FlagDryRun, "Show what would be done without changing anything")
 	flagHelp   = []*parsing.Flag{
 		parsing.NewFlag("help", "Display help"),
 		parsing.NewFlag("h", "Display help"),
@@ -33,6 +35,13 @@ func main() {
 		cli.NewRevertCommand(),
 		cli.NewSyncCommand(),
 		cli.NewSetupCommand(),
+		cli.NewStatusCommand(),
+		cli.NewBackupCommand(),
+		cli.NewDistroCommand(),
+		cli.NewIgnoreCommand(),
+		cli.NewDoctorCommand(),
+		cli.NewDiffCommand(),
+		cli.NewWatchCommand(),
 	}
 	run(os.Args, commands)
 }
@@ -52,7 +61,7 @@ func run(osargs []string, commands []cli.Command) {
 	}
 
 	// Create command env to manage command execution
-	executor := cli.NewCmdExecutor(commands)
+	executor := cli.NewCmdExecutor(commands, []*parsing.Flag{flagConfig, flagDryRun})
 
 	// Create command
 	cmd, err := executor.Load(cmdinput, config, flagHelp)
@@ -79,7 +88,44 @@ func run(osargs []string, commands []cli.Command) {
 		case *cli.ErrCmdArgument:
 			logging.Warn(err)
 		case *cli.ErrGit:
+			handleGitError(e)
+		case *cli.ErrCmdDoctorFailed:
 			logging.Error(err)
+		case *cli.ErrCmdPathsFailed:
+			logging.Error(err)
+		case *terminalio.ErrRollbackFailed:
+			logging.Error(err)
+		case *terminalio.ErrHookFailed:
+			logging.Error(err)
+			logging.Info("Fix the hook in 'hooksdir' or remove it. A failing pre hook leaves everything unchanged.")
+		case *terminalio.ErrHookTimeout:
+			logging.Error(err)
+			logging.Info("Raise 'hooktimeoutsecs' in the configuration if the hook needs more time.")
+		case *terminalio.ErrBackupNotFound:
+			logging.Error(err)
+			logging.Info("Use 'dotf backup list' to see the available backup generations.")
+		case *terminalio.ErrDistroNotFound:
+			logging.Error(err)
+			logging.Info("Use 'dotf distro list' to see the available distributions.")
+		case *terminalio.ErrInvalidDistroName:
+			logging.Error(err)
+		case *terminalio.ErrPathIgnored, *terminalio.ErrIgnoredPathsInside:
+			logging.Error(err)
+			logging.Info("Use 'dotf ignore' to see which paths the ignore files exclude.")
+		case *terminalio.ErrTemplate, *terminalio.ErrMalformedVarsFile:
+			logging.Error(err)
+			logging.Info("Fix the template or the variables and install it again.")
+		case *terminalio.ErrKeyNotFound, *terminalio.ErrInvalidKey, *terminalio.ErrSecretNotRegularFile:
+			logging.Error(err)
+		case *terminalio.ErrDecryptSecret:
+			logging.Error(err)
+			logging.Info("Copy the key used to encrypt the secret to the configured 'keyfile'.")
+		case *terminalio.ErrMalformedManifest:
+			logging.Error(err)
+			logging.Info("Fix the manifest in syncdir, e.g. by resolving a merge of it, and run the command again.")
+		case *terminalio.ErrFileNotManaged:
+			logging.Error(err)
+			logging.Info("Use 'dotf add' to let dotf manage it.")
 		default:
 			logging.Error("undefined command run error:", err)
 		}
@@ -113,3 +159,19 @@ func handleParsingError[T cli.CommandPrintable](err error, cmds []T) {
 		os.Exit(1)
 	}
 }
+
+// Reports an error from running git according to what went wrong
+func handleGitError(err *cli.ErrGit) {
+	switch err.Err.(type) {
+	case *terminalio.ErrUnresolvedConflicts:
+		logging.Error(err.Err)
+		logging.Info("Run 'dotf sync --resolve ours' or 'dotf sync --resolve theirs' to resolve them by keeping the local or the remote version.")
+	case *terminalio.ErrMergeConflict:
+		logging.Error(err.Err)
+		logging.Info("Nothing was changed. Run 'dotf sync --resolve ours' or 'dotf sync --resolve theirs' to keep the local or the remote version.")
+	case *terminalio.ErrMergeFail, *terminalio.ErrRebaseFail, *terminalio.ErrPlaintextSecret:
+		logging.Error(err.Err)
+	default:
+		logging.Error(err)
+	}
+}
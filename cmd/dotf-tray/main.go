@@ -4,7 +4,9 @@ Starts a running process as an icon in the systray.
 package main
 
 import (
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/getlantern/systray"
@@ -33,6 +35,11 @@ var (
 	lastUpdated      string                     = "N/A"
 	configuration    *parsing.DotfConfiguration = nil                              // Configuration currently loaded.
 	updateWorker     concurrency.IntervalWorker = *concurrency.NewIntervalWorker() // Worker handles background updates.
+	symlinkWatcher   *terminalio.SymlinkWatcher = nil                              // Watches symlinks to dotfiles. Nil if it failed to start.
+
+	// Serializes the handlers changing files, which are called from the event loop, the update
+	// worker and the symlink watcher.
+	handlerMutex sync.Mutex
 )
 
 // Components registered in order seen in the trayicon dropdown.
@@ -89,6 +96,9 @@ func handleParsingError(err error) {
 
 func onExit() {
 	logging.Info(programName, "shutting down")
+	if symlinkWatcher != nil {
+		symlinkWatcher.Close()
+	}
 }
 
 // Main event loop.
@@ -98,6 +108,8 @@ func onReady() {
 	mLastUpdated.Disable()
 	mError.Hide()
 
+	startSymlinkWatcher()
+
 	// Handle events.
 	for {
 		select {
@@ -138,25 +150,129 @@ func handleToggleUpdateEvent() {
 }
 
 func handleUpdateNowEvent() {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+
 	logging.Info("Updating now")
 	systray.SetIcon(getLoadingIcon())
 
-	err := terminalio.SyncLocalRemote(configuration.SyncDir)
+	// Copies of dotfiles are synced with userspace using the manifest
+	op, err := configuration.NewOperation(programName, false)
+	if err != nil {
+		showError(err.Error())
+		return
+	}
+	hooks := terminalio.NewHooks(configuration.HookOptions())
+
+	// Copies changed by a failed update are restored
+	if err := hooks.Run(op, terminalio.HookPre, "sync", nil); err != nil {
+		showError(op.Rollback(err).Error())
+		return
+	}
+
+	err = terminalio.SyncLocalRemote(op, configuration.SyncDir, configuration.SyncOptions())
+	if err != nil {
+		showError(op.Rollback(err).Error())
+		return
+	}
+
+	if err := hooks.Run(op, terminalio.HookPost, "sync", nil); err != nil {
+		showError(op.Rollback(err).Error())
+		return
+	}
+	op.Commit()
+
+	state, err := terminalio.GetRepositoryState(configuration.SyncDir, configuration.SyncOptions())
 	if err != nil {
 		showError(err.Error())
 		return
 	}
 
+	// Changes made while syncing are picked up by the next sync
+	if !state.InSync() {
+		logging.Warn("Dotfiles not in sync after update:", state)
+	}
+
 	lastUpdated = time.Now().Format(time.Stamp)
 
 	mLastUpdated.Hide()
 	mLastUpdated = nil
 
-	mLastUpdated = systray.AddMenuItem("Last Updated: "+lastUpdated, "Time the dotfiles were last updated.")
+	mLastUpdated = systray.AddMenuItem("Last Updated: "+lastUpdated+" ("+state.String()+")", "Time the dotfiles were last updated.")
 	mLastUpdated.Disable()
 
 	systray.SetIcon(getDefaultIcon())
 	logging.Info("Updating done")
+
+	// Dotfiles may have been added or removed by the update
+	refreshSymlinkWatcher()
+}
+
+// Starts watching the symlinks to dotfiles in userspace. Clobbered symlinks are shown as errors or
+// adopted into dotfiles if 'autoadopt' is set.
+func startSymlinkWatcher() {
+	watcher, err := terminalio.NewSymlinkWatcher()
+	if err != nil {
+		showError(err.Error())
+		return
+	}
+	symlinkWatcher = watcher
+	refreshSymlinkWatcher()
+
+	go func() {
+		for {
+			select {
+			case e := <-watcher.Events():
+				handleClobberEvent(e)
+			case err := <-watcher.Errors():
+				showError(err.Error())
+			}
+		}
+	}()
+}
+
+func refreshSymlinkWatcher() {
+	if symlinkWatcher == nil {
+		return
+	}
+
+	ignore, err := configuration.IgnoreMatcher()
+	if err != nil {
+		showError(err.Error())
+		return
+	}
+
+	count, err := symlinkWatcher.Watch(configuration.UserspaceDir, configuration.DotfilesLayers(), ignore)
+	if err != nil {
+		showError(err.Error())
+		return
+	}
+	logging.Info("Watching", count, "symlinks to dotfiles")
+}
+
+func handleClobberEvent(e *terminalio.ClobberEvent) {
+	msg := fmt.Sprintf("Symlink to dotfile %s: %s", e.Kind, e.UserspaceFile)
+	if e.Kind != terminalio.ClobberReplaced || !configuration.AutoAdopt {
+		showError(msg)
+		return
+	}
+
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+
+	logging.Warn(msg)
+	op, err := configuration.NewOperation(programName, false)
+	if err != nil {
+		showError(err.Error())
+		return
+	}
+	d := &terminalio.DotfileDiff{DotfilesFile: e.DotfilesFile, UserspaceFile: e.UserspaceFile}
+	if err := terminalio.AdoptDotfile(op, d); err != nil {
+		showError(op.Rollback(err).Error())
+		return
+	}
+	op.Commit()
+	logging.Info("Adopted", e.UserspaceFile, "into", e.DotfilesFile)
 }
 
 func showError(err string) {
@@ -3,8 +3,11 @@ module github.com/mortenskoett/dotf-go
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/getlantern/systray v1.2.1
 	github.com/google/go-cmp v0.5.9
+	golang.org/x/sys v0.13.0
 )
 
 require (
@@ -16,5 +19,4 @@ require (
 	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
-	golang.org/x/sys v0.0.0-20200515095857-1151b9dac4a9 // indirect
 )
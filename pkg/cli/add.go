@@ -11,16 +11,36 @@ type addCommand struct {
 
 func NewAddCommand() *addCommand {
 	name := "add"
-	overview := "Move file/dir from userspace to dotfiles."
-	usage := name + " <filepath> [--help]"
+	overview := "Move files/dirs from userspace to dotfiles."
+	usage := name + " <filepath>... [--encrypt | --copy] [--help]"
 	args := []arg{
-		{Name: "file/dir", Description: "Path to file or dir that should be replaced by symlink."},
+		{Name: "file/dir", Description: "Paths or glob patterns of files or dirs that should be replaced by symlinks.", Variadic: true},
+	}
+	flags := []*parsing.Flag{
+		parsing.NewFlag(FlagEncrypt, "Store the file encrypted and keep it in userspace."),
+		parsing.NewFlag(FlagCopy, "Install the file by copying it and keep it in userspace."),
 	}
-	flags := []*parsing.Flag{}
 	description := `
 	Will replace a file or directory in userspace with a symlink pointing to the dotfiles directory.
 	The file or the directory and its contents is copied to the dotfiles directory and a symlink is
-	placed in the original location.`
+	placed in the original location.
+
+	Several paths and glob patterns such as '~/.config/*.conf' can be given. Every path is added on
+	its own, so a path that fails does not stop the others, and a summary of the paths that
+	succeeded and failed is shown at the end.
+
+	Using --encrypt a file containing secrets is instead stored encrypted in the dotfiles directory
+	with the suffix '.dotfsecret' and the file in userspace is left as it is. The key is read from
+	'keyfile' and created if it does not exist. Keep the key out of the dotfiles directory and copy
+	it to every machine that should decrypt the secrets.
+
+	Using --copy the file or directory is copied to the dotfiles directory and the file in userspace
+	is left as it is. It is recorded with the install mode 'copy' in the manifest, so it is installed
+	by copying it and changes on either side are copied by 'sync'.
+
+	The added path is recorded in the manifest 'dotf.toml' in the sync directory together with its
+	permissions, the dotfiles directory it was added to and the time it was added. The first time a
+	path is recorded, everything already in the dotfiles directories is recorded as well.`
 
 	return &addCommand{
 		commandBase: &commandBase{
@@ -34,12 +54,27 @@ func NewAddCommand() *addCommand {
 	}
 }
 
-func (c *addCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration) error {
-	filepath := args.PositionalArgs[0]
-	err := terminalio.AddDotfile(filepath, conf.UserspaceDir, conf.DotfilesDir)
-	if err != nil {
-		return err
+func (c *addCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	if args.Flags.Exists(parsing.NewFlag(FlagEncrypt, "")) && args.Flags.Exists(parsing.NewFlag(FlagCopy, "")) {
+		return &ErrCmdArgument{"--encrypt and --copy cannot be used together."}
+	}
+
+	add := terminalio.AddDotfile
+
+	for _, f := range c.Flags {
+		switch f.Name {
+		case FlagEncrypt:
+			if args.Flags.Exists(f) {
+				add = terminalio.AddSecretDotfile
+			}
+		case FlagCopy:
+			if args.Flags.Exists(f) {
+				add = terminalio.AddCopyDotfile
+			}
+		}
 	}
 
-	return nil
+	return forEachPath(op, args.PositionalArgs, func(path string) error {
+		return add(op, path, conf.UserspaceDir, conf.DotfilesDir)
+	})
 }
@@ -0,0 +1,160 @@
+package cli_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/cli"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func TestAddManyPathsKeepsSucceededPathsAndReportsFailures(t *testing.T) {
+	// Arrange
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	userspaceDir := env.UserspaceDir.Path
+	dotfilesDir := env.DotfilesDir.Path
+
+	for _, name := range []string{"a.conf", "b.conf", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(userspaceDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(userspaceDir, "missing")
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "add",
+		PositionalArgs: []string{filepath.Join(userspaceDir, "*.conf"), missing},
+		Flags:          parsing.NewFlagHolder(map[string]string{}),
+	}
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{},
+		UserspaceDir:   userspaceDir,
+		DotfilesDir:    dotfilesDir,
+		BackupDir:      t.TempDir(),
+	}
+
+	// Act
+	executor := cli.NewCmdExecutor([]cli.Command{cli.NewAddCommand()}, nil)
+	run, err := executor.Load(cliInput, dotfConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run()
+
+	// Assert
+	var pathsFailed *cli.ErrCmdPathsFailed
+	if !errors.As(err, &pathsFailed) {
+		t.Fatalf("expected %T but got %v", pathsFailed, err)
+	}
+	test.AssertEqual(1, pathsFailed.Failed, t)
+	test.AssertEqual(3, pathsFailed.Total, t)
+
+	for _, name := range []string{"a.conf", "b.conf"} {
+		p := filepath.Join(userspaceDir, name)
+		if ok, err := terminalio.IsFileSymlink(p); !ok || err != nil {
+			t.Errorf("File in userspace should be a symlink at %s: %v", p, err)
+		}
+	}
+
+	// Not matched by the pattern
+	if ok, _ := terminalio.IsFileSymlink(filepath.Join(userspaceDir, "c.txt")); ok {
+		t.Errorf("File in userspace should not have been added: c.txt")
+	}
+}
+
+func TestAddRequiresAtLeastOnePath(t *testing.T) {
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "add",
+		PositionalArgs: []string{},
+		Flags:          parsing.NewFlagHolder(map[string]string{}),
+	}
+
+	executor := cli.NewCmdExecutor([]cli.Command{cli.NewAddCommand()}, nil)
+	run, err := executor.Load(cliInput, &parsing.DotfConfiguration{ConfigMetadata: &parsing.ConfigMetadata{}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var argErr *cli.ErrCmdArgument
+	if err := run(); !errors.As(err, &argErr) {
+		t.Errorf("expected %T but got %v", argErr, err)
+	}
+}
+
+func TestAddRejectsEncryptTogetherWithCopy(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	file := filepath.Join(env.UserspaceDir.Path, ".netrc")
+	if err := os.WriteFile(file, []byte("machine example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "add",
+		PositionalArgs: []string{file},
+		Flags:          parsing.NewFlagHolder(map[string]string{cli.FlagEncrypt: "", cli.FlagCopy: ""}),
+	}
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{},
+		UserspaceDir:   env.UserspaceDir.Path,
+		DotfilesDir:    env.DotfilesDir.Path,
+	}
+
+	var argErr *cli.ErrCmdArgument
+	if err := cli.NewAddCommand().Run(cliInput, dotfConf, newTestOperation(t)); !errors.As(err, &argErr) {
+		t.Fatalf("expected %T but got %v", argErr, err)
+	}
+
+	// Nothing was added
+	if exists, _ := terminalio.CheckIfFileExists(filepath.Join(env.DotfilesDir.Path, ".netrc")); exists {
+		t.Error("File should not have been copied to dotfiles")
+	}
+}
+
+func TestAddReportsFailedPathsWhenPostHookFails(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	hooksDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(hooksDir, "post-add"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(env.UserspaceDir.Path, ".vimrc")
+	if err := os.WriteFile(file, []byte("set number\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "add",
+		PositionalArgs: []string{file, filepath.Join(env.UserspaceDir.Path, "missing")},
+		Flags:          parsing.NewFlagHolder(map[string]string{}),
+	}
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{},
+		UserspaceDir:   env.UserspaceDir.Path,
+		DotfilesDir:    env.DotfilesDir.Path,
+		BackupDir:      t.TempDir(),
+		HooksDir:       hooksDir,
+	}
+
+	executor := cli.NewCmdExecutor([]cli.Command{cli.NewAddCommand()}, nil)
+	run, err := executor.Load(cliInput, dotfConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pathsFailed *cli.ErrCmdPathsFailed
+	if err := run(); !errors.As(err, &pathsFailed) {
+		t.Fatalf("expected %T but got %v", pathsFailed, err)
+	}
+	test.AssertEqual(1, pathsFailed.Failed, t)
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+// Actions of the backup command
+const (
+	backupActionList    string = "list"
+	backupActionRestore string = "restore"
+)
+
+type backupCommand struct {
+	*commandBase
+	UserInteractor UserInteractor
+}
+
+func NewBackupCommand() *backupCommand {
+	name := "backup"
+	desc := `
+	Every dotf command that overwrites or removes a file first makes a backup of it. Backups made by
+	the same command are kept together in a generation identified by a timestamp. The backups are
+	stored in the directory configured by 'backupdir' and persist between reboots.
+
+	- 'backup list' shows all generations together with the command that created them and the
+	files that were backed up.
+	- 'backup restore <id>' restores all files in the generation with the given id to their
+	original location. If a path to a file is given as well only that file is restored. Files
+	currently found at the original location are backed up before they are replaced.`
+
+	return &backupCommand{
+		commandBase: &commandBase{
+			Name:     name,
+			Overview: "List or restore backups of overwritten files.",
+			Usage:    name + " list | restore <id> [<filepath>] [--help]",
+			Args: []arg{
+				{Name: "action", Description: "Either 'list' or 'restore'."},
+				{Name: "id", Description: "Id of the backup generation to restore.", Optional: true},
+				{Name: "file", Description: "Original path of a single file to restore.", Optional: true},
+			},
+			Flags:       []*parsing.Flag{},
+			Description: desc,
+		},
+		UserInteractor: StdInUserInteractor{},
+	}
+}
+
+func (c *backupCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	switch args.PositionalArgs[0] {
+	case backupActionList:
+		return c.list(op.Backups())
+	case backupActionRestore:
+		if len(args.PositionalArgs) < 2 {
+			return &ErrCmdArgument{"the id of the backup generation to restore is required."}
+		}
+		var file string
+		if len(args.PositionalArgs) > 2 {
+			file = args.PositionalArgs[2]
+		}
+		return c.restore(op, args.PositionalArgs[1], file)
+	default:
+		return &ErrCmdArgument{fmt.Sprintf("unknown action '%s' given to %s command.", args.PositionalArgs[0], c.Name)}
+	}
+}
+
+// Prints all backup generations and the files they contain.
+func (c *backupCommand) list(store *terminalio.BackupStore) error {
+	gens, err := store.ListGenerations()
+	if err != nil {
+		return err
+	}
+
+	if len(gens) == 0 {
+		logging.Info("No backups found")
+		return nil
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 4, ' ', 0)
+
+	for _, g := range gens {
+		fmt.Fprintf(w, "%s\t%s\t%s\n",
+			logging.Color(g.Id, logging.Blue), g.Command, g.Created.Format("2006-01-02 15:04:05"))
+		for _, e := range g.Entries {
+			fmt.Fprintf(w, "\t%s\t\n", e.Original)
+		}
+	}
+	w.Flush()
+	return nil
+}
+
+// Restores the backup generation with the given id after confirmation by the user.
+func (c *backupCommand) restore(op *terminalio.Operation, id, file string) error {
+	gen, err := op.Backups().GetGeneration(id)
+	if err != nil {
+		return err
+	}
+
+	logging.Warn(fmt.Sprintf("Restoring backup %s made by '%s':", logging.Color(gen.Id, logging.Green), gen.Command))
+	if file != "" {
+		logging.Warn("\t" + file)
+	} else {
+		for _, e := range gen.Entries {
+			logging.Warn("\t" + e.Original)
+		}
+	}
+
+	if !c.UserInteractor.ConfirmByUser("Existing files will be replaced. Do you want to continue?") {
+		logging.Info("Aborted by user")
+		return nil
+	}
+
+	if err := terminalio.RestoreBackup(op, id, file); err != nil {
+		return err
+	}
+
+	logging.Ok("Backup", gen.Id, "successfully restored")
+	return nil
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+// Expands shell-style glob patterns among the positional args taken by a variadic arg in 'args'.
+// Patterns matching nothing are kept as they are, so the command reports them as not found.
+func expandGlobs(positional []string, args []arg) []string {
+	if len(args) == 0 || !args[len(args)-1].Variadic {
+		return positional
+	}
+
+	first := len(args) - 1
+	expanded := make([]string, 0, len(positional))
+	for i, p := range positional {
+		if i < first || !strings.ContainsAny(p, "*?[") {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		pattern := p
+		if strings.HasPrefix(pattern, "~/") {
+			home, _ := os.UserHomeDir()
+			pattern = filepath.Join(home, pattern[2:])
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			expanded = append(expanded, p)
+			continue
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded
+}
+
+// Runs 'fn' for every path in 'paths' without stopping at the first failure and prints a summary of
+// the paths that succeeded and failed. The changes made for a path are undone if it fails. A single
+// path is run without a summary and its error is returned as it is. Otherwise an ErrCmdPathsFailed
+// is returned if any path failed, which keeps the changes made for the other paths.
+func forEachPath(op *terminalio.Operation, paths []string, fn func(path string) error) error {
+	if len(paths) == 1 {
+		return fn(paths[0])
+	}
+
+	var succeeded, failed []string
+	for _, p := range paths {
+		// Paths that failed only in part keep the changes that succeeded
+		var partial error
+		err := op.Atomic(func() error {
+			err := fn(p)
+			var pathsFailed *ErrCmdPathsFailed
+			if errors.As(err, &pathsFailed) {
+				partial = err
+				return nil
+			}
+			return err
+		})
+		if err == nil {
+			err = partial
+		}
+		if err != nil {
+			logging.Error(p+":", err)
+			failed = append(failed, fmt.Sprintf("%s: %v", p, err))
+			continue
+		}
+		succeeded = append(succeeded, p)
+	}
+
+	printPathsSummary(succeeded, failed)
+	if len(failed) > 0 {
+		return &ErrCmdPathsFailed{Failed: len(failed), Total: len(paths)}
+	}
+	return nil
+}
+
+// Prints a summary of the result of running a command on multiple paths.
+func printPathsSummary(succeeded, failed []string) {
+	fmt.Println()
+	fmt.Println(logging.Color(fmt.Sprintf("Succeeded (%d):", len(succeeded)), logging.Green))
+	for _, p := range succeeded {
+		fmt.Println("\t" + p)
+	}
+	fmt.Println(logging.Color(fmt.Sprintf("Failed (%d):", len(failed)), logging.Red))
+	for _, p := range failed {
+		fmt.Println("\t" + p)
+	}
+	fmt.Println()
+}
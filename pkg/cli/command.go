@@ -3,11 +3,23 @@ package cli
 
 import (
 	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
 )
 
 // Cli command specific flags
 const (
 	FlagExternal string = "external"
+	FlagAll      string = "all"
+	FlagResolve  string = "resolve"
+	FlagStrategy string = "strategy"
+	FlagEncrypt  string = "encrypt"
+	FlagAdopt    string = "adopt"
+	FlagCopy     string = "copy"
+)
+
+// Flags accepted by every command
+const (
+	FlagDryRun string = "dry-run"
 )
 
 // Command is the dotf type denoting a runnable and printable command
@@ -18,7 +30,14 @@ type Command interface {
 
 // CommandRunner is a interface to commands that can be run
 type CommandRunner interface {
-	Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration) error // Run the Command using the given args and config
+	// Run the Command using the given args and config. File system changes are made through 'op'.
+	Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error
+}
+
+// standaloneCommand is implemented by commands that do not need the ignore files and the manifest.
+// They are run with an operation without them, so they work even if these cannot be read.
+type standaloneCommand interface {
+	standalone()
 }
 
 // CommandPrintable is used where the command base info is only needed
@@ -26,7 +45,7 @@ type CommandPrintable interface {
 	getName() string           // Name of command
 	getOverview() string       // One-liner description of the command
 	getUsage() string          // How to use the command
-	getArgs() []arg            // Required arguments
+	getArgs() []arg            // Positional arguments
 	getFlags() []*parsing.Flag // Optional flags
 	getDescription() string    // Detailed description
 }
@@ -35,6 +54,8 @@ type CommandPrintable interface {
 type arg struct {
 	Name        string
 	Description string
+	Optional    bool // Optional args can only be followed by other optional args
+	Variadic    bool // Takes all remaining positional args. Only the last arg can be variadic.
 }
 
 // Implements the CommandPrintable interface. Contains everything needed by a command.
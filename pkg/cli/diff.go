@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+type diffCommand struct {
+	*commandBase
+	UserInteractor UserInteractor
+}
+
+func NewDiffCommand() *diffCommand {
+	name := "diff"
+	desc := `
+	Shows the differences between a dotfile and a regular file or directory found at its location in
+	userspace instead of the symlink to it. This happens e.g. when an editor saves a file by replacing
+	it or when an application rewrites its own configuration. The differences are shown as a unified
+	diff from the dotfile to the copy in userspace.
+
+	For each copy a prompt asks whether to adopt it. Adopting moves the copy into dotfiles in place of
+	the dotfile, which is backed up first, and restores the symlink in userspace. If the '--adopt'
+	flag is given, every copy is adopted without asking.
+
+	The command can be used both on files inside the dotfiles directory as well as files in userspace.
+	If a directory is given, every dotfile below it is compared.
+
+	Templates are compared with the file rendered from them and secrets with the file decrypted from
+	them. Neither can be adopted: edit the template instead, or encrypt a changed secret again using
+	'dotf revert' followed by 'dotf add --encrypt'.`
+
+	return &diffCommand{
+		commandBase: &commandBase{
+			Name:     name,
+			Overview: "Show and adopt changes made to copies of dotfiles in userspace.",
+			Usage:    name + " <filepath> [--adopt] [--help]",
+			Args:     []arg{{Name: "file/dir", Description: "Path to file/dir inside dotfiles or path to file/dir in userspace."}},
+			Flags: []*parsing.Flag{
+				parsing.NewFlag(FlagAdopt, "Adopt every copy in userspace without asking."),
+			},
+			Description: desc,
+		},
+		UserInteractor: StdInUserInteractor{},
+	}
+}
+
+func (c *diffCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	adoptAll := false
+	for _, f := range c.Flags {
+		switch f.Name {
+		case FlagAdopt:
+			if args.Flags.Exists(f) {
+				adoptAll = true
+			}
+		}
+	}
+
+	diffs, err := terminalio.DiffDotfile(op, args.PositionalArgs[0], conf.UserspaceDir, conf.DotfilesLayers())
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		logging.Ok("No copies of dotfiles found in userspace.")
+		return nil
+	}
+
+	for _, d := range diffs {
+		logging.Warn(fmt.Sprintf("A copy of the dotfile was found in userspace: %s", logging.Color(d.UserspaceFile, logging.Green)))
+		if d.Diff == "" {
+			logging.Info("The contents are identical to the dotfile.")
+		} else {
+			printDiff(d.Diff)
+		}
+
+		// Generated dotfiles have no symlink to restore and cannot be replaced by the copy
+		switch {
+		case strings.HasSuffix(d.DotfilesFile, terminalio.TemplateSuffix):
+			logging.Info("A rendered template cannot be adopted, as it would replace the template. Edit the template instead.")
+			continue
+		case strings.HasSuffix(d.DotfilesFile, terminalio.SecretSuffix):
+			logging.Info("A decrypted secret cannot be adopted. Use 'dotf revert' followed by 'dotf add --encrypt' to encrypt it again.")
+			continue
+		}
+
+		if !adoptAll && !c.UserInteractor.ConfirmByUser("Adopt the userspace version into dotfiles and restore the symlink?") {
+			logging.Info("Skipped", d.UserspaceFile)
+			continue
+		}
+
+		if err := terminalio.AdoptDotfile(op, d); err != nil {
+			return err
+		}
+		logging.Ok("Adopted", d.UserspaceFile, "into", d.DotfilesFile)
+	}
+	return nil
+}
+
+// Prints a unified diff with removed lines in red and added lines in green.
+func printDiff(diff string) {
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			fmt.Println(line)
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(logging.Color(line, logging.Blue))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(logging.Color(line, logging.Red))
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(logging.Color(line, logging.Green))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
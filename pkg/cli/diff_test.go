@@ -0,0 +1,58 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/cli"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+// For tests. Fails the test if the user is asked anything.
+type refusingInteractor struct {
+	t *testing.T
+}
+
+func (r refusingInteractor) ConfirmByUser(question string) bool {
+	r.t.Errorf("Unexpected question: %s", question)
+	return false
+}
+
+func TestDiffDoesNotOfferToAdoptRenderedTemplates(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	template := filepath.Join(env.DotfilesDir.Path, ".gitconfig.dotftmpl")
+	if err := os.WriteFile(template, []byte("[user]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rendered := filepath.Join(env.UserspaceDir.Path, ".gitconfig")
+	if err := os.WriteFile(rendered, []byte("[user]\nname = changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "diff",
+		PositionalArgs: []string{rendered},
+		Flags:          parsing.NewEmptyFlagHolder(),
+	}
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{},
+		UserspaceDir:   env.UserspaceDir.Path,
+		DotfilesDir:    env.DotfilesDir.Path,
+	}
+
+	cmd := cli.NewDiffCommand()
+	cmd.UserInteractor = refusingInteractor{t}
+	if err := cmd.Run(cliInput, dotfConf, newTestOperation(t)); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	contents, err := os.ReadFile(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual("[user]\n", string(contents), t)
+}
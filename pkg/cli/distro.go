@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+// Actions of the distro command
+const (
+	distroActionList   string = "list"
+	distroActionCreate string = "create"
+	distroActionSwitch string = "switch"
+	distroActionDiff   string = "diff"
+)
+
+type distroCommand struct {
+	*commandBase
+	UserInteractor UserInteractor
+}
+
+func NewDistroCommand() *distroCommand {
+	name := "distro"
+	desc := `
+	A distribution is a full set of dotfiles for one kind of machine, e.g. a work laptop, a home
+	desktop or a server. Every directory inside the directory configured by 'distrosdir' is a
+	distribution, so all of them can be kept in the same synced repository.
+
+	- 'distro list' shows all distributions. The one currently used as dotfiles directory is marked.
+	- 'distro create <name>' creates a new empty distribution.
+	- 'distro switch <name>' removes the symlinks into the current dotfiles directory, installs
+	every dotfile of the distribution <name> and sets 'dotfilesdir' in the configuration file to
+	point to it. Files in the way in userspace are only replaced after confirmation. Layers given by
+	'layers' in the configuration stay installed beneath the new distribution.
+	- 'distro diff <a> <b>' shows the files that only exist in one of the two distributions and
+	the files that differ between them.`
+
+	return &distroCommand{
+		commandBase: &commandBase{
+			Name:     name,
+			Overview: "List, create, switch or compare distributions of dotfiles.",
+			Usage:    name + " list | create <name> | switch <name> | diff <a> <b> [--help]",
+			Args: []arg{
+				{Name: "action", Description: "Either 'list', 'create', 'switch' or 'diff'."},
+				{Name: "name", Description: "Name of the distribution.", Optional: true},
+				{Name: "other", Description: "Name of the distribution to compare with.", Optional: true},
+			},
+			Flags:       []*parsing.Flag{},
+			Description: desc,
+		},
+		UserInteractor: StdInUserInteractor{},
+	}
+}
+
+func (c *distroCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	if conf.DistrosDir == "" {
+		return &ErrCmdArgument{"'distrosdir' must be set in the configuration to use distributions."}
+	}
+
+	action := args.PositionalArgs[0]
+	names := args.PositionalArgs[1:]
+
+	switch action {
+	case distroActionList:
+		return c.list(conf)
+	case distroActionCreate:
+		if len(names) != 1 {
+			return &ErrCmdArgument{"the name of the distribution to create is required."}
+		}
+		return c.create(op, conf, names[0])
+	case distroActionSwitch:
+		if len(names) != 1 {
+			return &ErrCmdArgument{"the name of the distribution to switch to is required."}
+		}
+		return c.switchTo(op, conf, names[0])
+	case distroActionDiff:
+		if len(names) != 2 {
+			return &ErrCmdArgument{"the names of the two distributions to compare are required."}
+		}
+		return c.diff(op, conf, names[0], names[1])
+	default:
+		return &ErrCmdArgument{fmt.Sprintf("unknown action '%s' given to %s command.", action, c.Name)}
+	}
+}
+
+// Prints all distributions and marks the one in use.
+func (c *distroCommand) list(conf *parsing.DotfConfiguration) error {
+	names, err := terminalio.ListDistros(conf.DistrosDir)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		logging.Info("No distributions found in", conf.DistrosDir)
+		return nil
+	}
+
+	current := absOrEmpty(conf.DotfilesDir)
+	for _, name := range names {
+		path, err := terminalio.GetDistroPath(conf.DistrosDir, name)
+		if err != nil {
+			return err
+		}
+
+		if path == current {
+			fmt.Println(logging.Color("* "+name, logging.Green))
+		} else {
+			fmt.Println("  " + name)
+		}
+	}
+	return nil
+}
+
+// Creates a new empty distribution.
+func (c *distroCommand) create(op *terminalio.Operation, conf *parsing.DotfConfiguration, name string) error {
+	path, err := terminalio.CreateDistro(op, conf.DistrosDir, name)
+	if err != nil {
+		return err
+	}
+
+	logging.Ok("Created distribution", name, "at", path)
+	return nil
+}
+
+// Replaces the symlinks of the current dotfiles directory with those of the distribution 'name' and
+// makes it the dotfiles directory in the configuration file.
+func (c *distroCommand) switchTo(op *terminalio.Operation, conf *parsing.DotfConfiguration, name string) error {
+	path, err := terminalio.GetDistroPath(conf.DistrosDir, name)
+	if err != nil {
+		return err
+	}
+
+	if path == absOrEmpty(conf.DotfilesDir) {
+		logging.Info("Distribution", name, "is already in use")
+		return nil
+	}
+
+	if conf.Filepath == "" {
+		return &ErrCmdArgument{"a configuration file is required to switch distribution."}
+	}
+
+	// Layers used after the switch, with the new distribution as the most specific layer
+	next := *conf
+	next.DotfilesDir = path
+	layers := next.DotfilesLayers()
+
+	// Symlinks into the current layers, of which the dotfiles directory may not exist yet e.g.
+	// right after setup.
+	var installed []*terminalio.DotfileStatus
+	if exists, _ := terminalio.CheckIfFileExists(conf.DotfilesDir); exists {
+		statuses, err := terminalio.GetLayeredDotfilesStatus(conf.UserspaceDir, conf.DotfilesLayers(), op.Ignore(), op.Manifest())
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.State == terminalio.StateInstalled {
+				installed = append(installed, s)
+			}
+		}
+	}
+
+	// Symlinks into the current layers are replaced without confirmation
+	replaceable := make(map[string]bool, len(installed))
+	for _, s := range installed {
+		replaceable[s.UserspaceFile] = true
+	}
+
+	// A distribution installed in part is rolled back as the configuration is not switched
+	if err := installAll(op, c.UserInteractor, path, conf.UserspaceDir, layers, replaceable); err != nil {
+		return fmt.Errorf("failed to install distribution '%s': %v", name, err)
+	}
+
+	// Symlinks to dotfiles not found in any of the new layers are removed
+	for _, s := range installed {
+		rel, err := filepath.Rel(s.Layer, s.DotfilesFile)
+		if err != nil {
+			return err
+		}
+		if replacedByLayer(layers, rel) {
+			continue
+		}
+		if err := terminalio.UninstallDotfile(op, s.DotfilesFile, conf.UserspaceDir, s.Layer); err != nil {
+			return err
+		}
+	}
+
+	contents, err := os.ReadFile(conf.Filepath)
+	if err != nil {
+		return err
+	}
+
+	updated := parsing.SetConfigValue(contents, parsing.KeyDotfilesDir, path)
+	if err := terminalio.WriteFile(op, conf.Filepath, updated, true); err != nil {
+		return err
+	}
+	conf.DotfilesDir = path
+
+	logging.Ok("Switched to distribution", name)
+	return nil
+}
+
+// Returns whether the path 'rel' relative to the root of a layer exists in any of 'layers'.
+func replacedByLayer(layers terminalio.Layers, rel string) bool {
+	for _, layer := range layers {
+		if exists, _ := terminalio.CheckIfFileExists(filepath.Join(layer, rel)); exists {
+			return true
+		}
+	}
+	return false
+}
+
+// Prints the differences between the distributions 'a' and 'b'.
+func (c *distroCommand) diff(op *terminalio.Operation, conf *parsing.DotfConfiguration, a, b string) error {
+	pathA, err := terminalio.GetDistroPath(conf.DistrosDir, a)
+	if err != nil {
+		return err
+	}
+
+	pathB, err := terminalio.GetDistroPath(conf.DistrosDir, b)
+	if err != nil {
+		return err
+	}
+
+	diff, err := terminalio.DiffDirectories(pathA, pathB, op.Ignore())
+	if err != nil {
+		return err
+	}
+
+	groups := []struct {
+		header string
+		paths  []string
+		color  logging.TerminalColor
+	}{
+		{"only in " + a, diff.OnlyInA, logging.Green},
+		{"only in " + b, diff.OnlyInB, logging.Blue},
+		{"changed", diff.Changed, logging.Yellow},
+	}
+
+	for _, g := range groups {
+		if len(g.paths) == 0 {
+			continue
+		}
+		fmt.Println(logging.Color(fmt.Sprintf("%s (%d):", g.header, len(g.paths)), g.color))
+		for _, p := range g.paths {
+			fmt.Println("\t" + p)
+		}
+		fmt.Println()
+	}
+
+	if len(diff.OnlyInA)+len(diff.OnlyInB)+len(diff.Changed) == 0 {
+		logging.Info("Distributions", a, "and", b, "are identical")
+	}
+	return nil
+}
+
+// Returns the absolute version of path or an empty string if it cannot be determined.
+func absOrEmpty(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	return abs
+}
@@ -0,0 +1,75 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/cli"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func TestDistroSwitchReinstallsSymlinksAndUpdatesConfig(t *testing.T) {
+	// Arrange
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	distrosDir := env.DotfilesDir
+	laptop := distrosDir.AddTempDir("laptop")
+	server := distrosDir.AddTempDir("server")
+
+	laptopFile := laptop.AddTempFile()
+	serverFile := server.AddTempFile()
+
+	laptopLink := filepath.Join(env.UserspaceDir.Path, laptopFile.Name)
+	if err := os.Symlink(laptopFile.Path, laptopLink); err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(env.BackupDir.Path, "config")
+	config := "# dotf\nuserspacedir = " + env.UserspaceDir.Path + "\ndotfilesdir = " + laptop.Path + "\n"
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "distro",
+		PositionalArgs: []string{"switch", "server"},
+		Flags:          parsing.NewEmptyFlagHolder(),
+	}
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{Filepath: configFile},
+		UserspaceDir:   env.UserspaceDir.Path,
+		DotfilesDir:    laptop.Path,
+		DistrosDir:     distrosDir.Path,
+	}
+
+	// Act
+	cmd := cli.NewDistroCommand()
+	cmd.UserInteractor = mockInteractor{}
+	if err := cmd.Run(cliInput, dotfConf, newTestOperation(t)); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Assert
+	if exists, _ := terminalio.CheckIfFileExists(laptopLink); exists {
+		t.Errorf("Symlink into previous distribution should have been removed: %s", laptopLink)
+	}
+
+	serverLink := filepath.Join(env.UserspaceDir.Path, serverFile.Name)
+	if target, err := os.Readlink(serverLink); err != nil || target != serverFile.Path {
+		t.Errorf("Symlink into new distribution should exist at %s: %v", serverLink, err)
+	}
+
+	updated, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# dotf\nuserspacedir = " + env.UserspaceDir.Path + "\ndotfilesdir = " + server.Path + "\n"
+	if string(updated) != expected {
+		test.Fail(string(updated), expected, t)
+	}
+}
@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+// Severity of a finding made by the doctor command.
+type checkLevel int
+
+const (
+	checkOK checkLevel = iota
+	checkWarn
+	checkFail
+)
+
+func (l checkLevel) String() string {
+	switch l {
+	case checkOK:
+		return "OK"
+	case checkWarn:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+func (l checkLevel) color() logging.TerminalColor {
+	switch l {
+	case checkOK:
+		return logging.Green
+	case checkWarn:
+		return logging.Yellow
+	}
+	return logging.Red
+}
+
+// A finding is the result of a single check together with how to fix it.
+type finding struct {
+	level   checkLevel
+	message string
+	remedy  string // Empty if nothing has to be done
+}
+
+func findingOK(format string, a ...any) finding {
+	return finding{checkOK, fmt.Sprintf(format, a...), ""}
+}
+
+func findingWarn(remedy, format string, a ...any) finding {
+	return finding{checkWarn, fmt.Sprintf(format, a...), remedy}
+}
+
+func findingFail(remedy, format string, a ...any) finding {
+	return finding{checkFail, fmt.Sprintf(format, a...), remedy}
+}
+
+type doctorCommand struct {
+	*commandBase
+}
+
+func NewDoctorCommand() *doctorCommand {
+	name := "doctor"
+	desc := `
+	Validates the whole dotf setup and reports each finding as OK, WARN or FAIL together with how to
+	fix it. The configuration file, the configured directories, the git repository and its remote,
+	the key of secrets, the hooks and the installed dotfiles are checked.
+
+	The command exits with an error if any check fails, so it can be used in provisioning scripts.
+	Warnings do not make it fail.`
+
+	return &doctorCommand{
+		&commandBase{
+			Name:        name,
+			Overview:    "Check the configuration, directories and git setup.",
+			Usage:       name + " [--help]",
+			Args:        []arg{},
+			Flags:       []*parsing.Flag{},
+			Description: desc,
+		},
+	}
+}
+
+// The doctor reports problems with the ignore files and the manifest itself
+func (c *doctorCommand) standalone() {}
+
+func (c *doctorCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	var findings []finding
+	findings = append(findings, checkConfigFile(conf))
+	findings = append(findings, checkDirectories(conf)...)
+	findings = append(findings, checkSyncInterval(conf))
+	findings = append(findings, checkGit(conf)...)
+	findings = append(findings, checkKeyFile(conf)...)
+	findings = append(findings, checkHooks(conf)...)
+	findings = append(findings, checkDotfiles(conf)...)
+
+	failures := 0
+	for _, f := range findings {
+		fmt.Printf("%s\t%s\n", logging.Color(f.level.String(), f.level.color()), f.message)
+		if f.remedy != "" {
+			fmt.Printf("\t-> %s\n", f.remedy)
+		}
+		if f.level == checkFail {
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return &ErrCmdDoctorFailed{failures}
+	}
+	return nil
+}
+
+func checkConfigFile(conf *parsing.DotfConfiguration) finding {
+	if conf.Filepath == "" {
+		return findingFail(fmt.Sprintf("Create the configuration at %s using 'dotf setup' or give one using --config.",
+			parsing.NewSensibleConfiguration().Filepath), "No configuration file was loaded.")
+	}
+	return findingOK("Configuration loaded from %s.", conf.Filepath)
+}
+
+func checkDirectories(conf *parsing.DotfConfiguration) []finding {
+	findings := []finding{
+		checkDirectory("userspacedir", conf.UserspaceDir, true),
+		checkDirectory("syncdir", conf.SyncDir, true),
+		checkDirectory("dotfilesdir", conf.DotfilesDir, true),
+	}
+
+	if conf.DistrosDir != "" || len(conf.Layers) > 0 {
+		findings = append(findings, checkDirectory("distrosdir", conf.DistrosDir, len(conf.Layers) > 0))
+	}
+
+	if conf.DotfilesDir != "" && conf.SyncDir != "" && !isInside(conf.DotfilesDir, conf.SyncDir) {
+		findings = append(findings, findingFail("Move the dotfiles directory into syncdir or change dotfilesdir.",
+			"dotfilesdir %s is not inside syncdir %s, so it is never synced.", conf.DotfilesDir, conf.SyncDir))
+	}
+
+	if conf.DistrosDir != "" && conf.SyncDir != "" && !isInside(conf.DistrosDir, conf.SyncDir) {
+		findings = append(findings, findingWarn("Move the distributions into syncdir or change distrosdir.",
+			"distrosdir %s is not inside syncdir %s, so it is never synced.", conf.DistrosDir, conf.SyncDir))
+	}
+
+	for _, layer := range conf.Layers {
+		path := filepath.Join(conf.DistrosDir, layer)
+		if exists, _ := isDir(path); !exists {
+			findings = append(findings, findingFail(fmt.Sprintf("Create it using 'dotf distro create %s' or remove it from layers.", layer),
+				"Layer '%s' was not found at %s.", layer, path))
+		}
+	}
+
+	if conf.BackupDir != "" {
+		if info, err := os.Stat(conf.BackupDir); err == nil && !info.IsDir() {
+			findings = append(findings, findingFail("Point backupdir to a directory.", "backupdir %s is not a directory.", conf.BackupDir))
+		}
+	}
+	return findings
+}
+
+// Checks that the directory configured by 'key' is set to an existing absolute directory.
+func checkDirectory(key, path string, required bool) finding {
+	switch {
+	case path == "" && required:
+		return findingFail(fmt.Sprintf("Set '%s' in the configuration.", key), "%s is not set.", key)
+	case path == "":
+		return findingOK("%s is not set.", key)
+	case strings.HasPrefix(path, "~"):
+		return findingFail("Use '~/' followed by the path or an absolute path.", "%s %s starts with a '~' that is not expanded.", key, path)
+	case strings.Contains(path, "$"):
+		return findingFail("Write the path without environment variables.", "%s %s contains environment variables, which are not expanded.", key, path)
+	}
+
+	isDirectory, err := isDir(path)
+	if err != nil {
+		return findingFail(fmt.Sprintf("Create the directory or change '%s'.", key), "%s %s does not exist.", key, path)
+	}
+	if !isDirectory {
+		return findingFail(fmt.Sprintf("Point '%s' to a directory.", key), "%s %s is not a directory.", key, path)
+	}
+	if !filepath.IsAbs(path) {
+		return findingWarn("Use an absolute path.", "%s %s is relative to the directory dotf is run from.", key, path)
+	}
+	return findingOK("%s %s exists.", key, path)
+}
+
+func checkSyncInterval(conf *parsing.DotfConfiguration) finding {
+	if conf.SyncIntervalSecs <= 0 {
+		return findingFail("Set syncintervalsecs to a positive number of seconds.",
+			"syncintervalsecs is %d, so dotf-tray cannot sync at an interval.", conf.SyncIntervalSecs)
+	}
+	return findingOK("dotf-tray syncs every %d seconds.", conf.SyncIntervalSecs)
+}
+
+func checkGit(conf *parsing.DotfConfiguration) []finding {
+	if exists, _ := isDir(conf.SyncDir); !exists {
+		return nil
+	}
+
+	if !terminalio.IsGitRepository(conf.SyncDir) {
+		return []finding{findingFail("Run 'git init' in syncdir and add a remote using 'git remote add'.",
+			"syncdir %s is not a git repository.", conf.SyncDir)}
+	}
+	findings := []finding{findingOK("syncdir %s is a git repository.", conf.SyncDir)}
+
+	opts, err := terminalio.ResolveSyncOptions(conf.SyncDir, conf.SyncOptions())
+	if err != nil {
+		return append(findings, findingFail("Set 'remote' and 'branch' in the configuration or run 'git branch --set-upstream-to'.",
+			"No remote to sync with: %v", err))
+	}
+
+	if !terminalio.HasRemote(conf.SyncDir, opts.Remote) {
+		return append(findings, findingFail(fmt.Sprintf("Add it using 'git remote add %s <url>' or change 'remote'.", opts.Remote),
+			"Remote '%s' does not exist.", opts.Remote))
+	}
+
+	if !terminalio.HasRemoteBranch(conf.SyncDir, opts.Remote, opts.Branch) {
+		return append(findings, findingWarn("Run 'dotf sync' to fetch it. It is created on the first push if it does not exist.",
+			"Branch '%s' of remote '%s' has not been fetched.", opts.Branch, opts.Remote))
+	}
+	return append(findings, findingOK("Syncing with %s/%s.", opts.Remote, opts.Branch))
+}
+
+func checkKeyFile(conf *parsing.DotfConfiguration) []finding {
+	if conf.KeyFile == "" {
+		return nil
+	}
+
+	if conf.SyncDir != "" && isInside(conf.KeyFile, conf.SyncDir) {
+		return []finding{findingFail("Move the key out of syncdir and change keyfile.",
+			"keyfile %s is inside syncdir, so the key of secrets would be synced.", conf.KeyFile)}
+	}
+
+	info, err := os.Stat(conf.KeyFile)
+	if err != nil {
+		// A missing key is only a problem if there are secrets, which is checked with the dotfiles
+		return nil
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return []finding{findingWarn(fmt.Sprintf("Run 'chmod 600 %s'.", conf.KeyFile),
+			"keyfile %s can be read by other users.", conf.KeyFile)}
+	}
+	return []finding{findingOK("keyfile %s is only readable by the user.", conf.KeyFile)}
+}
+
+func checkHooks(conf *parsing.DotfConfiguration) []finding {
+	dir := conf.HookOptions().Dir
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var findings []finding
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if info.Mode().Perm()&0111 == 0 {
+			path := filepath.Join(dir, e.Name())
+			findings = append(findings, findingWarn(fmt.Sprintf("Run 'chmod +x %s'.", path),
+				"Hook %s is not executable and is skipped.", path))
+		}
+	}
+	return findings
+}
+
+func checkDotfiles(conf *parsing.DotfConfiguration) []finding {
+	for _, dir := range []string{conf.UserspaceDir, conf.DotfilesDir} {
+		if exists, _ := isDir(dir); !exists {
+			return nil
+		}
+	}
+
+	op, err := conf.NewOperation("doctor", true)
+	if err != nil {
+		return []finding{findingFail("Fix the ignore files or the manifest in syncdir.",
+			"The ignore files or the manifest could not be read: %v", err)}
+	}
+
+	statuses, err := terminalio.GetLayeredDotfilesStatus(conf.UserspaceDir, conf.DotfilesLayers(), op.Ignore(), op.Manifest())
+	if err != nil {
+		return []finding{findingFail("Run 'dotf status' for details.", "Status of dotfiles could not be read: %v", err)}
+	}
+
+	var dangling, secrets int
+	for _, s := range statuses {
+		if s.State == terminalio.StateDangling {
+			dangling++
+		}
+		if strings.HasSuffix(s.DotfilesFile, terminalio.SecretSuffix) {
+			secrets++
+		}
+	}
+
+	var findings []finding
+	if secrets > 0 {
+		if _, err := os.Stat(conf.KeyFile); err != nil {
+			findings = append(findings, findingFail("Copy the key from a machine that encrypted the secrets to keyfile.",
+				"%d secrets cannot be decrypted, because the key was not found at '%s'.", secrets, conf.KeyFile))
+		}
+	}
+
+	if dangling > 0 {
+		findings = append(findings, findingWarn("Run 'dotf status' to see them and 'dotf install --all' to fix them.",
+			"%d symlinks in userspace point to files that do not exist.", dangling))
+	} else {
+		findings = append(findings, findingOK("%d dotfiles found and no dangling symlinks.", len(statuses)))
+	}
+	return findings
+}
+
+// Returns true if 'path' is 'dir' or inside it.
+func isInside(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isDir(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
@@ -0,0 +1,107 @@
+package cli_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/cli"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func TestDoctorFailsOnMisconfiguration(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata:   &parsing.ConfigMetadata{Filepath: "config"},
+		UserspaceDir:     env.UserspaceDir.Path,
+		DotfilesDir:      env.DotfilesDir.Path,
+		SyncDir:          env.BackupDir.Path, // Not a git repository and not containing dotfiles
+		SyncIntervalSecs: 0,
+	}
+	cliInput := &parsing.CommandlineInput{CommandName: "doctor", Flags: parsing.NewEmptyFlagHolder()}
+
+	err := cli.NewDoctorCommand().Run(cliInput, dotfConf, newTestOperation(t))
+	failed, ok := err.(*cli.ErrCmdDoctorFailed)
+	if !ok {
+		test.FailHard(err, &cli.ErrCmdDoctorFailed{}, t)
+	}
+
+	// Dotfiles outside syncdir, zero sync interval and no git repository
+	test.AssertEqual(3, failed.Failures, t)
+}
+
+func TestDoctorPassesWithWarnings(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	syncDir := env.DotfilesDir.Path
+	for _, args := range [][]string{{"init", "--quiet"}, {"remote", "add", "origin", "/nonexistent.git"}} {
+		git := exec.Command("git", args...)
+		git.Dir = syncDir
+		if out, err := git.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata:   &parsing.ConfigMetadata{Filepath: "config"},
+		UserspaceDir:     env.UserspaceDir.Path,
+		DotfilesDir:      env.DotfilesDir.AddTempDir("host").Path,
+		SyncDir:          syncDir,
+		SyncIntervalSecs: 60,
+		Remote:           "origin",
+		Branch:           "main", // Never fetched, which is only a warning
+	}
+	cliInput := &parsing.CommandlineInput{CommandName: "doctor", Flags: parsing.NewEmptyFlagHolder()}
+
+	if err := cli.NewDoctorCommand().Run(cliInput, dotfConf, newTestOperation(t)); err != nil {
+		test.FailHard(err, "No checks should have failed", t)
+	}
+}
+
+func TestDoctorReportsMalformedManifest(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	syncDir := env.DotfilesDir.Path
+	for _, args := range [][]string{{"init", "--quiet"}, {"remote", "add", "origin", "/nonexistent.git"}} {
+		git := exec.Command("git", args...)
+		git.Dir = syncDir
+		if out, err := git.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(syncDir, terminalio.ManifestName), []byte("[files\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata:   &parsing.ConfigMetadata{Filepath: "config"},
+		UserspaceDir:     env.UserspaceDir.Path,
+		DotfilesDir:      env.DotfilesDir.AddTempDir("host").Path,
+		SyncDir:          syncDir,
+		BackupDir:        t.TempDir(),
+		SyncIntervalSecs: 60,
+		Remote:           "origin",
+		Branch:           "main",
+	}
+	cliInput := &parsing.CommandlineInput{CommandName: "doctor", Flags: parsing.NewEmptyFlagHolder()}
+
+	// The manifest is reported as a finding instead of keeping the doctor from running
+	executor := cli.NewCmdExecutor([]cli.Command{cli.NewDoctorCommand()}, nil)
+	run, err := executor.Load(cliInput, dotfConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run()
+	failed, ok := err.(*cli.ErrCmdDoctorFailed)
+	if !ok {
+		test.FailHard(err, &cli.ErrCmdDoctorFailed{}, t)
+	}
+	test.AssertEqual(1, failed.Failures, t)
+}
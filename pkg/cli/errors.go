@@ -27,6 +27,18 @@ type ErrCmdAlreadyRegistered struct {
 	message string
 }
 
+// The ErrCmdDoctorFailed is returned by the doctor command if any check failed.
+type ErrCmdDoctorFailed struct {
+	Failures int
+}
+
+// The ErrCmdPathsFailed is returned by commands taking many paths if some of them failed. The
+// changes made for the other paths are kept.
+type ErrCmdPathsFailed struct {
+	Failed int
+	Total  int
+}
+
 type ErrGit struct {
 	Path string
 	Err  error
@@ -52,6 +64,14 @@ func (e *ErrCmdAlreadyRegistered) Error() string {
 	return fmt.Sprintf("%s command already registered", e.message)
 }
 
+func (e *ErrCmdDoctorFailed) Error() string {
+	return fmt.Sprintf("%d checks failed", e.Failures)
+}
+
+func (e *ErrCmdPathsFailed) Error() string {
+	return fmt.Sprintf("%d of %d paths failed", e.Failed, e.Total)
+}
+
 func (e *ErrGit) Error() string {
 	return fmt.Sprintf("failed to execute git command in dir: %s: %v", e.Path, e.Err)
 }
@@ -1,21 +1,27 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/mortenskoett/dotf-go/pkg/logging"
 	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
 )
 
 // Environment used to execute commands inside
 type CmdExecutor struct {
-	commands map[string]Command
+	commands    map[string]Command
+	globalFlags []*parsing.Flag // Flags valid for every command
 }
 
-// Instantiate a new command executor to hold all available commands
-func NewCmdExecutor(cmds []Command) *CmdExecutor {
+// Instantiate a new command executor to hold all available commands. The global flags are
+// accepted by every command in addition to their own flags.
+func NewCmdExecutor(cmds []Command, globalFlags []*parsing.Flag) *CmdExecutor {
 	exec := CmdExecutor{
-		commands: map[string]Command{},
+		commands:    map[string]Command{},
+		globalFlags: globalFlags,
 	}
 	for _, cmd := range cmds {
 		exec.register(cmd)
@@ -59,33 +65,116 @@ func (ce *CmdExecutor) Load(
 		}
 
 		// Check if invalid flags for current command
-		var invalidflags string
-		for _, cmdflag := range cmd.getFlags() {
-			for _, cliflag := range cmdin.Flags.GetAllKeys() {
-				if cmdflag.Name != cliflag {
-					invalidflags += cliflag
-					invalidflags += ", "
-				}
-
+		var invalidflags []string
+		for _, cliflag := range cmdin.Flags.GetAllKeys() {
+			if !containsFlag(cliflag, cmd.getFlags()) && !containsFlag(cliflag, ce.globalFlags) {
+				invalidflags = append(invalidflags, cliflag)
 			}
 		}
 
-		if invalidflags != "" {
-			// Remove last space+comma
-			invalidflags = invalidflags[:len(invalidflags)-2]
-			logging.Warn("Invalid flags given for", cmd.getName(), "command:", invalidflags)
+		if len(invalidflags) > 0 {
+			logging.Warn("Invalid flags given for", cmd.getName(), "command:", strings.Join(invalidflags, ", "))
 		}
 
-		// Check for number of required positional args
-		if len(cmdin.PositionalArgs) != len(cmd.getArgs()) {
+		// Check for number of required and optional positional args
+		required, max := countArgs(cmd.getArgs())
+		if len(cmdin.PositionalArgs) < required || (max >= 0 && len(cmdin.PositionalArgs) > max) {
 			return &ErrCmdArgument{fmt.Sprintf(
-				"%d arguments given, but %d required.", len(cmdin.PositionalArgs), len(cmd.getArgs()))}
+				"%d arguments given, but %s required.", len(cmdin.PositionalArgs), describeArgCount(required, max))}
+		}
+
+		// Patterns may be quoted to keep them from being expanded by the shell
+		cmdin.PositionalArgs = expandGlobs(cmdin.PositionalArgs, cmd.getArgs())
+
+		hooks := terminalio.NewHooks(conf.HookOptions())
+
+		// Commands repairing or checking the setup must run even if the ignore files or the
+		// manifest cannot be read
+		dryRun := cmdin.Flags.Exists(parsing.NewFlag(FlagDryRun, ""))
+		var op *terminalio.Operation
+		var err error
+		if _, ok := cmd.(standaloneCommand); ok {
+			op = terminalio.NewOperation(cmd.getName(), conf.OperationOptions(dryRun))
+		} else if op, err = conf.NewOperation(cmd.getName(), dryRun); err != nil {
+			return err
+		}
+
+		if err := hooks.Run(op, terminalio.HookPre, cmd.getName(), existingPaths(cmdin.PositionalArgs)); err != nil {
+			return err
+		}
+
+		// Changes made by a failed command are undone so userspace is never left half-finished.
+		// Paths handled successfully are kept when a command only failed for some of its paths.
+		runErr := cmd.Run(cmdin, conf, op)
+		var pathsFailed *ErrCmdPathsFailed
+		if runErr != nil && !errors.As(runErr, &pathsFailed) {
+			return op.Rollback(runErr)
+		}
+		op.Commit()
+
+		// The paths a command failed for are still reported if the post hook fails too
+		if err := hooks.Run(op, terminalio.HookPost, cmd.getName(), op.Changed()); err != nil {
+			if runErr == nil {
+				return err
+			}
+			logging.Error(err)
 		}
 
-		return cmd.Run(cmdin, conf)
+		if op.DryRun() {
+			printPlan(op.Plan())
+		}
+
+		return runErr
 	}, nil
 }
 
+// Returns the absolute paths of the args that point to existing files. Used to tell pre hooks which
+// paths a command is about to change.
+func existingPaths(args []string) []string {
+	var paths []string
+	for _, a := range args {
+		if abs, err := terminalio.GetAndValidateAbsolutePath(a); err == nil {
+			paths = append(paths, abs)
+		}
+	}
+	return paths
+}
+
+// Returns the number of required args and the maximum number of args. The maximum is -1 if the last
+// arg is variadic.
+func countArgs(args []arg) (required, max int) {
+	for _, a := range args {
+		if !a.Optional {
+			required++
+		}
+	}
+	if len(args) > 0 && args[len(args)-1].Variadic {
+		return required, -1
+	}
+	return required, len(args)
+}
+
+// Describes the accepted number of args in a human readable way.
+func describeArgCount(required, max int) string {
+	if max < 0 {
+		return fmt.Sprintf("at least %d", required)
+	}
+	if required == max {
+		return fmt.Sprintf("%d", required)
+	}
+	return fmt.Sprintf("%d to %d", required, max)
+}
+
+// Returns true if a flag with the given name is among flags.
+func containsFlag(name string, flags []*parsing.Flag) bool {
+	for _, f := range flags {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Checks whether user has inputted a request for help instead of a command name
 func userhelp(cmdName string, helpFlags []*parsing.Flag) bool {
 	isHelpFlagGiven := func() bool {
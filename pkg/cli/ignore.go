@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+type ignoreCommand struct {
+	*commandBase
+}
+
+func NewIgnoreCommand() *ignoreCommand {
+	name := "ignore"
+	desc := `
+	Shows which paths in the dotfiles directory are excluded by the given pattern. This makes it
+	possible to try out a pattern before adding it to a '.dotfignore' file. If no pattern is given,
+	the paths excluded by the current ignore files are shown.
+
+	Patterns are read from '.dotfignore' in the dotfiles directory and in the sync directory and
+	follow the format of gitignore: '*' matches within a single path component, '**' matches any
+	number of them, a trailing '/' only matches directories, a '/' anywhere else anchors the pattern
+	to the directory of the ignore file and a leading '!' includes a path again. The patterns of the
+	dotfiles directory also apply to the equal locations in userspace.
+
+	Ignored paths are left out by status, install, add, revert, migrate, distro and backups. The
+	'.git' directory, the '.dotfignore' files themselves and the '.dotfvars' files of templates are
+	always ignored.`
+
+	return &ignoreCommand{
+		&commandBase{
+			Name:     name,
+			Overview: "Show which paths an ignore pattern excludes.",
+			Usage:    name + " [<pattern>] [--help]",
+			Args: []arg{{
+				Name:        "pattern",
+				Description: "Pattern as written in a .dotfignore file. Optional.",
+				Optional:    true,
+			}},
+			Flags:       []*parsing.Flag{},
+			Description: desc,
+		},
+	}
+}
+
+func (c *ignoreCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	layers := conf.DotfilesLayers()
+
+	ignore := op.Ignore()
+	header := "Excluded by ignore files"
+	if len(args.PositionalArgs) > 0 {
+		pattern := args.PositionalArgs[0]
+		ignore = terminalio.NewIgnoreMatcher(append(append([]string{}, layers...), conf.UserspaceDir), pattern)
+		header = fmt.Sprintf("Excluded by '%s'", pattern)
+	}
+
+	var excluded []string
+	for _, layer := range layers {
+		paths, err := terminalio.IgnoredPaths(layer, ignore)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range paths {
+			rel, err := filepath.Rel(layer, p)
+			if err != nil {
+				rel = p
+			}
+			if len(layers) > 1 {
+				rel += " [" + filepath.Base(layer) + "]"
+			}
+			excluded = append(excluded, rel)
+		}
+	}
+
+	fmt.Println(logging.Color(fmt.Sprintf("%s (%d):", header, len(excluded)), logging.Yellow))
+	for _, p := range excluded {
+		fmt.Println("\t" + p)
+	}
+	return nil
+}
@@ -22,7 +22,8 @@ func NewInstallCommand() *installCommand {
 	the previously created dotfile to take its place.
 
 	The command can be used both on files inside the dotfiles directory as well as files in
-	userspace and will do the same thing. A file inside dotfiles can be considered the source and
+	userspace and will do the same thing. Several paths and glob patterns can be given, which are
+	installed one by one followed by a summary. A file inside dotfiles can be considered the source and
 	a file in userspace will be considered the target. The source must exist and the target will be
 	overwritten (after a backup is made).
 
@@ -31,16 +32,45 @@ func NewInstallCommand() *installCommand {
 	- If the '--external <directoy-path>' flag is given, it is possible to install a dotfile from an
 	external dotfiles directory by giving the path of that directory. The file is copied into the
 	dotfiles directory of the current distribution using the relative path from the given directory
-	path and installed into userspace .`
+	path and installed into userspace .
+	- If the '--all' flag is given, every dotfile in the dotfiles directory is installed. Paths to
+	directories can be given to only install the dotfiles found below them. Files already in the way in
+	userspace are listed together and a single prompt asks whether to overwrite all of them. Dotfiles
+	that are already installed are skipped. A dotfile that fails to install does not stop the others
+	and is listed in the summary. Directories missing from userspace entirely are symlinked as a whole,
+	the same way 'add' installs directories, while directories already found in userspace have their
+	contents installed individually.
+
+	If 'layers' is set in the configuration, a file given by its path in userspace is installed from
+	the most specific layer containing it. Directories found in more than one layer are created in
+	userspace and their contents are installed individually.
+
+	Templates, dotfiles ending with '.dotftmpl', are rendered into userspace without the suffix
+	instead of being symlinked. They are Go templates (https://pkg.go.dev/text/template) with the
+	fields .Host, .Distro, .Env and .Vars available, where .Vars are read as 'key = value' lines from
+	'.dotfvars' in the dotfiles directories. Directories containing templates are created in
+	userspace and their contents are installed individually.
+
+	Secrets, dotfiles ending with '.dotfsecret', are decrypted into userspace without the suffix
+	using the key in 'keyfile'. The decrypted file is only readable by the user.
+
+	Dotfiles with the install mode 'copy' in the manifest 'dotf.toml' in the sync directory are
+	copied into userspace instead of being symlinked.`
 
 	return &installCommand{
 		commandBase: &commandBase{
 			Name:     name,
-			Overview: "Install file/dir from dotfiles into userspace.",
-			Usage:    name + " <filepath> [--<flags>] [--help]",
-			Args:     []arg{{Name: "file/dir", Description: "Path to file/dir inside dotfiles or path to file/dir in userspace."}},
+			Overview: "Install files/dirs from dotfiles into userspace.",
+			Usage:    name + " [<filepath>...] [--<flags>] [--help]",
+			Args: []arg{{
+				Name:        "file/dir",
+				Description: "Paths to files/dirs inside dotfiles or in userspace. Optional with --all.",
+				Optional:    true,
+				Variadic:    true,
+			}},
 			Flags: []*parsing.Flag{
 				parsing.NewValueFlag(FlagExternal, "Install a dotfile from an external location.", "directory-path"),
+				parsing.NewFlag(FlagAll, "Install all dotfiles in dotfiles or below the given directory."),
 			},
 			Description: desc,
 		},
@@ -48,10 +78,27 @@ func NewInstallCommand() *installCommand {
 	}
 }
 
-func (c *installCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration) error {
-	fpath := args.PositionalArgs[0]
-
+func (c *installCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
 	// Handle flags
+	for _, f := range c.Flags {
+		switch f.Name {
+		case FlagAll:
+			if args.Flags.Exists(f) {
+				roots := args.PositionalArgs
+				if len(roots) == 0 {
+					roots = []string{conf.DotfilesDir}
+				}
+				return forEachPath(op, roots, func(root string) error {
+					return installAll(op, c.UserInteractor, root, conf.UserspaceDir, conf.DotfilesLayers(), nil)
+				})
+			}
+		}
+	}
+
+	if len(args.PositionalArgs) < 1 {
+		return &ErrCmdArgument{"a path to a file/dir is required unless --all is given."}
+	}
+
 	for _, f := range c.Flags {
 		switch f.Name {
 		case FlagExternal:
@@ -60,18 +107,22 @@ func (c *installCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfC
 				if err != nil {
 					return err
 				}
-				return c.externalInstall(fpath, externaldir, conf)
+				return forEachPath(op, args.PositionalArgs, func(fpath string) error {
+					return c.externalInstall(op, fpath, externaldir, conf)
+				})
 			}
 		}
 	}
-	return c.internalInstall(fpath, conf.UserspaceDir, conf.DotfilesDir)
+	return forEachPath(op, args.PositionalArgs, func(fpath string) error {
+		return c.internalInstall(op, fpath, conf.UserspaceDir, conf.DotfilesLayers())
+	})
 }
 
 // Install file outside current dotfiles directory.
-func (c *installCommand) externalInstall(file, externaldir string, conf *parsing.DotfConfiguration) error {
+func (c *installCommand) externalInstall(op *terminalio.Operation, file, externaldir string, conf *parsing.DotfConfiguration) error {
 	var dst string
 
-	_, err := terminalio.CopyExternalDotfile(file, externaldir, conf.DotfilesDir, true)
+	_, err := terminalio.CopyExternalDotfile(op, file, externaldir, conf.DotfilesDir, true)
 	if err != nil {
 		switch e := err.(type) {
 		case *terminalio.ErrConfirmProceed:
@@ -80,7 +131,7 @@ func (c *installCommand) externalInstall(file, externaldir string, conf *parsing
 				logging.Info("Aborted by user")
 				return nil
 			}
-			dst, err = terminalio.CopyExternalDotfile(file, externaldir, conf.DotfilesDir, false)
+			dst, err = terminalio.CopyExternalDotfile(op, file, externaldir, conf.DotfilesDir, false)
 			if err != nil {
 				return err
 			}
@@ -88,12 +139,12 @@ func (c *installCommand) externalInstall(file, externaldir string, conf *parsing
 			return err
 		}
 	}
-	return c.internalInstall(dst, conf.UserspaceDir, conf.DotfilesDir)
+	return c.internalInstall(op, dst, conf.UserspaceDir, conf.DotfilesLayers())
 }
 
 // Install file already inside current dotfiles directory.
-func (c *installCommand) internalInstall(file, userspacedir, dotfilesdir string) error {
-	err := terminalio.InstallDotfile(file, userspacedir, dotfilesdir, false)
+func (c *installCommand) internalInstall(op *terminalio.Operation, file, userspacedir string, layers terminalio.Layers) error {
+	err := terminalio.InstallLayeredDotfile(op, file, userspacedir, layers, false)
 	if err != nil {
 		switch e := err.(type) {
 		case *terminalio.ErrAbortOnOverwrite:
@@ -102,7 +153,7 @@ func (c *installCommand) internalInstall(file, userspacedir, dotfilesdir string)
 
 			ok := c.UserInteractor.ConfirmByUser("Do you want to continue?")
 			if ok {
-				return terminalio.InstallDotfile(file, userspacedir, dotfilesdir, ok) // Overwrite file
+				return terminalio.InstallLayeredDotfile(op, file, userspacedir, layers, ok) // Overwrite file
 			} else {
 				logging.Info("Aborted by user")
 				return nil
@@ -113,3 +164,106 @@ func (c *installCommand) internalInstall(file, userspacedir, dotfilesdir string)
 	}
 	return nil
 }
+
+// Install every dotfile of 'layers' found below 'root'. Dotfiles in conflict with existing files in userspace
+// are overwritten after a single confirmation by the user or otherwise skipped. Symlinks in
+// userspace found in 'replaceable' are overwritten without confirmation. A dotfile that fails to
+// install does not stop the others, and an ErrCmdPathsFailed is returned after the summary if any
+// failed.
+func installAll(op *terminalio.Operation, ui UserInteractor, root, userspacedir string, layers terminalio.Layers, replaceable map[string]bool) error {
+	statuses, err := terminalio.GetLayeredDotfilesStatusAt(root, userspacedir, layers, op.Ignore(), op.Manifest())
+	if err != nil {
+		return err
+	}
+
+	var pending, replaced, conflicts []*terminalio.DotfileStatus
+	var skipped []string
+
+	for _, s := range statuses {
+		switch {
+		case s.State == terminalio.StateInstalled:
+			skipped = append(skipped, s.UserspaceFile)
+		case s.State == terminalio.StateMissing:
+			pending = append(pending, s)
+		case s.State != terminalio.StateConflicting && replaceable[s.UserspaceFile]:
+			replaced = append(replaced, s)
+		default:
+			conflicts = append(conflicts, s)
+		}
+	}
+
+	overwrite := false
+	if len(conflicts) > 0 {
+		logging.Warn(fmt.Sprintf("%d files already exist in userspace:", len(conflicts)))
+		for _, s := range conflicts {
+			logging.Warn(fmt.Sprintf("\t%s (%s)", logging.Color(s.UserspaceFile, logging.Green), s.State))
+		}
+		logging.Warn("It is required to backup and delete these files to install the dotfiles.")
+		overwrite = ui.ConfirmByUser("Do you want to overwrite all of them?")
+	}
+
+	var installed, overwritten, failed []string
+
+	// The changes made for a dotfile are undone if it fails to install
+	install := func(s *terminalio.DotfileStatus, overwrite bool) bool {
+		err := op.Atomic(func() error {
+			return terminalio.InstallLayeredDotfile(op, s.DotfilesFile, userspacedir, layers, overwrite)
+		})
+		if err != nil {
+			logging.Error(s.UserspaceFile+":", err)
+			failed = append(failed, fmt.Sprintf("%s: %v", s.UserspaceFile, err))
+			return false
+		}
+		return true
+	}
+
+	for _, s := range pending {
+		if install(s, false) {
+			installed = append(installed, s.UserspaceFile)
+		}
+	}
+
+	for _, s := range replaced {
+		if install(s, true) {
+			installed = append(installed, s.UserspaceFile)
+		}
+	}
+
+	for _, s := range conflicts {
+		if !overwrite {
+			skipped = append(skipped, s.UserspaceFile)
+			continue
+		}
+		if install(s, true) {
+			overwritten = append(overwritten, s.UserspaceFile)
+		}
+	}
+
+	printInstallSummary(installed, overwritten, skipped, failed)
+	if len(failed) > 0 {
+		return &ErrCmdPathsFailed{Failed: len(failed), Total: len(statuses)}
+	}
+	return nil
+}
+
+// Prints a summary of the result of installing multiple dotfiles.
+func printInstallSummary(installed, overwritten, skipped, failed []string) {
+	fmt.Println()
+	fmt.Println(logging.Color(fmt.Sprintf("Installed (%d):", len(installed)), logging.Green))
+	for _, p := range installed {
+		fmt.Println("\t" + p)
+	}
+	fmt.Println(logging.Color(fmt.Sprintf("Overwritten (%d):", len(overwritten)), logging.Yellow))
+	for _, p := range overwritten {
+		fmt.Println("\t" + p)
+	}
+	fmt.Println(logging.Color(fmt.Sprintf("Skipped (%d):", len(skipped)), logging.Blue))
+	for _, p := range skipped {
+		fmt.Println("\t" + p)
+	}
+	fmt.Println(logging.Color(fmt.Sprintf("Failed (%d):", len(failed)), logging.Red))
+	for _, p := range failed {
+		fmt.Println("\t" + p)
+	}
+	fmt.Println()
+}
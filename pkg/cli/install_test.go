@@ -2,6 +2,8 @@ package cli_test
 
 import (
 	"bytes"
+	"errors"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -11,6 +13,11 @@ import (
 	"github.com/mortenskoett/dotf-go/pkg/test"
 )
 
+// Returns an operation that keeps its backups in a temporary directory.
+func newTestOperation(t *testing.T) *terminalio.Operation {
+	return terminalio.NewOperation("test", terminalio.OperationOptions{BackupDir: t.TempDir()})
+}
+
 // For tests.
 type mockInteractor struct {
 	b bytes.Buffer
@@ -53,7 +60,7 @@ func TestInstallExternalSymlink(t *testing.T) {
 	// Act
 	cmd := cli.NewInstallCommand()
 	cmd.UserInteractor = mockInteractor{b: stdin} // Insert buffer
-	err := cmd.Run(cliInput, dotfConf)
+	err := cmd.Run(cliInput, dotfConf, newTestOperation(t))
 	if err != nil {
 		t.Errorf("%+v", err)
 	}
@@ -115,7 +122,7 @@ func TestInstallExternalFile(t *testing.T) {
 	// Act
 	cmd := cli.NewInstallCommand()
 	cmd.UserInteractor = mockInteractor{b: stdin} // Insert buffer
-	err := cmd.Run(cliInput, dotfConf)
+	err := cmd.Run(cliInput, dotfConf, newTestOperation(t))
 	if err != nil {
 		t.Errorf("%+v", err)
 	}
@@ -140,3 +147,120 @@ func TestInstallExternalFile(t *testing.T) {
 	}
 
 }
+
+func TestInstallAllInstallsMissingAndOverwritesConflicts(t *testing.T) {
+	// Arrange
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dotfilesDir := env.DotfilesDir
+	userspaceDir := env.UserspaceDir
+
+	missingFile := dotfilesDir.AddTempFile()
+	nestedFile := dotfilesDir.AddTempDir("nested/dir").AddTempFile()
+	conflictingFile := dotfilesDir.AddTempFile()
+
+	conflictingPath := filepath.Join(userspaceDir.Path, conflictingFile.Name)
+	if err := os.WriteFile(conflictingPath, []byte("in the way"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "install",
+		PositionalArgs: []string{},
+		Flags: parsing.NewFlagHolder(map[string]string{
+			cli.FlagAll: "",
+		}),
+	}
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{},
+		UserspaceDir:   userspaceDir.Path,
+		DotfilesDir:    dotfilesDir.Path,
+	}
+
+	// A single confirmation is expected for all conflicts
+	var stdin bytes.Buffer
+	stdin.Write([]byte("Y\n"))
+
+	// Act
+	cmd := cli.NewInstallCommand()
+	cmd.UserInteractor = mockInteractor{b: stdin}
+	err := cmd.Run(cliInput, dotfConf, newTestOperation(t))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Assert
+	expectedSymlinks := []string{
+		filepath.Join(userspaceDir.Path, missingFile.Name),
+		filepath.Join(userspaceDir.Path, "nested"),
+		conflictingPath,
+	}
+
+	for _, p := range expectedSymlinks {
+		if ok, err := terminalio.IsFileSymlink(p); !ok || err != nil {
+			t.Errorf("File in userspace should be a symlink at %s: %v", p, err)
+		}
+	}
+
+	nestedUserspacePath := filepath.Join(userspaceDir.Path, "nested/dir", nestedFile.Name)
+	if exists, err := terminalio.CheckIfFileExists(nestedUserspacePath); !exists {
+		t.Errorf("Nested dotfile should be reachable through symlink at %s: %v", nestedUserspacePath, err)
+	}
+}
+
+func TestInstallAllContinuesAfterFailedDotfile(t *testing.T) {
+	// Arrange
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dotfilesDir := env.DotfilesDir
+	userspaceDir := env.UserspaceDir
+
+	first := dotfilesDir.AddTempFile()
+	second := dotfilesDir.AddTempFile()
+
+	// Fails when rendered into userspace
+	if err := os.WriteFile(filepath.Join(dotfilesDir.Path, "broken"+terminalio.TemplateSuffix), []byte("{{ .Nope"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cliInput := &parsing.CommandlineInput{
+		CommandName:    "install",
+		PositionalArgs: []string{},
+		Flags: parsing.NewFlagHolder(map[string]string{
+			cli.FlagAll: "",
+		}),
+	}
+
+	dotfConf := &parsing.DotfConfiguration{
+		ConfigMetadata: &parsing.ConfigMetadata{},
+		UserspaceDir:   userspaceDir.Path,
+		DotfilesDir:    dotfilesDir.Path,
+	}
+
+	// Act
+	cmd := cli.NewInstallCommand()
+	cmd.UserInteractor = mockInteractor{}
+	err := cmd.Run(cliInput, dotfConf, newTestOperation(t))
+
+	// Assert
+	var pathsFailed *cli.ErrCmdPathsFailed
+	if !errors.As(err, &pathsFailed) {
+		t.Fatalf("expected %T but got %v", pathsFailed, err)
+	}
+	test.AssertEqual(1, pathsFailed.Failed, t)
+	test.AssertEqual(3, pathsFailed.Total, t)
+
+	for _, f := range []*test.FileHandle{first, second} {
+		p := filepath.Join(userspaceDir.Path, f.Name)
+		if ok, err := terminalio.IsFileSymlink(p); !ok || err != nil {
+			t.Errorf("File in userspace should be a symlink at %s: %v", p, err)
+		}
+	}
+
+	if exists, _ := terminalio.CheckIfFileExists(filepath.Join(userspaceDir.Path, "broken")); exists {
+		t.Errorf("Failed template should not have been rendered into userspace")
+	}
+}
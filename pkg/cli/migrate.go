@@ -23,10 +23,15 @@ func NewMigrateCommand() *migrateCommand {
 	to locate a matching symlink in the same location relative to the given argument but in given
 	'userspace-dir'. The path 'userspace-dir' must be the root of the configured userspace, e.g.
 	'~/' aka the home folder. Note that currently if a symlink is not found in userspace, then it
-	will not be touched, however a warning will be shown.
+	will not be touched, however a warning will be shown. Once the manifest 'dotf.toml' records the
+	paths managed in the dotfiles directory, only those are migrated.
 
 	It is expected that the dotfiles directory has already been moved and that 'dotfiles-dir' is the
-	new location directory.`
+	new location directory.
+
+	Both absolute and relative symlinks are understood. Symlinks are written in the form set by
+	'relativesymlinks' in the configuration, so running the command on the current dotfiles directory
+	converts existing symlinks after the option has been changed.`
 
 	return &migrateCommand{
 		commandBase: &commandBase{
@@ -44,7 +49,7 @@ func NewMigrateCommand() *migrateCommand {
 	}
 }
 
-func (c *migrateCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration) error {
+func (c *migrateCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
 	ok := c.UserInteractor.ConfirmByUser("This operation can be desctructive. Do you want to continue?")
 	if !ok {
 		logging.Warn("Aborted by user")
@@ -54,7 +59,7 @@ func (c *migrateCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfC
 	dotfilesDir := args.PositionalArgs[0]
 	symlinkRootDir := args.PositionalArgs[1]
 
-	err := terminalio.UpdateSymlinks(symlinkRootDir, dotfilesDir)
+	err := terminalio.UpdateSymlinks(op, symlinkRootDir, dotfilesDir)
 	if err != nil {
 		return err
 	}
@@ -39,6 +39,19 @@ func PrintCommandHelp(c CommandPrintable) {
 	fmt.Println(c.getDescription())
 }
 
+// Prints the steps planned by a command run in dry-run mode.
+func printPlan(plan []string) {
+	if len(plan) == 0 {
+		logging.Info("Dry run: nothing would be changed")
+		return
+	}
+
+	logging.Info("Dry run: the following would be done")
+	for i, step := range plan {
+		fmt.Printf("\t%d. %s\n", i+1, step)
+	}
+}
+
 // Prints program header
 func printHeader(logo, version string) {
 	fmt.Println(logging.Color(logo, logging.Blue))
@@ -60,9 +73,7 @@ func printUsage[T CommandPrintable](commands []T, programName string) {
 		buf := &bytes.Buffer{}
 		if len(c.getArgs()) > 0 {
 			for _, arg := range c.getArgs() {
-				buf.WriteString("<")
-				buf.WriteString(arg.Name)
-				buf.WriteString(">")
+				buf.WriteString(formatArg(arg))
 				buf.WriteString("  ")
 			}
 		} else {
@@ -98,11 +109,7 @@ func generateUsage(c CommandPrintable) string {
 		w.Init(tabbuf, 0, 8, 8, ' ', 0)
 
 		for _, arg := range c.getArgs() {
-			buf := &bytes.Buffer{}
-			buf.WriteString("<")
-			buf.WriteString(arg.Name)
-			buf.WriteString(">")
-			str := fmt.Sprintf("\t%s\t%s", buf, arg.Description)
+			str := fmt.Sprintf("\t%s\t%s", formatArg(arg), arg.Description)
 			fmt.Fprintln(w, str)
 		}
 		w.Flush()
@@ -131,6 +138,18 @@ func generateUsage(c CommandPrintable) string {
 	return sb.String()
 }
 
+// Formats an argument as <name> or as [<name>] if it is optional.
+func formatArg(a arg) string {
+	name := "<" + a.Name + ">"
+	if a.Variadic {
+		name += "..."
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return name
+}
+
 type UserInteractor interface {
 	ConfirmByUser(question string) bool
 }
@@ -15,27 +15,29 @@ func NewRevertCommand() *revertCommand {
 	Will revert a file or directory previously added to dotfiles back to its original location in
 	userspace. The file is moved from the dotfiles directory back to userspace where the symlink is
 	removed. The command can be used both on files inside the dotfiles directory as well as symlinks
-	in userspace and will do the same thing. `
+	in userspace and will do the same thing. Several paths and glob patterns can be given, which are
+	reverted one by one followed by a summary.
+
+	A template or a secret is reverted by keeping the file rendered or decrypted from it in userspace
+	and removing it from the dotfiles directory. So is a dotfile installed by copying it.
+
+	The reverted path is removed from the manifest 'dotf.toml' in the sync directory, unless it is
+	still found in another dotfiles directory.`
 
 	return &revertCommand{
 		&commandBase{
 			Name:        name,
-			Overview:    "Revert file to its original location in userspace.",
-			Usage:       name + " <filepath> [--help]",
-			Args:        []arg{{Name: "file/dir", Description: "Path to file or dir to revert back to original location."}},
+			Overview:    "Revert files to their original location in userspace.",
+			Usage:       name + " <filepath>... [--help]",
+			Args:        []arg{{Name: "file/dir", Description: "Paths or glob patterns of files or dirs to revert back to original location.", Variadic: true}},
 			Flags:       []*parsing.Flag{},
 			Description: desc,
 		},
 	}
 }
 
-func (c *revertCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration) error {
-	filepath := args.PositionalArgs[0]
-
-	err := terminalio.RevertDotfile(filepath, conf.UserspaceDir, conf.DotfilesDir)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (c *revertCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	return forEachPath(op, args.PositionalArgs, func(path string) error {
+		return terminalio.RevertDotfile(op, path, conf.UserspaceDir, conf.DotfilesDir)
+	})
 }
@@ -37,7 +37,9 @@ func NewSetupCommand() *setupCommand {
 	}
 }
 
-func (c *setupCommand) Run(args *parsing.CommandlineInput, _ *parsing.DotfConfiguration) error {
+func (c *setupCommand) standalone() {}
+
+func (c *setupCommand) Run(args *parsing.CommandlineInput, _ *parsing.DotfConfiguration, op *terminalio.Operation) error {
 	config := parsing.NewSensibleConfiguration()
 
 	cmap, err := parsing.ConvertConfigToMap(config)
@@ -47,7 +49,7 @@ func (c *setupCommand) Run(args *parsing.CommandlineInput, _ *parsing.DotfConfig
 
 	bs := parsing.CreateSerializableConfig(cmap)
 
-	err = terminalio.WriteFile(config.Filepath, bs, false)
+	err = terminalio.WriteFile(op, config.Filepath, bs, false)
 	if err != nil {
 		switch e := err.(type) {
 		case *terminalio.ErrAbortOnOverwrite:
@@ -55,7 +57,7 @@ func (c *setupCommand) Run(args *parsing.CommandlineInput, _ *parsing.DotfConfig
 			logging.Warn(logging.Color("Current configuration will be OVERWRITTEN if you say so", logging.Red))
 			ok := c.UserInteractor.ConfirmByUser("Do you want to continue?")
 			if ok {
-				if err := terminalio.WriteFile(config.Filepath, bs, ok); err != nil {
+				if err := terminalio.WriteFile(op, config.Filepath, bs, ok); err != nil {
 					return err
 				}
 			} else {
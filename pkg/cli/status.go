@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+type statusCommand struct {
+	*commandBase
+}
+
+func NewStatusCommand() *statusCommand {
+	name := "status"
+	desc := `
+	Walks the dotfiles directory and reports how each dotfile is wired into userspace. Once the
+	manifest 'dotf.toml' records the paths managed in a dotfiles directory, only those are walked. Every entry is put into
+	one of the following groups:
+
+	- installed:        The symlink in userspace points to the dotfile.
+	- missing:          No file exists in userspace. Use 'install' to create the symlink.
+	- conflicting:      A regular file or directory is in the way in userspace.
+	- foreign symlink:  The symlink in userspace points to some other file.
+	- dangling:         The symlink in userspace points to a file that does not exist.
+	- drifted:          The file rendered from a template differs from what the template renders
+	                    now, either because the file or the template and its variables changed.
+	- modified:         The copy in userspace was changed after the dotfile. 'sync' copies it back.
+	- outdated:         The dotfile was changed after its copy in userspace. 'sync' or 'install'
+	                    copies it into userspace.
+
+	Directories that exist as regular directories both in dotfiles and in userspace are not reported
+	themselves, only their contents are. Templates, files ending with '.dotftmpl', are installed if
+	the file in userspace equals the rendered template. Secrets, files ending with '.dotfsecret', are
+	installed if a regular file is found in userspace. Dotfiles with the install mode 'copy' in the
+	manifest are installed if the copy in userspace equals the dotfile.
+
+	If 'layers' is set in the configuration, every dotfile is reported from the most specific layer
+	containing it and the name of the layer is shown next to it.`
+
+	return &statusCommand{
+		&commandBase{
+			Name:        name,
+			Overview:    "Show how every dotfile is wired into userspace.",
+			Usage:       name + " [--help]",
+			Args:        []arg{},
+			Flags:       []*parsing.Flag{},
+			Description: desc,
+		},
+	}
+}
+
+func (c *statusCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	layers := conf.DotfilesLayers()
+	statuses, err := terminalio.GetLayeredDotfilesStatus(conf.UserspaceDir, layers, op.Ignore(), op.Manifest())
+	if err != nil {
+		return err
+	}
+
+	printStatus(statuses, layers)
+	return nil
+}
+
+// Order and color in which the groups of the status report are printed.
+var statusGroups = []struct {
+	state terminalio.DotfileState
+	color logging.TerminalColor
+}{
+	{terminalio.StateInstalled, logging.Green},
+	{terminalio.StateMissing, logging.Yellow},
+	{terminalio.StateConflicting, logging.Red},
+	{terminalio.StateForeignSymlink, logging.Yellow},
+	{terminalio.StateDangling, logging.Red},
+	{terminalio.StateDrifted, logging.Yellow},
+	{terminalio.StateModified, logging.Yellow},
+	{terminalio.StateOutdated, logging.Yellow},
+}
+
+// Prints the statuses grouped by state with paths shown relative to the layer containing them. The
+// layer is shown as well if there is more than one.
+func printStatus(statuses []*terminalio.DotfileStatus, layers terminalio.Layers) {
+	grouped := make(map[terminalio.DotfileState][]*terminalio.DotfileStatus)
+	for _, s := range statuses {
+		grouped[s.State] = append(grouped[s.State], s)
+	}
+
+	for _, g := range statusGroups {
+		entries := grouped[g.state]
+		if len(entries) == 0 {
+			continue
+		}
+
+		header := fmt.Sprintf("%s (%d):", g.state, len(entries))
+		fmt.Println(logging.Color(header, g.color))
+
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 4, ' ', 0)
+
+		for _, s := range entries {
+			rel, err := filepath.Rel(s.Layer, s.DotfilesFile)
+			if err != nil {
+				rel = s.DotfilesFile
+			}
+
+			name := logging.Color(rel, g.color)
+			if len(layers) > 1 {
+				name += "\t[" + filepath.Base(s.Layer) + "]"
+			}
+
+			if s.LinkTarget != "" {
+				fmt.Fprintf(w, "\t%s\t-> %s\n", name, s.LinkTarget)
+			} else {
+				fmt.Fprintf(w, "\t%s\t%s\n", name, s.UserspaceFile)
+			}
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
+	if len(statuses) == 0 {
+		logging.Info("No dotfiles found in", strings.Join(layers, ", "))
+	}
+}
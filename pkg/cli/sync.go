@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"fmt"
+
 	"github.com/mortenskoett/dotf-go/pkg/parsing"
 	"github.com/mortenskoett/dotf-go/pkg/terminalio"
 )
@@ -13,27 +15,81 @@ func NewSyncCommand() *syncCommand {
 	name := "sync"
 	desc := `
 	Uses local git instance to merge newest changes from git remote and then adds, commits and
-	pushes latest changes to remote.`
+	pushes latest changes to remote.
+
+	Remote changes are integrated using the strategy configured by 'syncstrategy' or given by
+	--strategy. The merge strategy creates a merge commit when both local and remote have new
+	commits. The rebase strategy replays local commits on top of the remote and keeps the history
+	linear.
+
+	If files conflict the merge is aborted and the conflicting files are listed together with their
+	location in userspace. Sync again with '--resolve ours' to keep the local version or with
+	'--resolve theirs' to keep the remote version of every conflicting file. Conflicts left by an
+	earlier merge are resolved the same way. A rebase stopped by conflicts is aborted unless they
+	are resolved.
+
+	Nothing is committed if a changed file is a plaintext copy of a secret, i.e. a file next to one
+	with the same name ending in '.dotfsecret'.
+
+	Dotfiles with the install mode 'copy' in the manifest are synced with their copies in
+	userspace. Copies changed in userspace are copied into dotfiles before committing, and dotfiles
+	changed after their copy, e.g. by the remote, are copied into userspace afterwards. The replaced
+	files are backed up.`
 
 	return &syncCommand{
 		&commandBase{
-			Name:        name,
-			Overview:    "Sync with remote using merge strategy.",
-			Usage:       name + " [--help]",
-			Args:        []arg{},
-			Flags:       []*parsing.Flag{},
+			Name:     name,
+			Overview: "Sync with remote using merge or rebase strategy.",
+			Usage:    name + " [--<flags>] [--help]",
+			Args:     []arg{},
+			Flags: []*parsing.Flag{
+				parsing.NewValueFlag(FlagResolve, "Resolve conflicting files by keeping either our or their version.", "ours|theirs"),
+				parsing.NewValueFlag(FlagStrategy, "Strategy used to integrate remote changes.", "merge|rebase"),
+			},
 			Description: desc,
 		},
 	}
 }
 
-func (c *syncCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration) error {
+func (c *syncCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
 	absDotfilesDir, err := terminalio.GetAndValidateAbsolutePath(conf.SyncDir)
 	if err != nil {
 		return err
 	}
 
-	if err := terminalio.SyncLocalRemote(absDotfilesDir); err != nil {
+	opts := conf.SyncOptions()
+
+	for _, f := range c.Flags {
+		switch f.Name {
+		case FlagResolve:
+			if args.Flags.Exists(f) {
+				value, err := args.Flags.Get(f)
+				if err != nil {
+					return err
+				}
+				resolution := terminalio.ConflictResolution(value)
+				if resolution != terminalio.ResolveOurs && resolution != terminalio.ResolveTheirs {
+					return &ErrCmdArgument{fmt.Sprintf("--%s must be either '%s' or '%s'.",
+						FlagResolve, terminalio.ResolveOurs, terminalio.ResolveTheirs)}
+				}
+				opts.Resolve = resolution
+			}
+		case FlagStrategy:
+			if args.Flags.Exists(f) {
+				value, err := args.Flags.Get(f)
+				if err != nil {
+					return err
+				}
+				strategy, err := terminalio.GetSyncStrategy(value)
+				if err != nil {
+					return &ErrCmdArgument{err.Error()}
+				}
+				opts.Strategy = strategy
+			}
+		}
+	}
+
+	if err := terminalio.SyncLocalRemote(op, absDotfilesDir, opts); err != nil {
 		return &ErrGit{Path: absDotfilesDir, Err: err}
 	}
 
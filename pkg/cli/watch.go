@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+)
+
+type watchCommand struct {
+	*commandBase
+}
+
+func NewWatchCommand() *watchCommand {
+	name := "watch"
+	desc := `
+	Watches the symlinks in userspace pointing to dotfiles and reports when another application
+	replaces one of them by a regular file or deletes it. This happens e.g. when an editor saves a
+	file by replacing it or when an application rewrites its own configuration. The command runs
+	until it is interrupted.
+
+	If the '--adopt' flag is given or 'autoadopt' is set to true in the configuration, a file that
+	replaced a symlink is adopted right away. Adopting moves the file into dotfiles in place of the
+	dotfile, which is backed up first, and restores the symlink. Deleted symlinks are only reported
+	and can be restored using 'dotf install'. Use 'dotf diff' to review a replaced file before
+	adopting it.
+
+	Only symlinks installed when the command is started are watched. dotf-tray watches the symlinks
+	in the same way while it is running.`
+
+	return &watchCommand{
+		&commandBase{
+			Name:     name,
+			Overview: "Report symlinks to dotfiles replaced or deleted by other applications.",
+			Usage:    name + " [--adopt] [--help]",
+			Args:     []arg{},
+			Flags: []*parsing.Flag{
+				parsing.NewFlag(FlagAdopt, "Adopt files replacing symlinks into dotfiles right away."),
+			},
+			Description: desc,
+		},
+	}
+}
+
+func (c *watchCommand) Run(args *parsing.CommandlineInput, conf *parsing.DotfConfiguration, op *terminalio.Operation) error {
+	adopt := conf.AutoAdopt
+	for _, f := range c.Flags {
+		switch f.Name {
+		case FlagAdopt:
+			if args.Flags.Exists(f) {
+				adopt = true
+			}
+		}
+	}
+
+	watcher, err := terminalio.NewSymlinkWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	count, err := watcher.Watch(conf.UserspaceDir, conf.DotfilesLayers(), op.Ignore())
+	if err != nil {
+		return err
+	}
+	logging.Info(fmt.Sprintf("Watching %d symlinks to dotfiles. Press Ctrl+C to stop.", count))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logging.Info("Stopped watching")
+			return nil
+		case err := <-watcher.Errors():
+			logging.Error(err)
+		case e := <-watcher.Events():
+			if err := handleClobberEvent(op, e, adopt); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Reports a clobbered symlink and adopts the file that replaced it if 'adopt' is true. Each
+// adoption is committed, so it is kept even if a later one fails.
+func handleClobberEvent(op *terminalio.Operation, e *terminalio.ClobberEvent, adopt bool) error {
+	logging.Warn(fmt.Sprintf("Symlink to dotfile %s: %s", e.Kind, logging.Color(e.UserspaceFile, logging.Green)))
+
+	if e.Kind != terminalio.ClobberReplaced {
+		logging.Info("Run 'dotf install", e.UserspaceFile+"' to restore it.")
+		return nil
+	}
+	if !adopt {
+		logging.Info("Run 'dotf diff", e.UserspaceFile+"' to review and adopt it.")
+		return nil
+	}
+
+	d := &terminalio.DotfileDiff{DotfilesFile: e.DotfilesFile, UserspaceFile: e.UserspaceFile}
+	if err := terminalio.AdoptDotfile(op, d); err != nil {
+		return err
+	}
+	op.Commit()
+	logging.Ok("Adopted", e.UserspaceFile, "into", e.DotfilesFile)
+	return nil
+}
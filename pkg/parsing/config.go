@@ -1,19 +1,17 @@
 /*
 Package config contains functionality relating to the configuration file of dotf.
-The parser is inspired by the TOML layout. See https://toml.io/en/ for format details.
-Only a microscopic subset of the TOML v1.0.0 specification is implemented.
+The configuration file is written in TOML. See https://toml.io/en/ for format details.
 */
 package parsing
 
 import (
-	"bufio"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/mortenskoett/dotf-go/pkg/logging"
 	"github.com/mortenskoett/dotf-go/pkg/terminalio"
@@ -32,6 +30,10 @@ var (
 	defaultSyncDir     = homedir + "/dotfiles"
 	defaultDistrosDir  = defaultSyncDir + "/distros"
 	defaultDotfilesDir = defaultSyncDir + "/" + hostname
+	defaultBackupDir   = homedir + "/.local/share/dotf/backups"
+	defaultKeyFile     = configdir + "/dotf/key"
+
+	defaultHookTimeoutSecs = int(terminalio.DefaultHookTimeout / time.Second)
 )
 
 // Configurations that will be parsed from the config file
@@ -42,6 +44,22 @@ const (
 	syncdir          = "syncdir"
 	autosync         = "autosync"
 	syncintervalsecs = "syncintervalsecs"
+	backupdir        = "backupdir"
+	remote           = "remote"
+	branch           = "branch"
+	committemplate   = "committemplate"
+	syncstrategy     = "syncstrategy"
+	layers           = "layers"
+	keyfile          = "keyfile"
+	hooksdir         = "hooksdir"
+	hooktimeoutsecs  = "hooktimeoutsecs"
+	autoadopt        = "autoadopt"
+	relativesymlinks = "relativesymlinks"
+)
+
+// Keys of configurations that can be changed by dotf commands
+const (
+	KeyDotfilesDir = dotfilesdir
 )
 
 // Configurations that are required for dotf to function properly
@@ -53,6 +71,17 @@ var (
 		syncdir:          true,
 		autosync:         false,
 		syncintervalsecs: true,
+		backupdir:        false,
+		remote:           false,
+		branch:           false,
+		committemplate:   false,
+		syncstrategy:     false,
+		layers:           false,
+		keyfile:          false,
+		hooksdir:         false,
+		hooktimeoutsecs:  false,
+		autoadopt:        false,
+		relativesymlinks: false,
 	}
 )
 
@@ -62,12 +91,23 @@ type ConfigMetadata struct {
 
 type DotfConfiguration struct {
 	*ConfigMetadata
-	UserspaceDir     string `json:"userspacedir"`     // Userspace dir is the root of the file hierachy dotf replicates
-	DistrosDir       string `json:"distrosdir"`       // Directory where the different distributions are placed
-	DotfilesDir      string `json:"dotfilesdir"`      // Directory inside SyncDir containing same structure as userspace dir
-	SyncDir          string `json:"syncdir"`          // Git initialized directory that dotf should sync with remote
-	AutoSync         bool   `json:"autosync"`         // If dotf-tray should autosync at given interval
-	SyncIntervalSecs int    `json:"syncintervalsecs"` // Interval between syncing with remote using dotf-tray application
+	UserspaceDir     string   `json:"userspacedir"`     // Userspace dir is the root of the file hierachy dotf replicates
+	DistrosDir       string   `json:"distrosdir"`       // Directory where the different distributions are placed
+	DotfilesDir      string   `json:"dotfilesdir"`      // Directory inside SyncDir containing same structure as userspace dir
+	SyncDir          string   `json:"syncdir"`          // Git initialized directory that dotf should sync with remote
+	AutoSync         bool     `json:"autosync"`         // If dotf-tray should autosync at given interval
+	SyncIntervalSecs int      `json:"syncintervalsecs"` // Interval between syncing with remote using dotf-tray application
+	BackupDir        string   `json:"backupdir"`        // Directory where backups of overwritten files are kept
+	Remote           string   `json:"remote"`           // Git remote to sync with. Detected from upstream if empty
+	Branch           string   `json:"branch"`           // Branch on the remote to sync with. Detected from upstream if empty
+	CommitTemplate   string   `json:"committemplate"`   // Go template for commit messages made by sync. Default if empty
+	SyncStrategy     string   `json:"syncstrategy"`     // How remote changes are integrated when syncing, merge or rebase
+	Layers           []string `json:"layers"`           // Distributions in DistrosDir installed beneath DotfilesDir, least specific first
+	KeyFile          string   `json:"keyfile"`          // Key used to encrypt secrets. Must never be synced.
+	HooksDir         string   `json:"hooksdir"`         // Directory of hooks run around commands. <SyncDir>/hooks if empty
+	HookTimeoutSecs  int      `json:"hooktimeoutsecs"`  // How long a hook may run before it is killed
+	AutoAdopt        bool     `json:"autoadopt"`        // If files replacing symlinks to dotfiles are adopted when watching
+	RelativeSymlinks bool     `json:"relativesymlinks"` // If symlinks in userspace point to dotfiles using relative paths
 }
 
 /* Creates a basic sensible Configuration with default values. */
@@ -80,6 +120,10 @@ func NewSensibleConfiguration() *DotfConfiguration {
 		SyncDir:          defaultSyncDir,
 		AutoSync:         false,
 		SyncIntervalSecs: 3600,
+		BackupDir:        defaultBackupDir,
+		SyncStrategy:     "merge",
+		KeyFile:          defaultKeyFile,
+		HookTimeoutSecs:  defaultHookTimeoutSecs,
 	}
 }
 
@@ -92,7 +136,100 @@ func NewEmptyConfiguration() *DotfConfiguration {
 		SyncDir:          "",
 		AutoSync:         false,
 		SyncIntervalSecs: 3600,
+		BackupDir:        defaultBackupDir,
+		SyncStrategy:     "merge",
+		KeyFile:          defaultKeyFile,
+		HookTimeoutSecs:  defaultHookTimeoutSecs,
+	}
+}
+
+// Returns the options used when syncing with the git remote.
+func (c *DotfConfiguration) SyncOptions() terminalio.SyncOptions {
+	opts := terminalio.SyncOptions{
+		Remote:         c.Remote,
+		Branch:         c.Branch,
+		DotfilesDir:    c.DotfilesDir,
+		UserspaceDir:   c.UserspaceDir,
+		CommitTemplate: c.CommitTemplate,
+		Layers:         c.DotfilesLayers(),
+	}
+
+	// The name is validated when the configuration is parsed
+	if strategy, err := terminalio.GetSyncStrategy(c.SyncStrategy); err == nil {
+		opts.Strategy = strategy
+	}
+	return opts
+}
+
+// Returns the options used to run hooks around commands. Hooks are found in 'hooks' inside SyncDir
+// unless HooksDir is set.
+func (c *DotfConfiguration) HookOptions() terminalio.HookOptions {
+	dir := c.HooksDir
+	if dir == "" && c.SyncDir != "" {
+		dir = filepath.Join(c.SyncDir, "hooks")
+	}
+
+	return terminalio.HookOptions{
+		Dir:          dir,
+		Timeout:      time.Duration(c.HookTimeoutSecs) * time.Second,
+		UserspaceDir: c.UserspaceDir,
+		DotfilesDir:  c.DotfilesDir,
+		SyncDir:      c.SyncDir,
+	}
+}
+
+// Returns the paths ignored by dotf. Hooks and the manifest are never treated as dotfiles, even if
+// placed in the dotfiles directory.
+func (c *DotfConfiguration) IgnoreMatcher() (*terminalio.IgnoreMatcher, error) {
+	ignore, err := terminalio.LoadIgnoreMatcher(c.SyncDir, c.UserspaceDir, c.DotfilesLayers())
+	if err != nil {
+		return nil, err
+	}
+	ignore.Exclude(c.HookOptions().Dir, filepath.Join(c.SyncDir, terminalio.ManifestName))
+	return ignore, nil
+}
+
+// Returns the options of operations changing files. The ignore files and the manifest are left out,
+// as they are loaded by NewOperation.
+func (c *DotfConfiguration) OperationOptions(dryRun bool) terminalio.OperationOptions {
+	return terminalio.OperationOptions{
+		BackupDir:        c.BackupDir,
+		DryRun:           dryRun,
+		KeyFile:          c.KeyFile,
+		RelativeSymlinks: c.RelativeSymlinks,
+	}
+}
+
+// Returns an operation named 'name' changing files as configured, using the ignore files and the
+// manifest found in SyncDir. Nothing is changed if 'dryRun' is true.
+func (c *DotfConfiguration) NewOperation(name string, dryRun bool) (*terminalio.Operation, error) {
+	ignore, err := c.IgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := terminalio.LoadManifest(c.SyncDir)
+	if err != nil {
+		return nil, err
 	}
+
+	opts := c.OperationOptions(dryRun)
+	opts.Ignore = ignore
+	opts.Manifest = manifest
+	return terminalio.NewOperation(name, opts), nil
+}
+
+// Returns the dotfiles directories that are installed into userspace ordered from the least to the
+// most specific layer. The configured layers are found in DistrosDir and DotfilesDir is always the
+// most specific layer.
+func (c *DotfConfiguration) DotfilesLayers() terminalio.Layers {
+	var dirs terminalio.Layers
+	for _, name := range c.Layers {
+		dir := filepath.Join(c.DistrosDir, name)
+		if dir != filepath.Clean(c.DotfilesDir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, c.DotfilesDir)
 }
 
 // Convert a configuration to a map, used for easier serialization of configuration
@@ -134,6 +271,14 @@ func ConvertConfigToMap(conf *DotfConfiguration) (map[string]string, error) {
 		case float64:
 			s := fmt.Sprintf("%d", int(t))
 			strmap[k] = s
+		case []any:
+			items := make([]string, 0, len(t))
+			for _, item := range t {
+				items = append(items, fmt.Sprint(item))
+			}
+			strmap[k] = strings.Join(items, ", ")
+		case nil:
+			strmap[k] = ""
 		default:
 			strmap[k] = v.(string)
 		}
@@ -141,25 +286,6 @@ func ConvertConfigToMap(conf *DotfConfiguration) (map[string]string, error) {
 	return strmap, nil
 }
 
-// Creates a slice of bytes that can be serialized to a file and used as a valid config
-func CreateSerializableConfig(keyvals map[string]string) []byte {
-	var builder strings.Builder
-	for k, v := range keyvals {
-		builder.WriteString(k)
-		builder.WriteString(" = ")
-		builder.WriteString(v)
-		builder.WriteString("\n")
-	}
-	return []byte(builder.String())
-}
-
-/*
-* Config format:
-* key0 = value0
-* key1 = value1
-* # is a comment
- */
-
 // Parses the required dotf configuration file. Tries the given paths in order or otherwise
 // fallbacks to default config location.
 func ParseConfig(paths ...string) (*DotfConfiguration, error) {
@@ -206,22 +332,16 @@ func parseConfig(path string) (*DotfConfiguration, error) {
 		return nil, err
 	}
 
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	keysToValues, err := parseTOMLFile(file)
+	values, err := readConfigFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = validateKeys(keysToValues, requiredConfigKeys); err != nil {
+	if err = validateKeys(values, requiredConfigKeys); err != nil {
 		return config, err
 	}
 
-	err = buildConfiguration(config, keysToValues)
+	err = buildConfiguration(config, values)
 	if err != nil {
 		return config, err
 	}
@@ -241,10 +361,10 @@ func containsString(sl []string, str string) bool {
 }
 
 // Validate key values for required but potentially missing keys
-func validateKeys(keysToValues map[string]string, requiredConfigKeys map[string]bool) error {
+func validateKeys(values map[string]configValue, requiredConfigKeys map[string]bool) error {
 	for key, isRequired := range requiredConfigKeys {
 		if isRequired {
-			_, exists := keysToValues[key]
+			_, exists := values[key]
 			if !exists {
 				return &ConfigKeyNotFoundError{fmt.Sprint("missing key in configuration: ", key)}
 			}
@@ -253,78 +373,92 @@ func validateKeys(keysToValues map[string]string, requiredConfigKeys map[string]
 	return nil
 }
 
-/* parseTOMLFile parses the file found at 'file' and returns a key,value representation. */
-func parseTOMLFile(file *os.File) (map[string]string, error) {
-	parameterToValue := make(map[string]string)
-
-	scanner := bufio.NewScanner(file)
-	linenum := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		nameAndValue := strings.SplitN(line, "=", 2)
-		linenum++
-
-		if strings.HasPrefix(nameAndValue[0], "#") {
-			// Ignore outcommented lines.
-			continue
-		}
-
-		// Didn't get both key and value
-		if len(nameAndValue) < 2 {
-			return nil, errors.New(
-				fmt.Sprintf(
-					"malformed key in configuration on line number: %d: %s",
-					linenum,
-					nameAndValue[0]))
-		}
-
-		parameter := strings.ToLower(strings.TrimFunc(nameAndValue[0], sanitize))
-		value := strings.TrimFunc(nameAndValue[1], sanitize)
-		parameterToValue[parameter] = value
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
-	return parameterToValue, nil
-}
-
-func sanitize(r rune) bool {
-	return r == ' ' ||
-		r == '\t' ||
-		r == '\n' ||
-		r == '\r' ||
-		r == '"'
-}
-
-func buildConfiguration(config *DotfConfiguration, keyToValue map[string]string) error {
-	for k, v := range keyToValue {
+func buildConfiguration(config *DotfConfiguration, values map[string]configValue) error {
+	for k, v := range values {
+		var err error
 		switch k {
 		case userspacedir:
-			config.UserspaceDir = expandTilde(v)
+			config.UserspaceDir, err = v.path()
 		case distrosdir:
-			config.DistrosDir = expandTilde(v)
+			config.DistrosDir, err = v.path()
 		case dotfilesdir:
-			config.DotfilesDir = expandTilde(v)
+			config.DotfilesDir, err = v.path()
 		case syncdir:
-			config.SyncDir = expandTilde(v)
+			config.SyncDir, err = v.path()
 		case syncintervalsecs:
-			if v_num, err := strconv.Atoi(v); err != nil {
-				return err
-			} else {
-				config.SyncIntervalSecs = v_num
-			}
+			config.SyncIntervalSecs, err = v.integer()
 		case autosync:
-			config.AutoSync = true
+			config.AutoSync, err = v.boolean()
+		case backupdir:
+			config.BackupDir, err = v.path()
+		case remote:
+			config.Remote, err = v.str()
+		case branch:
+			config.Branch, err = v.str()
+		case committemplate:
+			config.CommitTemplate, err = v.str()
+			if err == nil {
+				if _, perr := template.New(k).Parse(config.CommitTemplate); perr != nil {
+					err = v.malformed("invalid commit template: ", perr)
+				}
+			}
+		case syncstrategy:
+			config.SyncStrategy, err = v.str()
+			if err == nil {
+				if _, serr := terminalio.GetSyncStrategy(config.SyncStrategy); serr != nil {
+					err = v.malformed("invalid sync strategy: ", serr)
+				}
+			}
+		case keyfile:
+			config.KeyFile, err = v.path()
+		case hooksdir:
+			config.HooksDir, err = v.path()
+		case hooktimeoutsecs:
+			config.HookTimeoutSecs, err = v.integer()
+			if err == nil && config.HookTimeoutSecs <= 0 {
+				err = v.malformed(hooktimeoutsecs, " must be a positive number of seconds: ", v.value)
+			}
+		case autoadopt:
+			config.AutoAdopt, err = v.boolean()
+		case relativesymlinks:
+			config.RelativeSymlinks, err = v.boolean()
+		case layers:
+			config.Layers, err = parseLayers(v)
 		default:
-			return &MalformedConfigurationError{fmt.Sprint(
-				"malformed or unknown key encountered: ", k)}
+			err = v.malformed("malformed or unknown key encountered: ", k)
+		}
+		if err != nil {
+			return err
 		}
 	}
+
+	if len(config.Layers) > 0 && config.DistrosDir == "" {
+		return &MalformedConfigurationError{message: fmt.Sprint(layers, " requires ", distrosdir, " to be set")}
+	}
 	return nil
 }
 
+// Parses the names of distributions used as layers.
+func parseLayers(v configValue) ([]string, error) {
+	items, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range items {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if strings.ContainsRune(name, filepath.Separator) || name == "." || name == ".." {
+			return nil, v.malformed("invalid layer: ", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
 func expandTilde(path string) string {
 	if strings.HasPrefix(path, "~/") {
 		dirname, _ := os.UserHomeDir()
@@ -2,10 +2,14 @@ package parsing_test
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mortenskoett/dotf-go/pkg/parsing"
+	"github.com/mortenskoett/dotf-go/pkg/terminalio"
+	"github.com/mortenskoett/dotf-go/pkg/test"
 )
 
 func Test_NewConfigMap_returns_valid_map_configuration(t *testing.T) {
@@ -22,7 +26,7 @@ func Test_CreateSerializableConfig_returns_valid_config_as_bytes(t *testing.T) {
 		"key2": "value2",
 	}
 
-	expected := fmt.Sprintf("key1 = value1\nkey2 = value2\n")
+	expected := fmt.Sprintf("key1 = \"value1\"\nkey2 = \"value2\"\n")
 
 	bs := parsing.CreateSerializableConfig(testinput)
 	s := string(bs)
@@ -32,3 +36,249 @@ func Test_CreateSerializableConfig_returns_valid_config_as_bytes(t *testing.T) {
 		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
 	}
 }
+
+func Test_CreateSerializableConfig_places_keys_in_sorted_sections(t *testing.T) {
+	testinput := map[string]string{
+		"userspacedir": "~/",
+		"syncdir":      "~/dotfiles",
+		"autosync":     "false",
+		"layers":       "common, work",
+		"backupdir":    "~/backups",
+		"keyfile":      "~/key",
+	}
+
+	expected := `keyfile = "~/key"
+userspacedir = "~/"
+
+[backup]
+dir = "~/backups"
+
+[distros]
+layers = ["common", "work"]
+
+[sync]
+autosync = false
+dir = "~/dotfiles"
+`
+
+	s := string(parsing.CreateSerializableConfig(testinput))
+
+	diff := cmp.Diff(s, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
+	}
+}
+
+func Test_CreateSerializableConfig_can_be_parsed(t *testing.T) {
+	conf := parsing.NewSensibleConfiguration()
+	conf.CommitTemplate = "{{.Command}} on {{.Host}}\n\n{{.Summary}}"
+	conf.DistrosDir = "/dotfiles/distros"
+	conf.Layers = []string{"common", "work"}
+	conf.AutoSync = true
+
+	cmap, err := parsing.ConvertConfigToMap(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Filepath = writeConfig(t, string(parsing.CreateSerializableConfig(cmap)))
+
+	actual, err := parsing.ParseConfig(conf.Filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := cmp.Diff(actual, conf)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", actual, conf, diff)
+	}
+}
+
+func Test_ParseConfig_reads_sections(t *testing.T) {
+	path := writeConfig(t, `# dotf configuration
+userspacedir = "/home/user"
+
+[sync]
+dir = "/home/user/dotfiles"   # the git repository
+autosync = false
+intervalsecs = 1200
+strategy = "rebase"
+
+[distros]
+dir = "/home/user/dotfiles/distros"
+dotfilesdir = "/home/user/dotfiles/distros/laptop"
+layers = [
+	"common",
+	"work",
+]
+
+[hooks]
+timeoutsecs = 10
+`)
+
+	conf, err := parsing.ParseConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEqual("/home/user/dotfiles", conf.SyncDir, t)
+	test.AssertEqual(false, conf.AutoSync, t)
+	test.AssertEqual(1200, conf.SyncIntervalSecs, t)
+	test.AssertEqual("rebase", conf.SyncStrategy, t)
+	test.AssertEqual("/home/user/dotfiles/distros/laptop", conf.DotfilesDir, t)
+	test.AssertEqual([]string{"common", "work"}, conf.Layers, t)
+	test.AssertEqual(10, conf.HookTimeoutSecs, t)
+}
+
+func Test_ParseConfig_reads_old_flat_format(t *testing.T) {
+	path := writeConfig(t, `userspacedir = /home/user
+DotfilesDir = /home/user/dotfiles/laptop
+syncdir = /home/user/dotfiles
+autosync = false
+syncintervalsecs = 600
+committemplate = dotf {{.Command}}\n\n{{.Summary}}
+`)
+
+	conf, err := parsing.ParseConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEqual("/home/user/dotfiles/laptop", conf.DotfilesDir, t)
+	test.AssertEqual(false, conf.AutoSync, t)
+	test.AssertEqual(600, conf.SyncIntervalSecs, t)
+	test.AssertEqual("dotf {{.Command}}\n\n{{.Summary}}", conf.CommitTemplate, t)
+}
+
+func Test_SetConfigValue_replaces_key_inside_section(t *testing.T) {
+	contents := "userspacedir = \"~/\"\n\n[distros]\n  dotfilesdir = \"~/dotfiles/laptop\" # current\nlayers = []\n\n[sync]\ndir = \"~/dotfiles\"\n"
+
+	expected := "userspacedir = \"~/\"\n\n[distros]\n  dotfilesdir = \"/dotfiles/distros/server\" # current\nlayers = []\n\n[sync]\ndir = \"~/dotfiles\"\n"
+
+	s := string(parsing.SetConfigValue([]byte(contents), "dotfilesdir", "/dotfiles/distros/server"))
+
+	diff := cmp.Diff(s, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
+	}
+}
+
+func Test_SetConfigValue_keeps_inline_comment(t *testing.T) {
+	contents := "[distros]\ndotfilesdir = \"~/dotfiles/#laptop\"   # was 'server' # before\n\n[sync]\ndir = '~/dot#files' # synced\n"
+
+	expected := "[distros]\ndotfilesdir = \"/dotfiles\"   # was 'server' # before\n\n[sync]\ndir = \"/sync\" # synced\n"
+
+	s := parsing.SetConfigValue([]byte(contents), "dotfilesdir", "/dotfiles")
+	s = parsing.SetConfigValue(s, "syncdir", "/sync")
+
+	diff := cmp.Diff(string(s), expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", string(s), expected, diff)
+	}
+}
+
+func Test_SetConfigValue_adds_missing_key_to_its_section(t *testing.T) {
+	contents := "userspacedir = \"~/\"\n\n[distros]\ndir = \"~/dotfiles/distros\"\n\n[sync]\ndir = \"~/dotfiles\"\n"
+
+	expected := "userspacedir = \"~/\"\n\n[distros]\ndir = \"~/dotfiles/distros\"\ndotfilesdir = \"/dotfiles\"\n\n[sync]\ndir = \"~/dotfiles\"\n"
+
+	s := string(parsing.SetConfigValue([]byte(contents), "dotfilesdir", "/dotfiles"))
+
+	diff := cmp.Diff(s, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
+	}
+
+	// Keys without a section are added before the first section
+	expected = "userspacedir = \"~/\"\nkeyfile = \"/key\"\n\n[distros]\ndir = \"~/dotfiles/distros\"\n\n[sync]\ndir = \"~/dotfiles\"\n"
+
+	s = string(parsing.SetConfigValue([]byte(contents), "keyfile", "/key"))
+
+	diff = cmp.Diff(s, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
+	}
+}
+
+func Test_SetConfigValue_replaces_existing_key_and_keeps_other_lines(t *testing.T) {
+	contents := "# my config\nuserspacedir = ~/\nDotfilesDir = ~/dotfiles/laptop\nsyncdir = ~/dotfiles\n"
+
+	expected := "# my config\nuserspacedir = ~/\ndotfilesdir = ~/dotfiles/distros/server\nsyncdir = ~/dotfiles\n"
+
+	s := string(parsing.SetConfigValue([]byte(contents), "dotfilesdir", "~/dotfiles/distros/server"))
+
+	diff := cmp.Diff(s, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
+	}
+}
+
+func Test_SetConfigValue_appends_missing_key(t *testing.T) {
+	expected := "userspacedir = ~/\ndotfilesdir = /dotfiles\n"
+
+	s := string(parsing.SetConfigValue([]byte("userspacedir = ~/"), "dotfilesdir", "/dotfiles"))
+
+	diff := cmp.Diff(s, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", s, expected, diff)
+	}
+}
+
+func Test_DotfilesLayers_puts_dotfiles_dir_last(t *testing.T) {
+	conf := parsing.NewEmptyConfiguration()
+	conf.DistrosDir = "/dotfiles/distros"
+	conf.DotfilesDir = "/dotfiles/distros/host"
+	conf.Layers = []string{"common", "host", "work"}
+
+	expected := terminalio.Layers{"/dotfiles/distros/common", "/dotfiles/distros/work", "/dotfiles/distros/host"}
+	actual := conf.DotfilesLayers()
+
+	diff := cmp.Diff(actual, expected)
+	if diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %+v", actual, expected, diff)
+	}
+}
+
+func Test_NewOperation_loads_ignore_files_and_manifest(t *testing.T) {
+	syncDir := t.TempDir()
+	conf := parsing.NewEmptyConfiguration()
+	conf.SyncDir = syncDir
+	conf.DotfilesDir = syncDir
+	conf.UserspaceDir = t.TempDir()
+
+	manifest := "[files.\".zshrc\"]\nmode = \"copy\"\n"
+	if err := os.WriteFile(filepath.Join(syncDir, terminalio.ManifestName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := conf.NewOperation("test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !op.DryRun() {
+		t.Error("expected a dry-run operation")
+	}
+	test.AssertEqual(terminalio.ModeCopy, op.Manifest().Mode(syncDir, ".zshrc"), t)
+
+	// Hooks and the manifest are never dotfiles
+	for _, p := range []string{filepath.Join(syncDir, "hooks"), filepath.Join(syncDir, terminalio.ManifestName)} {
+		if !op.Ignore().Match(p, false) {
+			t.Errorf("expected %s to be ignored", p)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(syncDir, terminalio.ManifestName), []byte("[files\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conf.NewOperation("test", true); err == nil {
+		test.FailHard(err, &terminalio.ErrMalformedManifest{}, t)
+	}
+}
+
+// Writes 'contents' to a configuration file and returns the path to it.
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,494 @@
+package parsing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+/*
+* Config format:
+*
+* userspacedir = "~/"
+*
+* [sync]
+* dir = "~/dotfiles"
+* autosync = false  # comments are allowed anywhere
+*
+* [distros]
+* layers = ["common", "work"]
+*
+* Configuration files written before sections were supported are read as well. They set every
+* configuration at the top of the file using its full name and the values are not quoted:
+*
+* userspacedir = ~/
+* syncdir = ~/dotfiles
+ */
+
+// Location of a configuration inside a section of the configuration file
+type sectionKey struct {
+	section string
+	name    string
+}
+
+// Where configurations are placed in the sections of the configuration file. Configurations not
+// found here are set at the top of the file. Every configuration can also be set at the top of the
+// file using its full name.
+var sectionKeys = map[string]sectionKey{
+	syncdir:          {"sync", "dir"},
+	autosync:         {"sync", "autosync"},
+	syncintervalsecs: {"sync", "intervalsecs"},
+	remote:           {"sync", "remote"},
+	branch:           {"sync", "branch"},
+	committemplate:   {"sync", "committemplate"},
+	syncstrategy:     {"sync", "strategy"},
+	backupdir:        {"backup", "dir"},
+	distrosdir:       {"distros", "dir"},
+	dotfilesdir:      {"distros", "dotfilesdir"},
+	layers:           {"distros", "layers"},
+	hooksdir:         {"hooks", "dir"},
+	hooktimeoutsecs:  {"hooks", "timeoutsecs"},
+}
+
+// Configurations that are not strings
+var (
+	boolConfigKeys = map[string]bool{autosync: true, autoadopt: true, relativesymlinks: true}
+	intConfigKeys  = map[string]bool{syncintervalsecs: true, hooktimeoutsecs: true}
+	listConfigKeys = map[string]bool{layers: true}
+)
+
+// A configuration value together with where it was set in the configuration file
+type configValue struct {
+	key    string
+	value  any // Values read from the old flat format are always strings
+	line   int
+	column int
+}
+
+// Returns an error describing what is wrong with the value at the position of the value.
+func (v configValue) malformed(a ...any) error {
+	return &MalformedConfigurationError{message: fmt.Sprint(a...), Line: v.line, Column: v.column}
+}
+
+func (v configValue) str() (string, error) {
+	if s, ok := v.value.(string); ok {
+		return s, nil
+	}
+	return "", v.malformed(v.key, " must be a string: ", v.value)
+}
+
+func (v configValue) path() (string, error) {
+	s, err := v.str()
+	return expandTilde(s), err
+}
+
+func (v configValue) integer() (int, error) {
+	switch t := v.value.(type) {
+	case int64:
+		return int(t), nil
+	case string:
+		if n, err := strconv.Atoi(t); err == nil {
+			return n, nil
+		}
+	}
+	return 0, v.malformed(v.key, " must be a number: ", v.value)
+}
+
+func (v configValue) boolean() (bool, error) {
+	switch t := v.value.(type) {
+	case bool:
+		return t, nil
+	case string:
+		if b, err := strconv.ParseBool(t); err == nil {
+			return b, nil
+		}
+	}
+	return false, v.malformed(v.key, " must be true or false: ", v.value)
+}
+
+// Returns the items of an array of strings. A string is read as a comma separated list.
+func (v configValue) list() ([]string, error) {
+	switch t := v.value.(type) {
+	case string:
+		return strings.Split(t, ","), nil
+	case []any:
+		items := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, v.malformed(v.key, " must only contain strings: ", item)
+			}
+			items = append(items, s)
+		}
+		return items, nil
+	}
+	return nil, v.malformed(v.key, " must be an array of strings: ", v.value)
+}
+
+// Reads the configuration file at 'path' and returns the values of the configurations by their
+// full names.
+func readConfigFile(path string) (map[string]configValue, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]any
+	_, err = toml.Decode(string(contents), &data)
+	if err == nil {
+		return flattenConfig(data, contents)
+	}
+
+	var perr toml.ParseError
+	if !errors.As(err, &perr) {
+		return nil, err
+	}
+
+	// Files in the old flat format are usually not valid TOML because the values are not quoted
+	if !hasSections(contents) {
+		if values, ferr := parseFlatConfig(contents); ferr == nil {
+			return values, nil
+		}
+	}
+	return nil, &MalformedConfigurationError{
+		message: perr.Message,
+		Line:    perr.Position.Line,
+		Column:  perr.Position.Col,
+	}
+}
+
+// Maps the decoded TOML 'data' to the full names of the configurations. 'contents' is the file the
+// data was decoded from and is used to tell where values were set.
+func flattenConfig(data map[string]any, contents []byte) (map[string]configValue, error) {
+	positions := make(map[sectionKey]configLine)
+	for _, l := range scanConfigLines(strings.Split(string(contents), "\n")) {
+		if l.key != "" {
+			positions[sectionKey{l.section, l.key}] = l
+		}
+	}
+
+	values := make(map[string]configValue)
+	set := func(key string, at sectionKey, value any) error {
+		pos := positions[at]
+		v := configValue{key: key, value: value, line: pos.line, column: pos.column}
+		if prev, exists := values[key]; exists {
+			// Reported where it is set again
+			if prev.line > v.line {
+				v = prev
+			}
+			return v.malformed(key, " is set more than once")
+		}
+		values[key] = v
+		return nil
+	}
+
+	for _, name := range sortedKeys(data) {
+		section := strings.ToLower(name)
+		table, ok := data[name].(map[string]any)
+		if !ok {
+			if err := set(section, sectionKey{"", section}, data[name]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, name := range sortedKeys(table) {
+			at := sectionKey{section, strings.ToLower(name)}
+			key, ok := keyInSection(at)
+			if !ok {
+				pos := positions[at]
+				return nil, configValue{line: pos.line, column: pos.column}.malformed(
+					"malformed or unknown key encountered: ", section, ".", name)
+			}
+			if err := set(key, at, table[name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// Returns the full name of the configuration placed at 'at'.
+func keyInSection(at sectionKey) (string, bool) {
+	for key, loc := range sectionKeys {
+		if loc == at {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Parses a configuration file in the old flat format where every line sets a configuration by its
+// full name to an unquoted value.
+func parseFlatConfig(contents []byte) (map[string]configValue, error) {
+	values := make(map[string]configValue)
+
+	lines := strings.Split(string(contents), "\n")
+	for i, line := range lines {
+		nameAndValue := strings.SplitN(line, "=", 2)
+
+		if strings.HasPrefix(nameAndValue[0], "#") || strings.TrimFunc(line, sanitize) == "" {
+			// Ignore outcommented and empty lines.
+			continue
+		}
+
+		// Didn't get both key and value
+		if len(nameAndValue) < 2 {
+			return nil, &MalformedConfigurationError{
+				message: fmt.Sprint("malformed key in configuration: ", nameAndValue[0]),
+				Line:    i + 1,
+				Column:  1,
+			}
+		}
+
+		key := strings.ToLower(strings.TrimFunc(nameAndValue[0], sanitize))
+		value := strings.TrimFunc(nameAndValue[1], sanitize)
+		if key == committemplate {
+			// The template is given on a single line so newlines are written as \n
+			value = strings.ReplaceAll(value, `\n`, "\n")
+		}
+		values[key] = configValue{key: key, value: value, line: i + 1, column: 1}
+	}
+	return values, nil
+}
+
+func sanitize(r rune) bool {
+	return r == ' ' ||
+		r == '\t' ||
+		r == '\n' ||
+		r == '\r' ||
+		r == '"'
+}
+
+// A single line of a configuration file
+type configLine struct {
+	section string // Lower cased name of the section the line is in. Empty at the top of the file.
+	header  bool   // If the line starts a section
+	key     string // Lower cased key set on the line. Empty if no key is set.
+	line    int
+	column  int // Column of the key
+}
+
+// Tells which section every line is in and which key is set on it. Values spanning several lines
+// are not understood, so the lines inside them are reported as setting no key.
+func scanConfigLines(lines []string) []configLine {
+	scanned := make([]configLine, len(lines))
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		l := configLine{section: section, line: i + 1, column: len(line) - len(strings.TrimLeft(line, " \t")) + 1}
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "[["):
+			if end := strings.Index(trimmed, "]"); end > 0 {
+				section = strings.ToLower(strings.TrimFunc(trimmed[1:end], sanitize))
+				l.section = section
+				l.header = true
+			}
+		default:
+			if nameAndValue := strings.SplitN(trimmed, "=", 2); len(nameAndValue) == 2 {
+				l.key = strings.ToLower(strings.TrimFunc(nameAndValue[0], sanitize))
+			}
+		}
+		scanned[i] = l
+	}
+	return scanned
+}
+
+// Returns true if the configuration file 'contents' has any sections.
+func hasSections(contents []byte) bool {
+	for _, l := range scanConfigLines(strings.Split(string(contents), "\n")) {
+		if l.header {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a slice of bytes that can be serialized to a file and used as a valid config. The
+// configurations are placed in their sections and sorted by name to always give the same file.
+func CreateSerializableConfig(keyvals map[string]string) []byte {
+	sections := map[string]map[string]string{"": {}}
+	for k, v := range keyvals {
+		at, ok := sectionKeys[k]
+		if !ok {
+			at = sectionKey{"", k}
+		}
+		if sections[at.section] == nil {
+			sections[at.section] = make(map[string]string)
+		}
+		sections[at.section][at.name] = formatConfigValue(k, v)
+	}
+
+	var builder strings.Builder
+	for _, section := range sortedKeys(sections) {
+		if section != "" {
+			if builder.Len() > 0 {
+				builder.WriteString("\n")
+			}
+			builder.WriteString("[" + section + "]\n")
+		}
+		for _, name := range sortedKeys(sections[section]) {
+			builder.WriteString(name)
+			builder.WriteString(" = ")
+			builder.WriteString(sections[section][name])
+			builder.WriteString("\n")
+		}
+	}
+	return []byte(builder.String())
+}
+
+// Returns 'value' of the configuration 'key' written as a TOML value.
+func formatConfigValue(key, value string) string {
+	switch {
+	case boolConfigKeys[key]:
+		if _, err := strconv.ParseBool(value); err == nil {
+			return value
+		}
+	case intConfigKeys[key]:
+		if _, err := strconv.Atoi(value); err == nil {
+			return value
+		}
+	case listConfigKeys[key]:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, quoteConfigString(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return quoteConfigString(value)
+}
+
+// Returns the comment after the value on the TOML 'line' together with the whitespace before it, or
+// an empty string if the line has no such comment.
+func inlineComment(line string) string {
+	nameAndValue := strings.SplitN(line, "=", 2)
+	if len(nameAndValue) != 2 {
+		return ""
+	}
+	value := nameAndValue[1]
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			start := len(strings.TrimRight(value[:i], " \t"))
+			return value[start:]
+		}
+	}
+	return ""
+}
+
+// Returns 's' as a TOML basic string.
+func quoteConfigString(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// Sets 'key' to 'value' in the configuration file 'contents' and returns the updated contents. The
+// value on the line with the key is replaced and all other lines, including comments, are kept as
+// they are. A comment after the value is kept on the line as well. The
+// key is added to its section if it is not found, or at the top of the file if the file has no such
+// section. Files in the old flat format are kept in that format.
+func SetConfigValue(contents []byte, key, value string) []byte {
+	var data map[string]any
+	isTOML := toml.Unmarshal(contents, &data) == nil
+
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		lines = lines[:0]
+	}
+
+	if !isTOML {
+		newline := key + " = " + value
+		found := false
+		for i, line := range lines {
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			nameAndValue := strings.SplitN(line, "=", 2)
+			if strings.ToLower(strings.TrimFunc(nameAndValue[0], sanitize)) == key {
+				lines[i] = newline
+				found = true
+			}
+		}
+		if !found {
+			lines = append(lines, newline)
+		}
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	at, sectioned := sectionKeys[key]
+	scanned := scanConfigLines(lines)
+
+	found := false
+	for i, l := range scanned {
+		if l.key == "" {
+			continue
+		}
+		if (l.section == "" && l.key == key) || (sectioned && l.section == at.section && l.key == at.name) {
+			lines[i] = lines[i][:l.column-1] + l.key + " = " + quoteConfigString(value) + inlineComment(lines[i])
+			found = true
+		}
+	}
+	if found {
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	// Added after the last line of its section
+	if sectioned {
+		last := -1
+		for i, l := range scanned {
+			if l.section == at.section && strings.TrimSpace(lines[i]) != "" {
+				last = i
+			}
+		}
+		if last >= 0 {
+			return insertConfigLine(lines, last+1, at.name+" = "+quoteConfigString(value))
+		}
+	}
+
+	// Otherwise before the first section, keeping the blank line in front of it
+	insertAt := len(lines)
+	for i, l := range scanned {
+		if l.header {
+			insertAt = i
+			break
+		}
+	}
+	for insertAt > 0 && insertAt < len(lines) && strings.TrimSpace(lines[insertAt-1]) == "" {
+		insertAt--
+	}
+	return insertConfigLine(lines, insertAt, key+" = "+quoteConfigString(value))
+}
+
+// Inserts 'newline' into 'lines' at index 'i' and returns the lines as the contents of a file.
+func insertConfigLine(lines []string, i int, newline string) []byte {
+	lines = append(lines[:i], append([]string{newline}, lines[i:]...)...)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// Returns the keys of 'm' in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
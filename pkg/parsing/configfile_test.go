@@ -0,0 +1,59 @@
+package parsing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_readConfigFile_reports_position_of_malformed_configuration(t *testing.T) {
+	cases := map[string]struct {
+		contents string
+		line     int
+		column   int
+	}{
+		"invalid toml": {
+			contents: "userspacedir = \"~/\"\n\n[sync]\ndir = \"~/dotfiles\n",
+			line:     4,
+			column:   18,
+		},
+		"wrong type": {
+			contents: "userspacedir = \"~/\"\n\n[sync]\n  autosync = \"sometimes\"\n",
+			line:     4,
+			column:   3,
+		},
+		"unknown key in section": {
+			contents: "[hooks]\ndir = \"~/hooks\"\nretries = 3\n",
+			line:     3,
+			column:   1,
+		},
+		"set twice": {
+			contents: "syncdir = \"~/dotfiles\"\n[sync]\ndir = \"~/dotfiles\"\n",
+			line:     3,
+			column:   1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte(tc.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			values, err := readConfigFile(path)
+			if err == nil {
+				err = buildConfiguration(NewEmptyConfiguration(), values)
+			}
+
+			malformed, ok := err.(*MalformedConfigurationError)
+			if !ok {
+				test.FailHard(err, &MalformedConfigurationError{}, t)
+			}
+			test.AssertEqual(tc.line, malformed.Line, t)
+			test.AssertEqual(tc.column, malformed.Column, t)
+		})
+	}
+}
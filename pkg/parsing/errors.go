@@ -14,9 +14,14 @@ func (e *ConfigKeyNotFoundError) Error() string {
 
 type MalformedConfigurationError struct {
 	message string
+	Line    int // Line of the error starting at 1. Zero if not known.
+	Column  int // Column of the error starting at 1. Zero if not known.
 }
 
 func (e *MalformedConfigurationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.message)
+	}
 	return e.message
 }
 
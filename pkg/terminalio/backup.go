@@ -0,0 +1,202 @@
+package terminalio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+const (
+	backupManifestName = "manifest.json" // Name of the manifest inside every backup generation
+	backupFilesDir     = "files"         // Directory inside every generation holding the backed up files
+	backupIdLayout     = "20060102-150405.000"
+)
+
+// A BackupStore keeps backed up files in generations below a root directory. Every generation
+// belongs to a single dotf operation and contains a manifest describing what was backed up.
+//
+// Layout of the store:
+//
+//	<root>/<generation id>/manifest.json
+//	<root>/<generation id>/files/<absolute path of original file>
+type BackupStore struct {
+	root string
+}
+
+// BackupGeneration contains the files backed up by a single operation.
+type BackupGeneration struct {
+	Id      string         `json:"id"`      // Timestamp based id of the generation
+	Command string         `json:"command"` // Name of the dotf command that made the backups
+	Created time.Time      `json:"created"` // Time the generation was created
+	Entries []*BackupEntry `json:"entries"` // Files backed up in this generation
+	dir     string         // Absolute path to the generation directory
+}
+
+// BackupEntry describes a single backed up file or directory.
+type BackupEntry struct {
+	Original string `json:"original"` // Absolute path of the file that was backed up
+	Backup   string `json:"backup"`   // Absolute path to the backed up copy
+}
+
+func NewBackupStore(root string) *BackupStore {
+	return &BackupStore{root: root}
+}
+
+// ListGenerations returns all generations in the store sorted from oldest to newest.
+func (s *BackupStore) ListGenerations() ([]*BackupGeneration, error) {
+	absRoot, err := getAbsolutePath(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(absRoot)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*BackupGeneration{}, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var gens []*BackupGeneration
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		gen, err := readBackupGeneration(filepath.Join(absRoot, e.Name()))
+		if err != nil {
+			logging.Warn("Ignoring invalid backup generation:", err)
+			continue
+		}
+		gens = append(gens, gen)
+	}
+
+	sort.Slice(gens, func(i, j int) bool {
+		return gens[i].Id < gens[j].Id
+	})
+	return gens, nil
+}
+
+// GetGeneration returns the generation with the given id.
+func (s *BackupStore) GetGeneration(id string) (*BackupGeneration, error) {
+	absRoot, err := getAbsolutePath(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(absRoot, id)
+	if filepath.Dir(dir) != absRoot {
+		return nil, &ErrBackupNotFound{id}
+	}
+
+	if exists, _ := CheckIfFileExists(dir); !exists {
+		return nil, &ErrBackupNotFound{id}
+	}
+
+	return readBackupGeneration(dir)
+}
+
+// Creates a new and empty generation in the store for the given command.
+func (s *BackupStore) newGeneration(command string) (*BackupGeneration, error) {
+	absRoot, err := getAbsolutePath(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(absRoot, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now := time.Now()
+	baseId := now.Format(backupIdLayout)
+	id := baseId
+
+	// Operations started within the same millisecond are given a running suffix.
+	for n := 2; ; n++ {
+		err := os.Mkdir(filepath.Join(absRoot, id), 0700)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create backup generation: %w", err)
+		}
+		id = fmt.Sprintf("%s-%d", baseId, n)
+	}
+
+	gen := &BackupGeneration{
+		Id:      id,
+		Command: command,
+		Created: now,
+		Entries: []*BackupEntry{},
+		dir:     filepath.Join(absRoot, id),
+	}
+
+	if err := gen.writeManifest(); err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+// Copies the file or directory into the generation and records it in the manifest. Everything is
+// copied, including paths excluded by ignore files, so nothing is lost when the original is
+// deleted. The path to the backed up copy is returned. The given path should be made absolute by the
+// caller.
+func (g *BackupGeneration) add(file string) (string, error) {
+	// A file backed up twice in one operation keeps its first and original version.
+	if entry := g.find(file); entry != nil {
+		return entry.Backup, nil
+	}
+
+	path, err := copyFileOrDir(file, g.backupPath(file), nil)
+	if err != nil {
+		return "", err
+	}
+
+	g.Entries = append(g.Entries, &BackupEntry{Original: file, Backup: path})
+	if err := g.writeManifest(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Returns the entry backing up the given original path or nil.
+func (g *BackupGeneration) find(original string) *BackupEntry {
+	for _, e := range g.Entries {
+		if e.Original == original {
+			return e
+		}
+	}
+	return nil
+}
+
+// Returns the path inside the generation where the given file is backed up.
+func (g *BackupGeneration) backupPath(file string) string {
+	return filepath.Join(g.dir, backupFilesDir, file)
+}
+
+func (g *BackupGeneration) writeManifest() error {
+	bs, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize backup manifest: %w", err)
+	}
+	return writeFile(filepath.Join(g.dir, backupManifestName), bs, 0644)
+}
+
+func readBackupGeneration(dir string) (*BackupGeneration, error) {
+	bs, err := os.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+
+	gen := &BackupGeneration{}
+	if err := json.Unmarshal(bs, gen); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest in %s: %w", dir, err)
+	}
+	gen.dir = dir
+	return gen, nil
+}
@@ -0,0 +1,116 @@
+package terminalio
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_backupFile_saves_file(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := NewOperation("test", OperationOptions{BackupDir: env.BackupDir.Path})
+	fileToBackup := env.UserspaceDir.AddTempFile().Path
+
+	actual, err := op.backupFile(fileToBackup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBackupPath := op.generation.backupPath(fileToBackup)
+	if expectedBackupPath != actual {
+		test.Fail(actual, expectedBackupPath, t)
+	}
+
+	if exists, _ := CheckIfFileExists(actual); !exists {
+		test.Fail(exists, "Backed up file should exist", t)
+	}
+}
+
+func Test_backupFile_uses_one_generation_per_operation(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	store := NewBackupStore(env.BackupDir.Path)
+
+	op1 := NewOperation("add", OperationOptions{BackupDir: env.BackupDir.Path})
+	op2 := NewOperation("install", OperationOptions{BackupDir: env.BackupDir.Path})
+
+	file := env.UserspaceDir.AddTempFile().Path
+
+	for _, op := range []*Operation{op1, op1, op2} {
+		if _, err := op.backupFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gens, err := store.ListGenerations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gens) != 2 {
+		test.FailHardMsg("Expected a generation per operation", len(gens), 2, t)
+	}
+
+	for i, command := range []string{"add", "install"} {
+		if gens[i].Command != command {
+			test.FailMsg("Command recorded in manifest", gens[i].Command, command, t)
+		}
+		if len(gens[i].Entries) != 1 || gens[i].Entries[0].Original != file {
+			test.FailMsg("Entries recorded in manifest", gens[i].Entries, file, t)
+		}
+	}
+}
+
+func Test_RestoreBackup_restores_overwritten_file(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	file := env.UserspaceDir.AddTempFile().Path
+	original := []byte("original contents\n")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	op := NewOperation("setup", OperationOptions{BackupDir: env.BackupDir.Path})
+	if err := WriteFile(op, file, []byte("new contents\n"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	restoreOp := NewOperation("backup", OperationOptions{BackupDir: env.BackupDir.Path})
+	if err := RestoreBackup(restoreOp, op.generation.Id, ""); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	actual, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(actual, original); diff != "" {
+		t.Errorf("have: %s\nwant: %s\ndiff: %s", actual, original, diff)
+	}
+
+	// The replaced version should itself be backed up by the restoring operation
+	if restoreOp.generation == nil || restoreOp.generation.find(file) == nil {
+		t.Errorf("file replaced by restore should have been backed up")
+	}
+}
+
+func Test_RestoreBackup_unknown_id_gives_error(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := NewOperation("backup", OperationOptions{BackupDir: env.BackupDir.Path})
+
+	for _, id := range []string{"does-not-exist", "../.."} {
+		err := RestoreBackup(op, id, "")
+		if _, ok := err.(*ErrBackupNotFound); !ok {
+			test.Fail(err, &ErrBackupNotFound{id}, t)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package terminalio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// DefaultCommitTemplate is used to generate commit messages if no template is configured.
+const DefaultCommitTemplate = `{{.Command}} on {{.Host}}: {{.Summary}}
+{{range .Groups}}
+{{.Name}}{{range .Files}}
+    {{.}}{{end}}{{end}}
+`
+
+// CommitMessageData is the data available to commit message templates.
+type CommitMessageData struct {
+	Host    string         // Hostname of the machine making the commit
+	Command string         // The dotf command that made the commit
+	Summary string         // Comma separated names of the changed groups
+	Groups  []ChangedGroup // Changed files grouped by their top two directories
+}
+
+// ChangedGroup is a set of changed files sharing the same top two directories. A changed file
+// closer to the root is a group of its own.
+type ChangedGroup struct {
+	Name  string   // E.g. .config/nvim or .zshrc
+	Files []string // Changed files relative to the group. Empty if the group is a single file.
+}
+
+// Generates a commit message for 'files' changed in the repository at 'repoPath' from 'tmpl'. If
+// the files are in the dotfiles directory they are shown relative to it.
+func generateCommitMessage(tmpl, command, repoPath, dotfilesDir string, files []string) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultCommitTemplate
+	}
+
+	t, err := template.New("commit").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse commit message template: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	groups := groupChangedFiles(relativeToDotfiles(repoPath, dotfilesDir, files))
+
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+
+	var b strings.Builder
+	err = t.Execute(&b, &CommitMessageData{
+		Host:    host,
+		Command: command,
+		Summary: strings.Join(names, ", "),
+		Groups:  groups,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate commit message: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Makes 'files' relative to the repository at 'repoPath' relative to the dotfiles dir instead if
+// they are inside it.
+func relativeToDotfiles(repoPath, dotfilesDir string, files []string) []string {
+	if dotfilesDir == "" {
+		return files
+	}
+
+	absDotfilesDir, err := getAbsolutePath(dotfilesDir)
+	if err != nil {
+		return files
+	}
+
+	relFiles := make([]string, 0, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(absDotfilesDir, filepath.Join(repoPath, f))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			rel = f
+		}
+		relFiles = append(relFiles, rel)
+	}
+	return relFiles
+}
+
+// Groups 'files' by their top two directories. Groups and the files in them are sorted by name.
+func groupChangedFiles(files []string) []ChangedGroup {
+	byName := map[string]*ChangedGroup{}
+	for _, f := range files {
+		parts := strings.Split(filepath.ToSlash(f), "/")
+
+		name := f
+		var rest string
+		if len(parts) > 2 {
+			name = strings.Join(parts[:2], "/")
+			rest = strings.Join(parts[2:], "/")
+		}
+
+		g, ok := byName[name]
+		if !ok {
+			g = &ChangedGroup{Name: name}
+			byName[name] = g
+		}
+		if rest != "" {
+			g.Files = append(g.Files, rest)
+		}
+	}
+
+	groups := make([]ChangedGroup, 0, len(byName))
+	for _, g := range byName {
+		sort.Strings(g.Files)
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Parses the output of 'git status --porcelain -z --untracked-files=all' into the changed paths.
+func parseChangedFiles(output string) []string {
+	var files []string
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		files = append(files, entry[3:])
+
+		// Renames and copies are followed by the original path
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	return files
+}
@@ -0,0 +1,64 @@
+package terminalio
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_parseChangedFiles_handles_renames(t *testing.T) {
+	output := " M .zshrc\x00R  .config/new.conf\x00.config/old.conf\x00?? .config/nvim/init.lua\x00"
+
+	actual := parseChangedFiles(output)
+	expected := []string{".zshrc", ".config/new.conf", ".config/nvim/init.lua"}
+
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("have: %v\nwant: %v\ndiff: %s", actual, expected, diff)
+	}
+}
+
+func Test_generateCommitMessage_groups_files_by_top_two_directories(t *testing.T) {
+	files := []string{
+		"host/.zshrc",
+		"host/.config/nvim/lua/plugins.lua",
+		"host/.config/nvim/init.lua",
+		"host/.config/i3.conf",
+		"otherhost/.bashrc",
+	}
+
+	actual, err := generateCommitMessage("", "sync", "/repo", "/repo/host", files)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	host, _ := os.Hostname()
+	expected := "sync on " + host + ": .config/i3.conf, .config/nvim, .zshrc, otherhost/.bashrc\n" +
+		"\n" +
+		".config/i3.conf\n" +
+		".config/nvim\n" +
+		"    init.lua\n" +
+		"    lua/plugins.lua\n" +
+		".zshrc\n" +
+		"otherhost/.bashrc"
+
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("have: %s\nwant: %s\ndiff: %s", actual, expected, diff)
+	}
+}
+
+func Test_generateCommitMessage_uses_given_template(t *testing.T) {
+	actual, err := generateCommitMessage("[{{.Command}}] {{len .Groups}} changed", "dotf-tray", "/repo", "", []string{"a", "b/c"})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	if expected := "[dotf-tray] 2 changed"; actual != expected {
+		test.Fail(actual, expected, t)
+	}
+
+	if _, err := generateCommitMessage("{{.Unknown", "sync", "/repo", "", nil); err == nil {
+		test.Fail(err, "Invalid template should give an error", t)
+	}
+}
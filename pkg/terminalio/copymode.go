@@ -0,0 +1,253 @@
+package terminalio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+// AddCopyDotfile copies a file or directory from userspace into the dotfiles directory and records
+// it in the manifest with the install mode ModeCopy. The file in userspace is left as it is. The
+// identical relative path is used for both 'userspaceHomedir' and 'dotfilesDir'.
+func AddCopyDotfile(op *Operation, userspaceFile, userspaceHomedir, dotfilesDir string) error {
+	if op.manifest == nil || op.manifest.path == "" {
+		return fmt.Errorf("copy mode requires a sync directory to keep the manifest in")
+	}
+
+	absUserspaceFile, err := GetAndValidateAbsolutePath(userspaceFile)
+	if err != nil {
+		return err
+	}
+
+	if isIgnored(op.ignore, absUserspaceFile) {
+		return &ErrPathIgnored{absUserspaceFile}
+	}
+
+	absHomedir, err := GetAndValidateAbsolutePath(userspaceHomedir)
+	if err != nil {
+		return err
+	}
+
+	absDotfilesDir, err := GetAndValidateAbsolutePath(dotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	absNewDotFile, err := replacePrefixPath(absUserspaceFile, absHomedir, absDotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	exists, err := op.pathExists(absNewDotFile)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return &ErrFileAlreadyExists{absNewDotFile}
+	}
+
+	if err := op.prepareManifest(absDotfilesDir); err != nil {
+		return err
+	}
+
+	entry := newManifestEntry(absUserspaceFile, ModeCopy)
+
+	return op.atomic(func() error {
+		if err := op.mkdirAll(filepath.Dir(absNewDotFile)); err != nil {
+			return fmt.Errorf("didn't create nested path for dotfile: %v", err)
+		}
+		if _, err := op.copyFileOrDir(absUserspaceFile, absNewDotFile); err != nil {
+			return err
+		}
+		return op.trackDotfile(absNewDotFile, absDotfilesDir, entry)
+	})
+}
+
+// Copies the dotfile described by 'info' into userspace instead of symlinking it. The file in
+// userspace will be removed if 'overwrite' is true.
+func installCopy(op *Operation, info *fileLocationInfo, overwrite bool) error {
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+	if exists && !overwrite {
+		return &ErrAbortOnOverwrite{info.userspaceFile}
+	}
+
+	ignored, err := op.ignoredPathsInside(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+
+	return op.atomic(func() error {
+		// Paths excluded by the ignore files inside a copied directory are kept
+		if isDir, _ := isDirectory(info.dotfilesFile); isDir && len(ignored) > 0 {
+			return op.replaceDirContents(info.dotfilesFile, info.userspaceFile)
+		}
+
+		if exists {
+			if err := op.deleteFileOrDir(info.userspaceFile); err != nil {
+				return err
+			}
+		}
+
+		if err := op.mkdirAll(filepath.Dir(info.userspaceFile)); err != nil {
+			return fmt.Errorf("didn't create nested path for userspace file: %v", err)
+		}
+
+		_, err := op.copyFileOrDir(info.dotfilesFile, info.userspaceFile)
+		return err
+	})
+}
+
+// Reverts a dotfile installed by copying it by keeping the copy in userspace, or copying it if it is
+// missing, and removing the dotfile from dotfiles.
+func revertCopy(op *Operation, info *fileLocationInfo) error {
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+
+	return op.atomic(func() error {
+		if !exists {
+			if err := op.mkdirAll(filepath.Dir(info.userspaceFile)); err != nil {
+				return err
+			}
+			if _, err := op.copyFileOrDir(info.dotfilesFile, info.userspaceFile); err != nil {
+				return err
+			}
+		}
+		return op.deleteFileOrDir(info.dotfilesFile)
+	})
+}
+
+// Determines the state of a dotfile installed by copying it to the regular file or directory at
+// 'userspaceFile'. The copy is installed if its contents equal the dotfile. Otherwise the side
+// changed last decides whether the copy was modified or the dotfile is newer than the copy. Paths
+// ignored by 'ignore' are not compared.
+func copyState(dotfilesFile, userspaceFile string, ignore *IgnoreMatcher) (DotfileState, error) {
+	dotfileIsDir, err := isDirectory(dotfilesFile)
+	if err != nil {
+		return 0, err
+	}
+	copyIsDir, err := isDirectory(userspaceFile)
+	if err != nil {
+		return 0, err
+	}
+	if dotfileIsDir != copyIsDir {
+		return StateConflicting, nil
+	}
+
+	files, err := relativeFiles(ignore, dotfilesFile, userspaceFile)
+	if err != nil {
+		return 0, err
+	}
+
+	var dotfileChanged, copyChanged time.Time
+	differs := false
+
+	for rel := range files {
+		a, b := filepath.Join(dotfilesFile, rel), filepath.Join(userspaceFile, rel)
+		contentsA, timeA := readWithModTime(a)
+		contentsB, timeB := readWithModTime(b)
+		if bytes.Equal(contentsA, contentsB) && timeA.IsZero() == timeB.IsZero() {
+			continue
+		}
+
+		differs = true
+		if timeA.After(dotfileChanged) {
+			dotfileChanged = timeA
+		}
+		if timeB.After(copyChanged) {
+			copyChanged = timeB
+		}
+	}
+
+	switch {
+	case !differs:
+		return StateInstalled, nil
+	case copyChanged.After(dotfileChanged):
+		return StateModified, nil
+	}
+	return StateOutdated, nil
+}
+
+// Returns the contents of the file at 'path' and when it was last modified. A missing file is empty
+// and has the zero time.
+func readWithModTime(path string) ([]byte, time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	return contents, info.ModTime()
+}
+
+// Returns the status of every dotfile installed by copying it, which is in the given 'state'.
+func copiesInState(op *Operation, userspaceDir string, layers Layers, state DotfileState) ([]*DotfileStatus, error) {
+	if !op.manifest.hasCopies() || len(layers) == 0 {
+		return nil, nil
+	}
+
+	statuses, err := GetLayeredDotfilesStatus(userspaceDir, layers, op.ignore, op.manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var copies []*DotfileStatus
+	for _, s := range statuses {
+		if s.State == state && op.manifest.modeOf(s.DotfilesFile, s.Layer) == ModeCopy {
+			copies = append(copies, s)
+		}
+	}
+	return copies, nil
+}
+
+// Copies the copies in userspace that were modified after their dotfile back into dotfiles. The
+// replaced dotfiles are backed up.
+func collectCopies(op *Operation, userspaceDir string, layers Layers) error {
+	modified, err := copiesInState(op, userspaceDir, layers, StateModified)
+	if err != nil {
+		return err
+	}
+
+	return op.atomic(func() error {
+		for _, s := range modified {
+			logging.Info("Copying changes in userspace back into dotfiles:", s.UserspaceFile)
+			if err := op.deleteFileOrDir(s.DotfilesFile); err != nil {
+				return err
+			}
+			if _, err := op.copyFileOrDir(s.UserspaceFile, s.DotfilesFile); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Copies the dotfiles that were changed after their copy in userspace, e.g. by pulling changes from
+// the remote, into userspace. The replaced copies are backed up.
+func refreshCopies(op *Operation, userspaceDir string, layers Layers) error {
+	outdated, err := copiesInState(op, userspaceDir, layers, StateOutdated)
+	if err != nil {
+		return err
+	}
+
+	return op.atomic(func() error {
+		for _, s := range outdated {
+			logging.Info("Copying changed dotfile into userspace:", s.UserspaceFile)
+			info := &fileLocationInfo{dotfilesFile: s.DotfilesFile, userspaceFile: s.UserspaceFile}
+			if err := installCopy(op, info, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
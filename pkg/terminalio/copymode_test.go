@@ -0,0 +1,108 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_LoadManifest_reads_install_modes(t *testing.T) {
+	syncDir := t.TempDir()
+	writeLayerFile(t, syncDir, ManifestName, `
+# Applications that replace symlinks
+[files.".ssh"]
+mode = "copy"
+
+[files.".zshrc"]
+mode = "symlink"
+`)
+
+	m, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual(ModeCopy, m.Mode("", ".ssh/config"), t)
+	test.AssertEqual(ModeSymlink, m.Mode("", ".zshrc"), t)
+	test.AssertEqual(ModeSymlink, m.Mode("", ".config/nvim/init.lua"), t)
+
+	writeLayerFile(t, syncDir, ManifestName, "[files.\".ssh\"]\nmode = \"hardlink\"\n")
+	if _, err := LoadManifest(syncDir); err == nil {
+		test.FailHard(err, &ErrMalformedManifest{}, t)
+	}
+}
+
+// Sets the modification time of 'path' to 'age' ago.
+func setModTime(t *testing.T, path string, age time.Duration) {
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_copies_are_installed_and_synced_in_both_directions(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+	manifest := &Manifest{Files: map[string]*ManifestEntry{".ssh": {Mode: ModeCopy}}}
+	newOp := func() *Operation {
+		return NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: manifest})
+	}
+
+	dotfile := writeLayerFile(t, dfiles, ".ssh/config", "Host example\n")
+	ucopy := filepath.Join(uspace, ".ssh/config")
+
+	if err := InstallDotfile(newOp(), filepath.Join(dfiles, ".ssh"), uspace, dfiles, false); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if isSymlink, err := IsFileSymlink(filepath.Join(uspace, ".ssh")); err != nil || isSymlink {
+		test.FailHard(err, "Expected a copy in userspace", t)
+	}
+
+	assertState := func(want DotfileState) {
+		t.Helper()
+		statuses, err := GetLayeredDotfilesStatus(uspace, Layers{dfiles}, nil, manifest)
+		if err != nil {
+			test.FailHard(err, "No error should have happened", t)
+		}
+		if len(statuses) != 1 {
+			test.FailHardMsg("Unexpected number of entries", len(statuses), 1, t)
+		}
+		test.AssertEqual(want, statuses[0].State, t)
+	}
+	assertState(StateInstalled)
+
+	// Edited in userspace
+	writeLayerFile(t, uspace, ".ssh/config", "Host example\n  User me\n")
+	setModTime(t, dotfile, time.Hour)
+	assertState(StateModified)
+
+	if err := collectCopies(newOp(), uspace, Layers{dfiles}); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	contents, err := os.ReadFile(dotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual("Host example\n  User me\n", string(contents), t)
+	assertState(StateInstalled)
+
+	// Changed in dotfiles, e.g. by pulling from the remote
+	writeLayerFile(t, dfiles, ".ssh/config", "Host other\n")
+	setModTime(t, ucopy, time.Hour)
+	assertState(StateOutdated)
+
+	if err := refreshCopies(newOp(), uspace, Layers{dfiles}); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	contents, err = os.ReadFile(ucopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual("Host other\n", string(contents), t)
+	assertState(StateInstalled)
+}
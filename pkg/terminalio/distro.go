@@ -0,0 +1,228 @@
+package terminalio
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListDistros returns the names of all distributions in 'distrosDir' sorted by name. Every
+// directory in 'distrosDir' is a distribution containing a full set of dotfiles.
+func ListDistros(distrosDir string) ([]string, error) {
+	entries, err := os.ReadDir(expandTilde(distrosDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetDistroPath returns the absolute path to the distribution 'name' in 'distrosDir'.
+func GetDistroPath(distrosDir, name string) (string, error) {
+	path, err := distroPath(distrosDir, name)
+	if err != nil {
+		return "", err
+	}
+
+	ok, err := isDirectory(path)
+	if err != nil || !ok {
+		return "", &ErrDistroNotFound{name}
+	}
+	return path, nil
+}
+
+// CreateDistro creates an empty distribution 'name' in 'distrosDir' and returns its path.
+func CreateDistro(op *Operation, distrosDir, name string) (string, error) {
+	path, err := distroPath(distrosDir, name)
+	if err != nil {
+		return "", err
+	}
+
+	exists, err := op.pathExists(path)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", &ErrFileAlreadyExists{path}
+	}
+
+	if err := op.mkdirAll(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Returns the absolute path to the distribution 'name' after checking that the name is valid.
+func distroPath(distrosDir, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return "", &ErrInvalidDistroName{name}
+	}
+
+	absDistrosDir, err := getAbsolutePath(distrosDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(absDistrosDir, name), nil
+}
+
+// DirectoryDiff lists the differences between two directory trees. Paths are relative to the roots
+// of the trees.
+type DirectoryDiff struct {
+	OnlyInA []string // Files and directories only found in the first tree
+	OnlyInB []string // Files and directories only found in the second tree
+	Changed []string // Files found in both trees with different contents or types
+}
+
+// DiffDirectories compares the directory trees 'a' and 'b'. Directories found in only one of the
+// trees are reported as a single entry. Symlinks are compared by their target. Paths ignored by
+// 'ignore' are left out.
+func DiffDirectories(a, b string, ignore *IgnoreMatcher) (*DirectoryDiff, error) {
+	absA, err := GetAndValidateAbsolutePath(a)
+	if err != nil {
+		return nil, err
+	}
+	absB, err := GetAndValidateAbsolutePath(b)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &DirectoryDiff{}
+
+	err = filepath.WalkDir(absA, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == absA {
+			return nil
+		}
+		if ignore.Match(p, d.IsDir()) {
+			return skipEntry(d)
+		}
+
+		rel, err := filepath.Rel(absA, p)
+		if err != nil {
+			return err
+		}
+
+		other, err := os.Lstat(filepath.Join(absB, rel))
+		if errors.Is(err, os.ErrNotExist) {
+			diff.OnlyInA = append(diff.OnlyInA, rel)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && other.IsDir() {
+			return nil
+		}
+
+		equal, err := sameContents(p, filepath.Join(absB, rel))
+		if err != nil {
+			return err
+		}
+		if !equal {
+			diff.Changed = append(diff.Changed, rel)
+		}
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(absB, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == absB {
+			return nil
+		}
+		if ignore.Match(p, d.IsDir()) {
+			return skipEntry(d)
+		}
+
+		rel, err := filepath.Rel(absB, p)
+		if err != nil {
+			return err
+		}
+
+		exists, err := checkIfPathExists(filepath.Join(absA, rel))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			diff.OnlyInB = append(diff.OnlyInB, rel)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// Returns true if the files or symlinks 'a' and 'b' have the same type and contents.
+func sameContents(a, b string) (bool, error) {
+	infoA, err := os.Lstat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Lstat(b)
+	if err != nil {
+		return false, err
+	}
+
+	if infoA.Mode().Type() != infoB.Mode().Type() {
+		return false, nil
+	}
+
+	if infoA.Mode()&os.ModeSymlink != 0 {
+		targetA, err := os.Readlink(a)
+		if err != nil {
+			return false, err
+		}
+		targetB, err := os.Readlink(b)
+		if err != nil {
+			return false, err
+		}
+		return targetA == targetB, nil
+	}
+
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	contentsA, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	contentsB, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(contentsA, contentsB), nil
+}
@@ -0,0 +1,201 @@
+package terminalio
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DotfileDiff is a copy of a dotfile in userspace that has replaced the symlink to it, e.g. because
+// an editor saved the file by replacing it, or a file rendered from a template or decrypted from a
+// secret that differs from it.
+type DotfileDiff struct {
+	DotfilesFile  string // Absolute path to the dotfile
+	UserspaceFile string // Absolute path to the copy in userspace
+	Diff          string // Unified diff from the dotfile to the copy. Empty if their contents are equal.
+}
+
+// DiffDotfile compares every dotfile below 'file' in 'layers' with the regular file or directory at
+// its location in userspace. Both the filepath inside dotfiles as well as in userspace can be given.
+// Templates are rendered and secrets decrypted before they are compared. Dotfiles installed by a
+// symlink or missing in userspace are left out, as are unchanged templates and secrets.
+func DiffDotfile(op *Operation, file, userspaceDir string, layers Layers) ([]*DotfileDiff, error) {
+	absLayers, err := layers.absolute()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := GetLayeredDotfilesStatusAt(file, userspaceDir, absLayers, op.ignore, op.manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*DotfileDiff
+	for _, s := range statuses {
+		if !isCopy(s) {
+			continue
+		}
+
+		diff, err := diffCopy(op, s, absLayers)
+		if err != nil {
+			return nil, err
+		}
+
+		if diff == "" && isGenerated(s.DotfilesFile) {
+			continue
+		}
+		diffs = append(diffs, &DotfileDiff{s.DotfilesFile, s.UserspaceFile, diff})
+	}
+	return diffs, nil
+}
+
+// Returns true if a regular file or directory is found in userspace instead of a symlink to the
+// dotfile of 's'.
+func isCopy(s *DotfileStatus) bool {
+	switch s.State {
+	case StateConflicting, StateDrifted:
+		return true
+	case StateInstalled:
+		// Secrets are reported as installed without being compared
+		return isSecret(s.DotfilesFile)
+	}
+	return false
+}
+
+// Returns the unified diff from the dotfile of 's' to the copy in userspace. Directories are compared
+// file by file with files found in only one of them compared to an empty file.
+func diffCopy(op *Operation, s *DotfileStatus, layers Layers) (string, error) {
+	isDir, err := isDirectory(s.DotfilesFile)
+	if err != nil {
+		return "", err
+	}
+	if !isDir {
+		dotfile, err := dotfileContents(op, s.DotfilesFile, layers)
+		if err != nil {
+			return "", err
+		}
+		userspace, err := os.ReadFile(s.UserspaceFile)
+		if err != nil {
+			return "", err
+		}
+		return UnifiedDiff(s.DotfilesFile, s.UserspaceFile, dotfile, userspace), nil
+	}
+
+	files, err := relativeFiles(op.ignore, s.DotfilesFile, s.UserspaceFile)
+	if err != nil {
+		return "", err
+	}
+
+	var diff string
+	for _, rel := range sortedPaths(files) {
+		a, b := filepath.Join(s.DotfilesFile, rel), filepath.Join(s.UserspaceFile, rel)
+		aContents, aName := readOrEmpty(a)
+		bContents, bName := readOrEmpty(b)
+		diff += UnifiedDiff(aName, bName, aContents, bContents)
+	}
+	return diff, nil
+}
+
+// Returns the contents of the dotfile at 'path' as they are written to userspace.
+func dotfileContents(op *Operation, path string, layers Layers) ([]byte, error) {
+	switch {
+	case isTemplate(path):
+		data, err := loadTemplateData(layers)
+		if err != nil {
+			return nil, err
+		}
+		return renderTemplate(path, data)
+	case isSecret(path):
+		key, err := op.secretKey()
+		if err != nil {
+			return nil, err
+		}
+		return decryptSecret(key, path)
+	}
+	return os.ReadFile(path)
+}
+
+// Returns the paths of regular files relative to any of 'dirs' that are not ignored by 'ignore'.
+func relativeFiles(ignore *IgnoreMatcher, dirs ...string) (map[string]*layeredEntry, error) {
+	files := make(map[string]*layeredEntry)
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ignore.Match(p, d.IsDir()) {
+				return skipEntry(d)
+			}
+			if d.Type().IsRegular() {
+				rel, err := filepath.Rel(dir, p)
+				if err != nil {
+					return err
+				}
+				files[rel] = &layeredEntry{layer: dir}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Reads the file at 'path' and returns its contents and name as shown in a diff. A missing file is
+// empty and shown as /dev/null.
+func readOrEmpty(path string) ([]byte, string) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, os.DevNull
+	}
+	return contents, path
+}
+
+// AdoptDotfile replaces the dotfile of 'd' by the copy in userspace and restores the symlink in
+// userspace pointing to it. Secrets are encrypted again and the decrypted copy is kept in
+// userspace. Templates cannot be adopted, as the rendered copy would replace the template.
+func AdoptDotfile(op *Operation, d *DotfileDiff) error {
+	if isTemplate(d.DotfilesFile) {
+		return &ErrAdoptTemplate{d.DotfilesFile}
+	}
+
+	if isSecret(d.DotfilesFile) {
+		key, err := op.secretKey()
+		if err != nil {
+			return err
+		}
+		plaintext, err := os.ReadFile(d.UserspaceFile)
+		if err != nil {
+			return err
+		}
+		encrypted, err := encryptSecret(key, plaintext)
+		if err != nil {
+			return err
+		}
+
+		return op.atomic(func() error {
+			if err := op.deleteFileOrDir(d.DotfilesFile); err != nil {
+				return err
+			}
+			return op.writeFile(d.DotfilesFile, encrypted, 0644)
+		})
+	}
+
+	return op.atomic(func() error {
+		// The dotfile is backed up before it is deleted
+		if err := op.deleteFileOrDir(d.DotfilesFile); err != nil {
+			return err
+		}
+
+		if _, err := op.copyFileOrDir(d.UserspaceFile, d.DotfilesFile); err != nil {
+			return err
+		}
+
+		if err := op.deleteFileOrDir(d.UserspaceFile); err != nil {
+			return err
+		}
+
+		return op.createSymlink(d.UserspaceFile, d.DotfilesFile)
+	})
+}
@@ -0,0 +1,61 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_DiffDotfile_and_AdoptDotfile_restore_symlink(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+	layers := Layers{dfiles}
+
+	dotfile := writeLayerFile(t, dfiles, ".zshrc", "export EDITOR=vi\n")
+	installed := writeLayerFile(t, dfiles, ".bashrc", "set -o vi\n")
+	if err := os.Symlink(installed, filepath.Join(uspace, ".bashrc")); err != nil {
+		t.Fatal(err)
+	}
+	ucopy := writeLayerFile(t, uspace, ".zshrc", "export EDITOR=nvim\n")
+
+	diffs, err := DiffDotfile(newTestOperation(t), dfiles, uspace, layers)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if len(diffs) != 1 {
+		test.FailHardMsg("Only the copy should be reported", len(diffs), 1, t)
+	}
+	test.AssertEqual(dotfile, diffs[0].DotfilesFile, t)
+	test.AssertEqual(ucopy, diffs[0].UserspaceFile, t)
+	test.AssertEqual("--- "+dotfile+"\n+++ "+ucopy+"\n@@ -1 +1 @@\n-export EDITOR=vi\n+export EDITOR=nvim\n", diffs[0].Diff, t)
+
+	if err := AdoptDotfile(newTestOperation(t), diffs[0]); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	contents, err := os.ReadFile(dotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual("export EDITOR=nvim\n", string(contents), t)
+
+	target, err := os.Readlink(ucopy)
+	if err != nil {
+		test.FailHard(err, "Expected a symlink in userspace", t)
+	}
+	test.AssertEqual(dotfile, target, t)
+}
+
+func Test_AdoptDotfile_refuses_templates(t *testing.T) {
+	d := &DotfileDiff{DotfilesFile: "/dotfiles/.gitconfig" + TemplateSuffix, UserspaceFile: "/home/.gitconfig"}
+
+	err := AdoptDotfile(newTestOperation(t), d)
+	if _, ok := err.(*ErrAdoptTemplate); !ok {
+		test.FailHard(err, &ErrAdoptTemplate{}, t)
+	}
+}
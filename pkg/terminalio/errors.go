@@ -1,6 +1,11 @@
 package terminalio
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 /* Exported */
 
@@ -9,9 +14,34 @@ type ErrMergeFail struct {
 	directory string
 }
 
-type ErrUnmatchedShellReturn struct {
-	command  termCommand
-	expected []commandReturn
+// The ErrMergeConflict is returned if the remote could not be merged or rebased onto because files
+// conflict. The merge or rebase has been aborted.
+type ErrMergeConflict struct {
+	Directory string
+	Conflicts []MergeConflict
+}
+
+// MergeConflict is a file that was changed both locally and on the remote.
+type MergeConflict struct {
+	File          string // Path relative to the root of the repository
+	UserspaceFile string // Location of the file in userspace. Empty if not in the dotfiles directory.
+}
+
+// The ErrUnresolvedConflicts is returned if the repository contains conflicts from an earlier merge
+// that have not been resolved.
+type ErrUnresolvedConflicts struct {
+	directory string
+}
+
+// The ErrRebaseFail is returned if local commits could not be rebased onto the remote without
+// interaction.
+type ErrRebaseFail struct {
+	directory string
+}
+
+// The ErrUnknownSyncStrategy is returned if a sync strategy is requested that does not exist.
+type ErrUnknownSyncStrategy struct {
+	Name string
 }
 
 type ErrFileNotFound struct {
@@ -34,6 +64,111 @@ type ErrAbortOnOverwrite struct {
 	Path string
 }
 
+type ErrBackupNotFound struct {
+	id string
+}
+
+// The ErrPathIgnored is returned if a path is given that is excluded by an ignore file.
+type ErrPathIgnored struct {
+	path string
+}
+
+// The ErrIgnoredPathsInside is returned if a directory would be deleted while it contains paths
+// excluded by an ignore file, which are never copied into dotfiles.
+type ErrIgnoredPathsInside struct {
+	Path    string
+	Ignored []string
+}
+
+// The ErrTemplate is returned if a template could not be rendered.
+type ErrTemplate struct {
+	Path  string
+	Cause error
+}
+
+// The ErrMalformedVarsFile is returned if a line of a variables file is not a 'key = value' pair.
+type ErrMalformedVarsFile struct {
+	path string
+	line int
+}
+
+// The ErrKeyNotFound is returned if a secret is encrypted or decrypted but the key file is missing.
+type ErrKeyNotFound struct {
+	path string
+}
+
+// The ErrInvalidKey is returned if the key file does not contain a hex encoded 256 bit key.
+type ErrInvalidKey struct {
+	path string
+}
+
+// The ErrDecryptSecret is returned if a secret is not encrypted by dotf or by another key.
+type ErrDecryptSecret struct {
+	path string
+}
+
+// The ErrSecretNotRegularFile is returned if something other than a regular file is encrypted.
+type ErrSecretNotRegularFile struct {
+	path string
+}
+
+// The ErrPlaintextSecret is returned by sync if plaintext copies of secrets would be committed.
+type ErrPlaintextSecret struct {
+	directory string
+	Files     []string
+}
+
+// The ErrHookFailed is returned if a hook exits with an error.
+type ErrHookFailed struct {
+	Hook   string
+	Output string
+	Cause  error
+}
+
+// The ErrHookTimeout is returned if a hook is killed because it ran for too long.
+type ErrHookTimeout struct {
+	Hook    string
+	Timeout time.Duration
+}
+
+// The ErrMalformedManifest is returned if the manifest cannot be read.
+type ErrMalformedManifest struct {
+	path   string
+	reason string
+}
+
+// The ErrFileNotManaged is returned if a path in the dotfiles directory is not recorded in the
+// manifest while the manifest records the paths managed in that directory.
+type ErrFileNotManaged struct {
+	path string
+}
+
+// The ErrAdoptTemplate is returned if a file rendered from a template is adopted into dotfiles.
+type ErrAdoptTemplate struct {
+	path string
+}
+
+type ErrDistroNotFound struct {
+	name string
+}
+
+type ErrInvalidDistroName struct {
+	name string
+}
+
+// The ErrUpstreamNotFound is returned if no remote or branch is configured for syncing and the
+// current branch does not track a remote branch either.
+type ErrUpstreamNotFound struct {
+	directory string
+	branch    string
+}
+
+// The ErrRollbackFailed is returned if an operation failed and not all of its steps could be undone.
+type ErrRollbackFailed struct {
+	Cause    error   // The error that caused the rollback
+	Failures []error // Errors from steps that could not be undone
+}
+
 func (e *ErrAbortOnOverwrite) Error() string {
 	return fmt.Sprintf("file or directory was present at location: %s. User interaction required.", e.Path)
 }
@@ -50,8 +185,99 @@ func (e *ErrMergeFail) Error() string {
 	return fmt.Sprintf("merge was unsuccessful and rolled back (aborted). Manual intervention required in '%s'", e.directory)
 }
 
-func (e *ErrUnmatchedShellReturn) Error() string {
-	return fmt.Sprintf("while executing '%s' in the shell, non of the following outputs where found: [%s]", e.command, e.expected)
+func (e *ErrRebaseFail) Error() string {
+	return fmt.Sprintf("rebase was unsuccessful and rolled back (aborted). Manual intervention required in '%s'", e.directory)
+}
+
+func (e *ErrUnknownSyncStrategy) Error() string {
+	return fmt.Sprintf("unknown sync strategy '%s'. Use one of: %s", e.Name, strings.Join(SyncStrategyNames(), ", "))
+}
+
+func (e *ErrMergeConflict) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sync was aborted because of conflicting files in '%s':", e.Directory)
+	for _, c := range e.Conflicts {
+		if c.UserspaceFile != "" {
+			fmt.Fprintf(&b, "\n\t%s (%s)", c.File, c.UserspaceFile)
+		} else {
+			fmt.Fprintf(&b, "\n\t%s", c.File)
+		}
+	}
+	b.WriteString("\nSync again resolving the conflicts with either the local (ours) or the remote (theirs) version.")
+	return b.String()
+}
+
+func (e *ErrUnresolvedConflicts) Error() string {
+	return fmt.Sprintf("unresolved merge conflicts found. Resolve and commit them in '%s' before syncing", e.directory)
+}
+
+func (e *ErrPathIgnored) Error() string {
+	return fmt.Sprintf("path is excluded by %s: %s", IgnoreFileName, e.path)
+}
+
+func (e *ErrIgnoredPathsInside) Error() string {
+	return fmt.Sprintf("%s contains paths excluded by %s that would be lost: %s. Add the other paths inside it individually or move the excluded paths away first",
+		e.Path, IgnoreFileName, strings.Join(e.Ignored, ", "))
+}
+
+func (e *ErrTemplate) Error() string {
+	return fmt.Sprintf("failed to render template %s: %v", e.Path, e.Cause)
+}
+
+func (e *ErrTemplate) Unwrap() error {
+	return e.Cause
+}
+
+func (e *ErrMalformedVarsFile) Error() string {
+	return fmt.Sprintf("malformed variable on line %d in %s. Expected 'key = value'", e.line, e.path)
+}
+
+func (e *ErrKeyNotFound) Error() string {
+	return fmt.Sprintf("key for secrets was not found at: %s. Set 'keyfile' in the configuration or encrypt a file to create it", e.path)
+}
+
+func (e *ErrInvalidKey) Error() string {
+	return fmt.Sprintf("key for secrets in %s is not a hex encoded %d byte key", e.path, keySize)
+}
+
+func (e *ErrDecryptSecret) Error() string {
+	return fmt.Sprintf("secret could not be decrypted with the configured key: %s", e.path)
+}
+
+func (e *ErrSecretNotRegularFile) Error() string {
+	return fmt.Sprintf("only regular files can be encrypted: %s", e.path)
+}
+
+func (e *ErrPlaintextSecret) Error() string {
+	return fmt.Sprintf("sync was aborted because plaintext copies of secrets would be committed in '%s': %s. Remove them first",
+		e.directory, strings.Join(e.Files, ", "))
+}
+
+func (e *ErrHookFailed) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("hook '%s' failed: %v", e.Hook, e.Cause)
+	}
+	return fmt.Sprintf("hook '%s' failed: %v: %s", e.Hook, e.Cause, strings.TrimSpace(e.Output))
+}
+
+func (e *ErrHookFailed) Unwrap() error {
+	return e.Cause
+}
+
+func (e *ErrHookTimeout) Error() string {
+	return fmt.Sprintf("hook '%s' was killed after running for %s", e.Hook, e.Timeout)
+}
+
+func (e *ErrDistroNotFound) Error() string {
+	return fmt.Sprintf("distribution '%s' was not found", e.name)
+}
+
+func (e *ErrInvalidDistroName) Error() string {
+	return fmt.Sprintf("'%s' is not a valid name for a distribution", e.name)
+}
+
+func (e *ErrUpstreamNotFound) Error() string {
+	return fmt.Sprintf("branch '%s' in %s has no upstream. Either set 'remote' and 'branch' in the configuration or set an upstream using git branch --set-upstream-to", e.branch, e.directory)
 }
 
 func (e *ErrFileNotFound) Error() string {
@@ -62,6 +288,18 @@ func (e *ErrSymlinkNotFound) Error() string {
 	return fmt.Sprintf("file or directory was not a symlink at: %s", e.path)
 }
 
+func (e *ErrBackupNotFound) Error() string {
+	return fmt.Sprintf("backup generation was not found: %s", e.id)
+}
+
+func (e *ErrRollbackFailed) Error() string {
+	return fmt.Sprintf("%v: rollback failed, files may have to be restored from backup: %v", e.Cause, errors.Join(e.Failures...))
+}
+
+func (e *ErrRollbackFailed) Unwrap() error {
+	return e.Cause
+}
+
 /* Unexported */
 
 /* The errShellExec occurs if an unexpected error happens while executing a TermCommand in the shell. */
@@ -73,3 +311,15 @@ type errShellExec struct {
 func (e *errShellExec) Error() string {
 	return fmt.Sprintf("an error has occured executing '%s' in the shell: %s", e.command, e.output)
 }
+
+func (e *ErrAdoptTemplate) Error() string {
+	return fmt.Sprintf("a rendered template cannot be adopted, edit the template instead: %s", e.path)
+}
+
+func (e *ErrMalformedManifest) Error() string {
+	return fmt.Sprintf("malformed manifest %s: %s", e.path, e.reason)
+}
+
+func (e *ErrFileNotManaged) Error() string {
+	return fmt.Sprintf("file or directory is not managed by dotf: %s", e.path)
+}
@@ -2,6 +2,7 @@
 package terminalio
 
 import (
+	"bytes"
 	"os/exec"
 	"strings"
 
@@ -11,29 +12,19 @@ import (
 // termCommand is a command that can be executed in the shell.
 type termCommand string
 
-// commandReturn is the expected output to STDERR or STDOUT from executing a termCommand.
-type commandReturn string
-
-// Executes 'command' at 'path' and expects the result to contain one or more specific substrings
-// 'expected'. Returns a bool and an optional error. The bool depicts whether the result contains
-// any of the expected commandReturns. If the error is not nil then the boolean should be ignored.
-// Even if an error is returned the boolean will still describe whether the output from git
-// contained the expected.
-func executeWithResult(path string, command termCommand, expected ...commandReturn) (bool, error) {
-	result, err := execute(path, command)
-	var asExpected bool
-
-	for _, str := range expected {
-		if strings.Contains(result, string(str)) {
-			asExpected = true
-		}
-	}
-
-	if err != nil {
-		return asExpected, err
+// Executes a 'command' at 'path' that changes the repository or the remote. In dry-run mode the
+// command is only added to the plan of the operation and an empty output is returned.
+func (op *Operation) execute(path string, command termCommand) (string, error) {
+	if op.dryRun {
+		op.planStep("", false, "run '", command, "' in ", path)
+		return "", nil
 	}
+	return execute(path, command)
+}
 
-	return asExpected, nil
+// Quotes 's' so it is passed to the shell as a single argument.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 // Executes the termCommand in the given location 'path'.
@@ -58,3 +49,20 @@ func execute(path string, command termCommand) (string, error) {
 	}
 	return string(output), nil
 }
+
+// Executes the termCommand in the given location 'path' without showing it in the terminal.
+// Returns only what the command wrote to STDOUT, which makes it suitable for commands with machine
+// readable output. The exit code decides whether an error is returned.
+func query(path string, command termCommand) (string, error) {
+	execCmd := exec.Command("sh", "-c", string(command))
+	execCmd.Dir = path
+
+	var stderr bytes.Buffer
+	execCmd.Stderr = &stderr
+
+	output, err := execCmd.Output()
+	if err != nil {
+		return "", &errShellExec{command, stderr.String()}
+	}
+	return string(output), nil
+}
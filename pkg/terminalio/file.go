@@ -48,6 +48,19 @@ func CheckIfFileExists(absPath string) (bool, error) {
 	return true, nil
 }
 
+// Checks if a file, directory or symlink exists at the given path. Symlinks are not followed, which
+// means that also dangling symlinks are found.
+func checkIfPathExists(absPath string) (bool, error) {
+	_, err := os.Lstat(absPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // Finds common prefix of two already split strings. E.g. '/a/b/c' and '/a/b/c/d' gives 'a/b/c'.
 func FindCommonPathPrefix(path1, path2 string) (string, error) {
 	return findCommonPath(path1, path2, commonPrefixFinder)
@@ -157,6 +170,9 @@ func getFileLocationInfo(file, userspaceDir, dotfilesDir string) (info *fileLoca
 			return nil, err
 		}
 
+		// Templates and secrets are written into userspace without their suffix
+		userspaceFilepath = trimDotfileSuffix(userspaceFilepath)
+
 		info.userspaceFile = userspaceFilepath
 		info.dotfilesFile = absFile
 		info.insideDotfiles = true
@@ -168,6 +184,16 @@ func getFileLocationInfo(file, userspaceDir, dotfilesDir string) (info *fileLoca
 			return nil, err
 		}
 
+		// The file in userspace may be rendered from a template or decrypted from a secret
+		if exists, _ := checkIfPathExists(dotfilesFilepath); !exists {
+			for _, suffix := range []string{TemplateSuffix, SecretSuffix} {
+				if exists, _ := checkIfPathExists(dotfilesFilepath + suffix); exists {
+					dotfilesFilepath += suffix
+					break
+				}
+			}
+		}
+
 		info.userspaceFile = absFile
 		info.dotfilesFile = dotfilesFilepath
 		info.insideDotfiles = false
@@ -178,14 +204,14 @@ func getFileLocationInfo(file, userspaceDir, dotfilesDir string) (info *fileLoca
 	return
 }
 
-// Writes bytes to disk, overwriting file if it already exists.
-func writeFile(fpath string, contents []byte) error {
+// Writes bytes to disk with the permissions 'perm', overwriting file if it already exists.
+func writeFile(fpath string, contents []byte, perm os.FileMode) error {
 	absPath, err := getAbsolutePath(fpath)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(absPath, contents, 0644)
+	err = os.WriteFile(absPath, contents, perm)
 	if err != nil {
 		return err
 	}
@@ -196,40 +222,28 @@ func writeFile(fpath string, contents []byte) error {
 	return nil
 }
 
-// Backs up file and returns the path to the backed up version of the file. The given path should be
-// made absolute by the caller. The backed up file should not be expected to persist between reboots.
-func backupFile(file string) (string, error) {
-	const backupDir string = "/tmp/dotf-go/backups/"
-
-	logging.Info("Creating backup")
-
-	backupDst := filepath.Join(backupDir, file)
-	path, err := copyFileOrDir(file, backupDst)
-	if err != nil {
-		return "", err
-	}
-	return path, nil
-}
-
 // Will determine whether given 'src' points to a file or a directory and handle it accordingly. The
 // function copies src to dst without modifying src. Src should be either a file or directory and
-// dst should be a file path. Will copy directories recursively. Returns path to dst.
-func copyFileOrDir(src, dst string) (string, error) {
+// dst should be a file path. Will copy directories recursively leaving out paths ignored by
+// 'ignore'. Returns path to dst.
+func copyFileOrDir(src, dst string, ignore *IgnoreMatcher) (string, error) {
 	isDir, err := isDirectory(src)
 	if err != nil {
 		return "", fmt.Errorf("failed to determine if file was a directory: %w", err)
 	}
 
 	if isDir {
-		return copyDir(src, dst)
+		return copyDir(src, dst, ignore)
 	}
 
 	return copyFile(src, dst)
 }
 
 // Copies a directory and its contents recursively from src to dst and return the absolute path to
-// dst.
-func copyDir(src, dst string) (string, error) {
+// dst. Paths ignored by 'ignore', either at their location in src or in dst, are not copied.
+// Symlinks inside the directory are recreated with the same target instead of being followed. The
+// permissions, owner, timestamps and extended attributes of directories and files are preserved.
+func copyDir(src, dst string, ignore *IgnoreMatcher) (string, error) {
 	srcAbs, err := getAbsolutePath(src)
 	if err != nil {
 		return "", err
@@ -239,15 +253,28 @@ func copyDir(src, dst string) (string, error) {
 		return "", err
 	}
 
-	// Copy all files recursively
-	err = filepath.WalkDir(srcAbs, func(p string, d fs.DirEntry, err error) error {
-		newfilepath, err := replacePrefixPath(p, srcAbs, dstAbs)
+	// Metadata of directories is copied after their contents, as adding the contents changes the
+	// modification time and the permissions may not allow adding them.
+	var dirs []string
 
-		isDir, err := isDirectory(p)
+	// Copy all files recursively. The directory itself is followed if it is a symlink.
+	err = fs.WalkDir(os.DirFS(srcAbs), ".", func(rel string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if isDir {
+
+		p := filepath.Join(srcAbs, rel)
+		newfilepath := filepath.Join(dstAbs, rel)
+
+		if rel != "." && (ignore.Match(p, d.IsDir()) || ignore.Match(newfilepath, d.IsDir())) {
+			return skipEntry(d)
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			return copySymlink(p, newfilepath)
+		}
+		if d.IsDir() {
+			dirs = append(dirs, rel)
 			return os.MkdirAll(newfilepath, os.ModePerm)
 		}
 
@@ -258,6 +285,16 @@ func copyDir(src, dst string) (string, error) {
 
 		return nil
 	})
+	if err != nil {
+		return "", fmt.Errorf("failed to copy directory %s: %w", src, err)
+	}
+
+	// Children are handled before their parents
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := copyMetadata(filepath.Join(srcAbs, dirs[i]), filepath.Join(dstAbs, dirs[i])); err != nil {
+			return "", fmt.Errorf("failed to copy directory %s: %w", src, err)
+		}
+	}
 
 	logging.Ok("Directory successfully copied from", src, "->", dstAbs)
 
@@ -266,7 +303,8 @@ func copyDir(src, dst string) (string, error) {
 
 // Copies src to dst without modifying src. Both src and dst should be actual file paths, not
 // directories. The function uses absolute paths for both src and dst. Does not handle directories
-// and will fail. The path of the new file is returned.
+// and will fail. The permissions, owner, timestamps and extended attributes of src are preserved.
+// The path of the new file is returned.
 func copyFile(src, dst string) (string, error) {
 	srcAbs, err := getAbsolutePath(src)
 	if err != nil {
@@ -286,7 +324,9 @@ func copyFile(src, dst string) (string, error) {
 		return "", fmt.Errorf("failed to stat src file: %w", err)
 	}
 
-	fperm := fstat.Mode().Perm()
+	if !fstat.Mode().IsRegular() {
+		return "", fmt.Errorf("the src file is not a regular file: %s", srcAbs)
+	}
 
 	// Open src file
 	fsrc, err := os.Open(srcAbs)
@@ -324,10 +364,14 @@ func copyFile(src, dst string) (string, error) {
 		return "", fmt.Errorf("failed to copy src to dst: %w", err)
 	}
 
-	// Set permissions from src file
-	err = os.Chmod(dstAbs, fperm)
+	err = fdst.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to close dst: %w", err)
+	}
+
+	err = copyMetadata(srcAbs, dstAbs)
 	if err != nil {
-		return "", fmt.Errorf("failed to set permissions on dst file: %w", err)
+		return "", fmt.Errorf("failed to copy metadata to dst file: %w", err)
 	}
 
 	logging.Ok("File successfully copied from", src, "->", dstAbs)
@@ -336,6 +380,56 @@ func copyFile(src, dst string) (string, error) {
 	return dstAbs, nil
 }
 
+// Creates a symlink at 'dst' with the same target as the symlink at 'src'. Relative targets are kept
+// as they are, so they point into the copy if they pointed into the copied directory.
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("failed to read symlink: %w", err)
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	return copyOwner(info, dst)
+}
+
+// Gives the file or directory at 'dst' the permissions, owner, extended attributes and modification
+// time of 'src'. The access time is set to the modification time as well.
+func copyMetadata(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if err := copyOwner(info, dst); err != nil {
+		return fmt.Errorf("failed to set owner: %w", err)
+	}
+
+	attrs, err := readXattrs(src)
+	if err != nil {
+		return fmt.Errorf("failed to read extended attributes: %w", err)
+	}
+	if err := writeXattrs(dst, attrs); err != nil {
+		return fmt.Errorf("failed to set extended attributes: %w", err)
+	}
+
+	// Changing the owner clears the setuid and setgid bits, so permissions are set afterwards
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := os.Chmod(dst, mode); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to set modification time: %w", err)
+	}
+	return nil
+}
+
 // Replaces the shared prefix path in 'filepath' from that of 'fromdir' to that of 'todir'. It is
 // assumed that 'filepath' points to a file that is contained under 'fromdir'.
 // E.g. func("/a/b/c/d", "/a/b/", "/e/f/") -> "/e/f/c/d"
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mortenskoett/dotf-go/pkg/test"
@@ -160,7 +161,7 @@ func Test_writeFile(t *testing.T) {
 	expected := []byte("hello my friend\n")
 
 	t.Run("File is written successfully", func(t *testing.T) {
-		err := writeFile(file.Path, expected)
+		err := writeFile(file.Path, expected, 0644)
 		if err != nil {
 			t.Errorf("failed running code under test: %v", err)
 		}
@@ -177,25 +178,6 @@ func Test_writeFile(t *testing.T) {
 	})
 }
 
-func Test_backupFile_saves_file(t *testing.T) {
-	env := test.NewTestEnvironment()
-	defer env.Cleanup()
-
-	fileToBackup := env.UserspaceDir.AddTempFile().Path
-	expectedBackupPath := filepath.Join("/tmp/dotf-go/backups", fileToBackup)
-
-	actual, err := backupFile(fileToBackup)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer os.Remove(expectedBackupPath)
-
-	if expectedBackupPath != actual {
-		test.Fail(actual, expectedBackupPath, t)
-	}
-}
-
 func Test_copyFile_copies_file(t *testing.T) {
 	env := test.NewTestEnvironment()
 	defer env.Cleanup()
@@ -235,6 +217,61 @@ func Test_copyFile_copies_file(t *testing.T) {
 	}
 }
 
+func Test_copyFile_preserves_mode_and_modification_time(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	src := env.UserspaceDir.AddTempFile().Path
+	if err := os.Chmod(src, 0750); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := copyFile(src, filepath.Join(env.BackupDir.Path, "script"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(os.FileMode(0750), info.Mode().Perm(), t)
+	if !info.ModTime().Equal(mtime) {
+		test.FailMsg("modification time not preserved", info.ModTime(), mtime, t)
+	}
+}
+
+func Test_copyFile_preserves_extended_attributes(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	src := env.UserspaceDir.AddTempFile().Path
+	want := map[string][]byte{"user.dotf.test": []byte("value")}
+	if err := writeXattrs(src, want); err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := readXattrs(src); err != nil || len(attrs) == 0 {
+		t.Skip("extended attributes are not supported here")
+	}
+
+	dst, err := copyFile(src, filepath.Join(env.BackupDir.Path, "withattrs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := readXattrs(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("extended attributes differ:\n%s", diff)
+	}
+}
+
 func Test_replacePrefixPath_replaces_prefix_of_path(t *testing.T) {
 	file := "/dir1/dir2/file.txt"
 	from := "/userdir"
@@ -392,7 +429,7 @@ func Test_copyDir_copies_recursively_files_folders(t *testing.T) {
 
 	dst := env.BackupDir
 
-	res, err := copyDir(src.Path, dst.Path)
+	res, err := copyDir(src.Path, dst.Path, nil)
 	if err != nil {
 		test.Fail(err, "Should not fail here", t)
 	}
@@ -422,6 +459,80 @@ func Test_copyDir_copies_recursively_files_folders(t *testing.T) {
 	}
 }
 
+func Test_copyDir_preserves_nested_symlinks_and_metadata(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	src := env.UserspaceDir.AddTempDir("bin")
+	script := filepath.Join(src.Path, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("script", filepath.Join(src.Path, "relative")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/does/not/exist", filepath.Join(src.Path, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	linkedDir := env.UserspaceDir.AddTempDir("linked")
+	if err := os.Symlink(linkedDir.Path, filepath.Join(src.Path, "dir")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only directories can only be given their permissions once their contents are copied
+	sub := src.AddTempDir("sub")
+	sub.AddTempFile()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, dir := range []string{sub.Path, src.Path} {
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(sub.Path, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(sub.Path, 0755)
+
+	dst := filepath.Join(env.BackupDir.Path, "bin")
+	if _, err := copyDir(src.Path, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dst, "sub"), 0755)
+
+	for link, target := range map[string]string{
+		"relative": "script",
+		"dangling": "/does/not/exist",
+		"dir":      linkedDir.Path,
+	} {
+		have, err := os.Readlink(filepath.Join(dst, link))
+		if err != nil {
+			t.Fatalf("%s is not a symlink: %v", link, err)
+		}
+		test.AssertEqual(target, have, t)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "script"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(os.FileMode(0755), info.Mode().Perm(), t)
+
+	for _, dir := range []string{filepath.Join(dst, "sub"), dst} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			test.FailMsg("modification time not preserved for "+dir, info.ModTime(), mtime, t)
+		}
+	}
+	info, err = os.Stat(filepath.Join(dst, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(os.FileMode(0555), info.Mode().Perm(), t)
+}
+
 func Test_deleteDirectory_deletes_existing_directory(t *testing.T) {
 	env := test.NewTestEnvironment()
 	defer env.Cleanup()
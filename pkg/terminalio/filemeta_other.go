@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package terminalio
+
+import "os"
+
+// Ownership is not preserved on this platform.
+func copyOwner(src os.FileInfo, dst string) error {
+	return nil
+}
+
+// Extended attributes are not supported on this platform.
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// Extended attributes are not supported on this platform.
+func writeXattrs(path string, attrs map[string][]byte) error {
+	return nil
+}
@@ -0,0 +1,108 @@
+//go:build linux || darwin
+
+package terminalio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Gives 'dst' the owner and group of the file described by 'src'. Only privileged users can change
+// the owner of a file, so a lack of permission is not an error.
+func copyOwner(src os.FileInfo, dst string) error {
+	stat, ok := src.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	dstInfo, err := os.Lstat(dst)
+	if err != nil {
+		return err
+	}
+	if dstStat, ok := dstInfo.Sys().(*syscall.Stat_t); ok && dstStat.Uid == stat.Uid && dstStat.Gid == stat.Gid {
+		return nil
+	}
+
+	err = os.Lchown(dst, int(stat.Uid), int(stat.Gid))
+	if errors.Is(err, os.ErrPermission) {
+		return nil
+	}
+	return err
+}
+
+// Returns the extended attributes of the file at 'path'. No attributes are returned if the file
+// system does not support them.
+func readXattrs(path string) (map[string][]byte, error) {
+	names, err := xattrCall(func(buf []byte) (int, error) {
+		return unix.Listxattr(path, buf)
+	})
+	if err != nil {
+		if isXattrUnsupported(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := xattrCall(func(buf []byte) (int, error) {
+			return unix.Getxattr(path, string(name), buf)
+		})
+		if err != nil {
+			// The attribute may have been removed or be hidden from the current user
+			if errors.Is(err, unix.ENODATA) || errors.Is(err, os.ErrPermission) {
+				continue
+			}
+			return nil, err
+		}
+		attrs[string(name)] = value
+	}
+	return attrs, nil
+}
+
+// Sets the extended attributes 'attrs' on the file at 'path'. Attributes that the file system does
+// not support or that the current user is not allowed to set are left out.
+func writeXattrs(path string, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		err := unix.Setxattr(path, name, value, 0)
+		if err != nil && !isXattrUnsupported(err) && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls 'call' with a buffer large enough for the result. The call is first made with an empty
+// buffer to get the size of the result, which may grow before the second call is made.
+func xattrCall(call func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := call(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		size, err = call(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
+
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
@@ -1,123 +1,372 @@
 package terminalio
 
-import "github.com/mortenskoett/dotf-go/pkg/logging"
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+// SyncOptions configures which remote and branch the local repository is synced with. Empty values
+// are detected from the upstream of the currently checked out branch.
+type SyncOptions struct {
+	Remote         string             // Name of the git remote, e.g. origin
+	Branch         string             // Name of the branch on the remote, e.g. main
+	Resolve        ConflictResolution // How conflicting files are resolved when merging
+	DotfilesDir    string             // Used to show changed and conflicting files relative to dotfiles
+	UserspaceDir   string             // Used to map conflicting files back to userspace
+	CommitTemplate string             // Template for commit messages. DefaultCommitTemplate if empty.
+	Strategy       SyncStrategy       // How remote changes are integrated. MergeStrategy if nil.
+	Layers         Layers             // Dotfiles directories of copies synced with userspace. DotfilesDir if empty.
+}
+
+// Returns the dotfiles directories containing copies synced with userspace.
+func (o SyncOptions) copyLayers() Layers {
+	switch {
+	case o.UserspaceDir == "":
+		return nil
+	case len(o.Layers) > 0:
+		return o.Layers
+	case o.DotfilesDir != "":
+		return Layers{o.DotfilesDir}
+	}
+	return nil
+}
+
+// ConflictResolution selects which version of a file is kept if it conflicts while syncing.
+type ConflictResolution string
 
-// Git commands.
 const (
-	gitStatus     termCommand = "git status"
-	gitAddAll     termCommand = "git add ."
-	gitCommit     termCommand = "git commit -am 'Commit made from dotf-go'"
-	gitFetch      termCommand = "git fetch"
-	gitPullMerge  termCommand = "git merge origin/master -m 'Merge made by dotf-go'"
-	gitAbortMerge termCommand = "git merge --abort"
-	gitPush       termCommand = "git push origin master"
-	gitPull       termCommand = "git pull origin master"
+	ResolveNone   ConflictResolution = ""       // Conflicts abort the sync
+	ResolveOurs   ConflictResolution = "ours"   // Keep the local version of conflicting files
+	ResolveTheirs ConflictResolution = "theirs" // Keep the remote version of conflicting files
 )
 
-// Status returned by git. Case sensitive substring contained in the first line of the returns from
-// running commands with git version 2.32.0
+// Git commands.
 const (
-	allUpToDate      commandReturn = "Already up to date."
-	nothingToCommit  commandReturn = "nothing to commit, working tree clean"
-	mergeSuccess     commandReturn = "Merge made by"
-	pushSuccess      commandReturn = "master -> master"        // Something is making git push return only last line.
-	aheadOfOrigin    commandReturn = "Your branch is ahead of" // Essentially commits not pushed
+	gitStatus        termCommand = "git status --porcelain=v2 --branch"
+	gitAddAll        termCommand = "git add ."
+	gitAbortMerge    termCommand = "git merge --abort"
+	gitAbortRebase   termCommand = "git rebase --abort"
+	gitContinue      termCommand = "GIT_EDITOR=true git rebase --continue"
+	gitSkip          termCommand = "git rebase --skip"
+	gitCurrentBranch termCommand = "git symbolic-ref --short HEAD"
+	gitCountCommits  termCommand = "git rev-list --count HEAD"
+	gitConflicts     termCommand = "git diff --name-only --diff-filter=U -z"
+	gitCommitMerge   termCommand = "git commit --no-edit"
+	gitChangedFiles  termCommand = "git status --porcelain -z --untracked-files=all"
+	gitInsideTree    termCommand = "git rev-parse --is-inside-work-tree"
 )
 
-// SyncLocalRemote uses Git to update local and remote repository with newest changes from either
-// place. The given path 'absPathToLocalRepo' must point to a directory initialized with git and
-// with push/pull abilities to a remote. If it is not possible to merge changes or if a command
-// fails in the shell, an error will be returned.
-func SyncLocalRemote(repoPath string) error {
-	logging.Info("Syncing", repoPath, "with remote")
+// Git commands parameterized by remote and branch.
+func gitFetch(remote string) termCommand {
+	return termCommand(fmt.Sprintf("git fetch %s", quote(remote)))
+}
+
+func gitMerge(remote, branch string) termCommand {
+	return termCommand(fmt.Sprintf("git merge %s -m 'Merge made by dotf-go'", quote(remote+"/"+branch)))
+}
+
+func gitRebase(remote, branch string) termCommand {
+	return termCommand(fmt.Sprintf("git rebase %s", quote(remote+"/"+branch)))
+}
+
+func gitPush(remote, branch string) termCommand {
+	return termCommand(fmt.Sprintf("git push %s %s", quote(remote), quote("HEAD:"+branch)))
+}
+
+func gitVerifyRef(remote, branch string) termCommand {
+	return termCommand(fmt.Sprintf("git rev-parse --verify --quiet %s", quote("refs/remotes/"+remote+"/"+branch)))
+}
+
+func gitCountAheadBehind(remote, branch string) termCommand {
+	return termCommand(fmt.Sprintf("git rev-list --left-right --count %s", quote("HEAD..."+remote+"/"+branch)))
+}
+
+func gitCommit(message string) termCommand {
+	return termCommand(fmt.Sprintf("git commit -m %s", quote(message)))
+}
+
+func gitCheckout(side ConflictResolution, file string) termCommand {
+	return termCommand(fmt.Sprintf("git checkout --%s -- %s", side, quote(file)))
+}
+
+func gitAdd(file string) termCommand {
+	return termCommand(fmt.Sprintf("git add -- %s", quote(file)))
+}
+
+func gitRemove(file string) termCommand {
+	return termCommand(fmt.Sprintf("git rm --quiet -- %s", quote(file)))
+}
+
+func gitRemoteURL(remote string) termCommand {
+	return termCommand(fmt.Sprintf("git remote get-url %s", quote(remote)))
+}
+
+func gitConfigGet(key string) termCommand {
+	return termCommand(fmt.Sprintf("git config --get %s", quote(key)))
+}
 
-	_, err := execute(repoPath, gitFetch)
+// SyncLocalRemote uses Git to update local and remote repository with newest changes from either
+// place. The given path 'repoPath' must point to a directory initialized with git and with
+// push/pull abilities to a remote. Remote changes are integrated using the strategy given by
+// 'opts'. If it is not possible to integrate changes or if a command fails in the shell, an error
+// will be returned. Conflicting files are either reported in an ErrMergeConflict or resolved as
+// given by 'opts'. Commands that change the repository or talk to the remote are run as part of
+// 'op', so in dry-run mode they are only planned.
+//
+// Dotfiles installed by copying them according to the manifest of 'op' are synced in both
+// directions: copies modified in userspace are copied into dotfiles before committing, and dotfiles
+// changed after their copy, e.g. by the remote, are copied into userspace afterwards.
+func SyncLocalRemote(op *Operation, repoPath string, opts SyncOptions) error {
+	opts, err := resolveSyncOptions(repoPath, opts)
 	if err != nil {
 		return err
 	}
+	remote, branch := opts.Remote, opts.Branch
 
-	// Push commits ahead of origin
+	logging.Info("Syncing", repoPath, "with", remote+"/"+branch)
 
-	aheadWithcommitsToPush, err := executeWithResult(repoPath, gitStatus, aheadOfOrigin)
+	// In dry-run mode the plan is made from the remote branch as it was last fetched
+	if _, err := op.execute(repoPath, gitFetch(remote)); err != nil {
+		return err
+	}
+
+	// Changes made to copies in userspace are committed along with the other changes. They are kept
+	// even if the sync fails later, as undoing them would make the copies look outdated.
+	if err := collectCopies(op, opts.UserspaceDir, opts.copyLayers()); err != nil {
+		return err
+	}
+	op.Commit()
+
+	state, err := GetRepositoryState(repoPath, opts)
 	if err != nil {
 		return err
 	}
 
-	if aheadWithcommitsToPush {
-		_, err := execute(repoPath, gitPush)
-		if err != nil {
+	// A merge left unresolved must be finished first
+	if state.HasConflicts() {
+		if opts.Resolve == ResolveNone {
+			return &ErrUnresolvedConflicts{repoPath}
+		}
+		if err := resolveConflicts(op, repoPath, opts.Resolve); err != nil {
+			return err
+		}
+		if state, err = GetRepositoryState(repoPath, opts); err != nil {
 			return err
 		}
 	}
 
-	// No local changes we can pull and exit
-	hasNoLocalChanges, err := executeWithResult(repoPath, gitStatus, nothingToCommit)
-	if err != nil {
+	// Local changes are committed so they can be merged with the remote
+	ahead := state.Ahead
+	if state.HasLocalChanges() {
+		if err := addCommitAll(op, repoPath, opts); err != nil {
+			return err
+		}
+		ahead++
+	}
+
+	if state.Behind > 0 {
+		strategy := opts.Strategy
+		if strategy == nil {
+			strategy = MergeStrategy{}
+		}
+		if err := strategy.Integrate(op, repoPath, opts); err != nil {
+			return err
+		}
+	}
+
+	if err := refreshCopies(op, opts.UserspaceDir, opts.copyLayers()); err != nil {
 		return err
 	}
-	if hasNoLocalChanges {
-		if _, err = execute(repoPath, gitPull); err != nil {
+
+	if ahead > 0 {
+		if _, err := op.execute(repoPath, gitPush(remote, branch)); err != nil {
 			return err
 		}
-		return nil
 	}
 
-	// There are changes staged or unstaged local changes
-	err = addCommitAll(repoPath)
+	return nil
+}
+
+// Stages everything and creates a combined commit with a message listing the changed files.
+func addCommitAll(op *Operation, path string, opts SyncOptions) error {
+	status, err := query(path, gitChangedFiles)
 	if err != nil {
 		return err
 	}
+	files := parseChangedFiles(status)
+
+	// Secrets are only ever committed encrypted
+	if plaintext := plaintextSecrets(path, files); len(plaintext) > 0 {
+		return &ErrPlaintextSecret{path, plaintext}
+	}
 
-	err = pullMerge(repoPath)
+	message, err := generateCommitMessage(
+		opts.CommitTemplate, op.command, path, opts.DotfilesDir, files)
 	if err != nil {
 		return err
 	}
 
-	expected := pushSuccess
-	found, err := executeWithResult(repoPath, gitPush, expected)
+	_, err = op.execute(path, gitAddAll)
 	if err != nil {
 		return err
 	}
 
-	if !found {
-		return &ErrUnmatchedShellReturn{gitPush, []commandReturn{expected}}
+	_, err = op.execute(path, gitCommit(message))
+	if err != nil {
+		return err
 	}
-
 	return nil
 }
 
-// Simply stages everything and creates a combined commit.
-func addCommitAll(path string) error {
-	_, err := execute(path, gitAddAll)
-	if err != nil {
+// Resolves every conflicting file in the merge in progress by keeping the version given by
+// 'resolution' and commits the merge.
+func resolveConflicts(op *Operation, path string, resolution ConflictResolution) error {
+	if err := resolveConflictingFiles(op, path, resolution); err != nil {
 		return err
 	}
 
-	_, err = execute(path, gitCommit)
+	_, err := op.execute(path, gitCommitMerge)
+	return err
+}
+
+// Resolves every conflicting file by checking out the version from 'side' and staging it.
+func resolveConflictingFiles(op *Operation, path string, side ConflictResolution) error {
+	conflicts, err := conflictingFiles(path)
 	if err != nil {
 		return err
 	}
+
+	for _, file := range conflicts {
+		// A version removed on the chosen side is resolved by removing the file
+		if _, err := op.execute(path, gitCheckout(side, file)); err != nil {
+			if _, err := op.execute(path, gitRemove(file)); err != nil {
+				return err
+			}
+		} else if _, err := op.execute(path, gitAdd(file)); err != nil {
+			return err
+		}
+		logging.Info("Resolved conflict in", file, "using", string(side), "version")
+	}
 	return nil
 }
 
-// Pulls latest and attempts a merge if possible otherwise reverts the merge and returns an error.
-func pullMerge(path string) error {
-	_, err := execute(path, gitFetch)
-	if err != nil {
-		return err
+// Returns the conflicting files in the repository at 'path' mapped to their location in userspace.
+func mapConflicts(path string, conflicts []string, opts SyncOptions) []MergeConflict {
+	mapped := make([]MergeConflict, 0, len(conflicts))
+	for _, file := range conflicts {
+		mapped = append(mapped, mapConflict(path, file, opts))
 	}
+	return mapped
+}
 
-	success, err := executeWithResult(path, gitPullMerge, mergeSuccess, allUpToDate)
+// Returns the paths relative to the repository root of files with unresolved conflicts.
+func conflictingFiles(path string) ([]string, error) {
+	output, err := query(path, gitConflicts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !success {
-		_, err = execute(path, gitAbortMerge)
-		if err != nil {
-			return &ErrMergeFail{path}
+	var files []string
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
 		}
 	}
+	return files, nil
+}
 
-	return nil
+// Maps a conflicting 'file' relative to the repository at 'repoPath' to its location in userspace.
+// Files outside the dotfiles directory, e.g. of other distributions, have no userspace location.
+func mapConflict(repoPath, file string, opts SyncOptions) MergeConflict {
+	conflict := MergeConflict{File: file}
+	if opts.DotfilesDir == "" || opts.UserspaceDir == "" {
+		return conflict
+	}
+
+	absFile := filepath.Join(repoPath, file)
+	absDotfilesDir, err := getAbsolutePath(opts.DotfilesDir)
+	if err != nil {
+		return conflict
+	}
+
+	rel, err := filepath.Rel(absDotfilesDir, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return conflict
+	}
+
+	if userspaceFile, err := replacePrefixPath(absFile, absDotfilesDir, opts.UserspaceDir); err == nil {
+		conflict.UserspaceFile = userspaceFile
+	}
+	return conflict
+}
+
+// IsGitRepository returns true if 'path' is inside a git working tree.
+func IsGitRepository(path string) bool {
+	output, err := query(path, gitInsideTree)
+	return err == nil && strings.TrimSpace(output) == "true"
+}
+
+// ResolveSyncOptions returns 'opts' with the remote and branch filled in from the upstream of the
+// currently checked out branch in the repository at 'path' if they are missing. An
+// ErrUpstreamNotFound is returned if there is no upstream.
+func ResolveSyncOptions(path string, opts SyncOptions) (SyncOptions, error) {
+	return resolveSyncOptions(path, opts)
+}
+
+// HasRemote returns true if the repository at 'path' has a remote named 'remote'.
+func HasRemote(path, remote string) bool {
+	_, err := query(path, gitRemoteURL(remote))
+	return err == nil
+}
+
+// HasRemoteBranch returns true if the branch 'branch' of 'remote' has been fetched into the
+// repository at 'path'.
+func HasRemoteBranch(path, remote, branch string) bool {
+	_, err := query(path, gitVerifyRef(remote, branch))
+	return err == nil
+}
+
+// Fills in the remote and branch missing from 'opts' using the upstream of the currently checked
+// out branch in the repository at 'path'.
+func resolveSyncOptions(path string, opts SyncOptions) (SyncOptions, error) {
+	if opts.Remote != "" && opts.Branch != "" {
+		return opts, nil
+	}
+
+	remote, branch, err := detectUpstream(path)
+	if err != nil {
+		return opts, err
+	}
+
+	if opts.Remote == "" {
+		opts.Remote = remote
+	}
+	if opts.Branch == "" {
+		opts.Branch = branch
+	}
+	return opts, nil
+}
+
+// Returns the remote and the branch on the remote that the current branch at 'path' tracks.
+func detectUpstream(path string) (remote, branch string, err error) {
+	current, err := query(path, gitCurrentBranch)
+	if err != nil {
+		return "", "", err
+	}
+	current = strings.TrimSpace(current)
+
+	remote, err = query(path, gitConfigGet("branch."+current+".remote"))
+	if err != nil {
+		return "", "", &ErrUpstreamNotFound{path, current}
+	}
+
+	merge, err := query(path, gitConfigGet("branch."+current+".merge"))
+	if err != nil {
+		return "", "", &ErrUpstreamNotFound{path, current}
+	}
+
+	return strings.TrimSpace(remote), strings.TrimPrefix(strings.TrimSpace(merge), "refs/heads/"), nil
 }
@@ -0,0 +1,102 @@
+package terminalio
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_mapConflict_maps_files_in_dotfiles_dir_to_userspace(t *testing.T) {
+	opts := SyncOptions{DotfilesDir: "/repo/host", UserspaceDir: "/home/user"}
+
+	for _, tc := range []struct {
+		file     string
+		expected string
+	}{
+		{"host/.config/nvim/init.lua", "/home/user/.config/nvim/init.lua"},
+		{"otherhost/.bashrc", ""},
+		{"hostname/.zshrc", ""},
+	} {
+		actual := mapConflict("/repo", tc.file, opts)
+		if actual.File != tc.file || actual.UserspaceFile != tc.expected {
+			test.Fail(actual, MergeConflict{tc.file, tc.expected}, t)
+		}
+	}
+}
+
+func Test_SyncLocalRemote_in_dry_run_mode_does_not_fetch(t *testing.T) {
+	remote := newTestRemote(t)
+	local := cloneTestRemote(t, remote)
+	other := cloneTestRemote(t, remote)
+
+	commitTestFile(t, other, ".zshrc", "export EDITOR=vim\n")
+	runGit(t, other, "push", "--quiet", "origin", "main")
+
+	before := runGit(t, local, "rev-parse", "origin/main")
+
+	op := NewOperation("sync", OperationOptions{BackupDir: t.TempDir(), DryRun: true})
+	if err := SyncLocalRemote(op, local, SyncOptions{}); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	test.AssertEqual(before, runGit(t, local, "rev-parse", "origin/main"), t)
+	if !strings.Contains(strings.Join(op.Plan(), "\n"), "git fetch") {
+		test.Fail(op.Plan(), "fetch should be a planned step", t)
+	}
+}
+
+// Creates a bare repository with a single commit on 'main' to be used as remote.
+func newTestRemote(t *testing.T) string {
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, "", "init", "--quiet", "--bare", "--initial-branch=main", remote)
+
+	seed := filepath.Join(t.TempDir(), "seed")
+	runGit(t, "", "clone", "--quiet", remote, seed)
+	configureTestRepo(t, seed)
+	commitTestFile(t, seed, "README", "dotfiles\n")
+	runGit(t, seed, "push", "--quiet", "origin", "HEAD:main")
+	return remote
+}
+
+// Clones 'remote' as if on another machine and returns the path to the clone.
+func cloneTestRemote(t *testing.T, remote string) string {
+	clone := filepath.Join(t.TempDir(), "clone")
+	runGit(t, "", "clone", "--quiet", "--branch=main", remote, clone)
+	configureTestRepo(t, clone)
+	return clone
+}
+
+func configureTestRepo(t *testing.T, repo string) {
+	runGit(t, repo, "config", "user.name", "dotf")
+	runGit(t, repo, "config", "user.email", "dotf@example.com")
+	runGit(t, repo, "config", "commit.gpgsign", "false")
+}
+
+// Writes 'contents' to 'name' in 'repo' and commits it.
+func commitTestFile(t *testing.T, repo, name, contents string) {
+	path := filepath.Join(repo, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "add", "--", name)
+	runGit(t, repo, "commit", "--quiet", "-m", "Change "+name)
+}
+
+// Runs git with 'args' in 'dir' and returns its trimmed output. The test fails if git fails.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,147 @@
+package terminalio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RepositoryState describes a local git repository compared to the remote branch it is synced with.
+// It is read from the machine readable output of git and does not depend on the language or the
+// version of git.
+type RepositoryState struct {
+	Branch     string      // Checked out branch. Empty if HEAD is detached.
+	Upstream   SyncOptions // Remote branch the repository is compared to
+	Ahead      int         // Local commits missing on the remote branch
+	Behind     int         // Commits on the remote branch missing locally
+	Changed    int         // Tracked files with staged or unstaged changes
+	Untracked  int         // Files not tracked by git
+	Conflicted int         // Files with unresolved merge conflicts
+}
+
+// HasLocalChanges returns true if there are changes that have not been committed.
+func (s *RepositoryState) HasLocalChanges() bool {
+	return s.Changed > 0 || s.Untracked > 0 || s.Conflicted > 0
+}
+
+// HasConflicts returns true if a merge has left conflicts that must be resolved by the user.
+func (s *RepositoryState) HasConflicts() bool {
+	return s.Conflicted > 0
+}
+
+// InSync returns true if the local repository and the remote branch contain the same changes.
+func (s *RepositoryState) InSync() bool {
+	return !s.HasLocalChanges() && s.Ahead == 0 && s.Behind == 0
+}
+
+func (s *RepositoryState) String() string {
+	if s.InSync() {
+		return "in sync"
+	}
+
+	var parts []string
+	for _, c := range []struct {
+		count int
+		name  string
+	}{
+		{s.Ahead, "ahead"},
+		{s.Behind, "behind"},
+		{s.Changed, "changed"},
+		{s.Untracked, "untracked"},
+		{s.Conflicted, "conflicted"},
+	} {
+		if c.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.count, c.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetRepositoryState reads the state of the repository at 'repoPath' compared to the remote branch
+// given by 'opts'. The remote is not fetched, so the state is only as recent as the last fetch.
+func GetRepositoryState(repoPath string, opts SyncOptions) (*RepositoryState, error) {
+	opts, err := resolveSyncOptions(repoPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := query(repoPath, gitStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := parsePorcelainStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	state.Upstream = opts
+
+	// A remote branch that does not exist yet is missing every local commit.
+	if _, err := query(repoPath, gitVerifyRef(opts.Remote, opts.Branch)); err != nil {
+		count, err := query(repoPath, gitCountCommits)
+		if err != nil {
+			return nil, err
+		}
+		state.Ahead, err = strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse number of commits: %w", err)
+		}
+		return state, nil
+	}
+
+	counts, err := query(repoPath, gitCountAheadBehind(opts.Remote, opts.Branch))
+	if err != nil {
+		return nil, err
+	}
+
+	state.Ahead, state.Behind, err = parseAheadBehind(counts)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Parses the output of 'git status --porcelain=v2 --branch'. See git-status(1) for the format.
+func parsePorcelainStatus(output string) (*RepositoryState, error) {
+	state := &RepositoryState{}
+
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case '#':
+			if head, ok := strings.CutPrefix(line, "# branch.head "); ok && head != "(detached)" {
+				state.Branch = head
+			}
+		case '1', '2':
+			state.Changed++
+		case 'u':
+			state.Conflicted++
+		case '?':
+			state.Untracked++
+		case '!':
+			// Ignored files
+		default:
+			return nil, fmt.Errorf("unknown line in git status output: %s", line)
+		}
+	}
+	return state, nil
+}
+
+// Parses the output of 'git rev-list --left-right --count HEAD...<remote>/<branch>'.
+func parseAheadBehind(output string) (ahead, behind int, err error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected output from git rev-list: %s", output)
+	}
+
+	if ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse number of commits ahead: %w", err)
+	}
+	if behind, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse number of commits behind: %w", err)
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,113 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_parsePorcelainStatus_counts_changes(t *testing.T) {
+	output := `# branch.oid 1a885664b2bd3c5c2c11c8e7a4fb38b0c4b0e1c4
+# branch.head main
+# branch.upstream origin/main
+# branch.ab +1 -2
+1 .M N... 100644 100644 100644 3b18e512dba79e4c8300dd08aeb37f8e728b8dad 3b18e512dba79e4c8300dd08aeb37f8e728b8dad .bashrc
+1 A. N... 000000 100644 100644 0000000000000000000000000000000000000000 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 .vimrc
+2 R. N... 100644 100644 100644 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 R100 .config/new	.config/old
+u UU N... 100644 100644 100644 100644 3b18e512dba79e4c8300dd08aeb37f8e728b8dad 3b18e512dba79e4c8300dd08aeb37f8e728b8dad 3b18e512dba79e4c8300dd08aeb37f8e728b8dad .zshrc
+? notes.txt
+! build/
+`
+
+	actual, err := parsePorcelainStatus(output)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	expected := &RepositoryState{Branch: "main", Changed: 3, Untracked: 1, Conflicted: 1}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %s", actual, expected, diff)
+	}
+}
+
+func Test_parsePorcelainStatus_detached_head_has_no_branch(t *testing.T) {
+	actual, err := parsePorcelainStatus("# branch.oid 1a88566\n# branch.head (detached)\n")
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	if actual.Branch != "" {
+		test.Fail(actual.Branch, "", t)
+	}
+	if !actual.InSync() {
+		test.Fail(actual, "Clean repository should be in sync", t)
+	}
+}
+
+func Test_parseAheadBehind(t *testing.T) {
+	ahead, behind, err := parseAheadBehind("3\t5\n")
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if ahead != 3 || behind != 5 {
+		test.Fail([]int{ahead, behind}, []int{3, 5}, t)
+	}
+
+	if _, _, err := parseAheadBehind("fatal: bad revision\n"); err == nil {
+		test.Fail(err, "Malformed output should give an error", t)
+	}
+}
+
+func Test_GetRepositoryState_reads_real_repository(t *testing.T) {
+	remote := newTestRemote(t)
+	local := cloneTestRemote(t, remote)
+	other := cloneTestRemote(t, remote)
+
+	commitTestFile(t, other, ".zshrc", "export EDITOR=vim\n")
+	runGit(t, other, "push", "--quiet", "origin", "main")
+	runGit(t, local, "fetch", "--quiet", "origin")
+
+	commitTestFile(t, local, ".zshrc", "export EDITOR=nvim\n")
+	if err := os.WriteFile(filepath.Join(local, "README"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(local, ".vimrc"), []byte("set number\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := GetRepositoryState(local, SyncOptions{})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	expected := &RepositoryState{
+		Branch:    "main",
+		Upstream:  SyncOptions{Remote: "origin", Branch: "main"},
+		Ahead:     1,
+		Behind:    1,
+		Changed:   1,
+		Untracked: 1,
+	}
+	if diff := cmp.Diff(state, expected); diff != "" {
+		t.Errorf("have: %+v\nwant: %+v\ndiff: %s", state, expected, diff)
+	}
+
+	// Both sides changed .zshrc, so merging leaves it conflicted
+	runGit(t, local, "checkout", "--quiet", "--", "README")
+	if err := os.Remove(filepath.Join(local, ".vimrc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execute(local, gitMerge("origin", "main")); err == nil {
+		t.Fatal("merge should have failed with conflicts")
+	}
+
+	state, err = GetRepositoryState(local, SyncOptions{})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual(1, state.Conflicted, t)
+	test.AssertEqual(true, state.HasConflicts(), t)
+}
@@ -0,0 +1,136 @@
+package terminalio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+// HookStage tells whether a hook runs before or after a command.
+type HookStage string
+
+const (
+	HookPre  HookStage = "pre"  // Runs before the command. A failure aborts the command.
+	HookPost HookStage = "post" // Runs after the command has succeeded.
+)
+
+// DefaultHookTimeout is how long a hook may run if no timeout is configured.
+const DefaultHookTimeout = 30 * time.Second
+
+// Time given to a killed hook to release its output before it is abandoned.
+const hookWaitDelay = time.Second
+
+// HookOptions configures where hooks are found and how they are run.
+type HookOptions struct {
+	Dir          string        // Directory containing executables named <stage>-<command>
+	Timeout      time.Duration // How long a hook may run. DefaultHookTimeout if zero.
+	UserspaceDir string        // Passed to hooks as DOTF_USERSPACE_DIR
+	DotfilesDir  string        // Passed to hooks as DOTF_DOTFILES_DIR
+	SyncDir      string        // Passed to hooks as DOTF_SYNC_DIR and used as working directory
+}
+
+// Hooks runs the executables in a hooks directory before and after dotf commands, e.g. a hook named
+// 'post-install' runs after every successful install.
+type Hooks struct {
+	opts HookOptions
+}
+
+func NewHooks(opts HookOptions) *Hooks {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultHookTimeout
+	}
+	return &Hooks{opts: opts}
+}
+
+// Returns the name of the hook running at 'stage' of 'command'.
+func hookName(stage HookStage, command string) string {
+	return string(stage) + "-" + command
+}
+
+// Run runs the hook at 'stage' of 'command' if it exists. The affected 'paths' are passed to the
+// hook in DOTF_PATHS separated by newlines. Hooks that are not executable are skipped with a
+// warning. In dry-run mode the hook is only added to the plan of 'op'.
+func (h *Hooks) Run(op *Operation, stage HookStage, command string, paths []string) error {
+	if h == nil || h.opts.Dir == "" {
+		return nil
+	}
+
+	name := hookName(stage, command)
+	path := filepath.Join(expandTilde(h.opts.Dir), name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		logging.Warn("Skipping hook that is not executable:", path)
+		return nil
+	}
+
+	if op.dryRun {
+		op.planStep("", false, "run hook ", path)
+		return nil
+	}
+
+	return h.run(name, path, command, paths)
+}
+
+// Runs the hook at 'path' directly without a shell and kills it when the timeout is exceeded.
+func (h *Hooks) run(name, path, command string, paths []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.Timeout)
+	defer cancel()
+
+	execCmd := exec.CommandContext(ctx, path)
+	execCmd.Dir = h.workDir()
+	execCmd.WaitDelay = hookWaitDelay
+	execCmd.Env = append(os.Environ(),
+		"DOTF_HOOK="+name,
+		"DOTF_COMMAND="+command,
+		"DOTF_PATHS="+strings.Join(paths, "\n"),
+		"DOTF_USERSPACE_DIR="+h.opts.UserspaceDir,
+		"DOTF_DOTFILES_DIR="+h.opts.DotfilesDir,
+		"DOTF_SYNC_DIR="+h.opts.SyncDir,
+	)
+
+	var output bytes.Buffer
+	execCmd.Stdout = &output
+	execCmd.Stderr = &output
+
+	logging.Info("Running hook", logging.Color(name, logging.Yellow))
+	err := execCmd.Run()
+	if output.Len() != 0 {
+		logging.Info(logging.Color(output.String(), logging.Green))
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return &ErrHookTimeout{Hook: name, Timeout: h.opts.Timeout}
+	}
+	if err != nil {
+		return &ErrHookFailed{Hook: name, Output: output.String(), Cause: err}
+	}
+	return nil
+}
+
+// Returns the directory hooks are run in. The sync directory if it exists and otherwise the hooks
+// directory itself.
+func (h *Hooks) workDir() string {
+	if h.opts.SyncDir != "" {
+		if exists, _ := checkIfPathExists(h.opts.SyncDir); exists {
+			return h.opts.SyncDir
+		}
+	}
+	return expandTilde(h.opts.Dir)
+}
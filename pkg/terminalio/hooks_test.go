@@ -0,0 +1,101 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+// Writes an executable hook script with the given 'body' into 'dir'.
+func writeHook(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Hooks_Run_passes_paths_in_environment(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+	writeHook(t, dir, "post-install", `printf '%s|%s|%s' "$DOTF_HOOK" "$DOTF_COMMAND" "$DOTF_PATHS" > `+out+"\n")
+
+	hooks := NewHooks(HookOptions{Dir: dir})
+	if err := hooks.Run(newTestOperation(t), HookPost, "install", []string{"/a", "/b"}); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	contents, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual("post-install|install|/a\n/b", string(contents), t)
+
+	// Hooks of other commands do not exist
+	if err := hooks.Run(newTestOperation(t), HookPre, "install", nil); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+}
+
+func Test_Hooks_Run_fails_with_typed_errors(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, "pre-add", "echo refusing\nexit 3\n")
+	writeHook(t, dir, "pre-sync", "sleep 5\n")
+
+	hooks := NewHooks(HookOptions{Dir: dir, Timeout: 100 * time.Millisecond})
+
+	err := hooks.Run(newTestOperation(t), HookPre, "add", nil)
+	failed, ok := err.(*ErrHookFailed)
+	if !ok {
+		test.FailHard(err, &ErrHookFailed{}, t)
+	}
+	test.AssertEqual("refusing", strings.TrimSpace(failed.Output), t)
+
+	start := time.Now()
+	err = hooks.Run(newTestOperation(t), HookPre, "sync", nil)
+	if _, ok := err.(*ErrHookTimeout); !ok {
+		test.FailHard(err, &ErrHookTimeout{}, t)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("hook was not killed in time: %s", time.Since(start))
+	}
+}
+
+func Test_Hooks_Run_skips_hooks_in_dry_run(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, "pre-add", "exit 1\n")
+
+	op := NewOperation("add", OperationOptions{BackupDir: t.TempDir(), DryRun: true})
+	if err := NewHooks(HookOptions{Dir: dir}).Run(op, HookPre, "add", nil); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual(1, len(op.Plan()), t)
+}
+
+func Test_Operation_Commit_collects_changed_paths(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := newTestOperation(t)
+	dotfile := env.DotfilesDir.AddTempFile().Path
+	link := filepath.Join(env.UserspaceDir.Path, "nested", "link")
+
+	if err := op.mkdirAll(filepath.Dir(link)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.createSymlink(link, dotfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.updateSymlink(link, dotfile); err != nil {
+		t.Fatal(err)
+	}
+	op.Commit()
+
+	if diff := cmp.Diff([]string{link}, op.Changed()); diff != "" {
+		t.Errorf("unexpected changed paths: %s", diff)
+	}
+}
@@ -0,0 +1,332 @@
+package terminalio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files containing patterns of paths that dotf leaves out.
+const IgnoreFileName = ".dotfignore"
+
+// Paths that are always ignored, as they belong to git or dotf itself.
+var defaultIgnorePatterns = []string{".git", IgnoreFileName, VarsFileName}
+
+// Escapes names so they only match themselves when used as a pattern.
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// An IgnoreMatcher decides which paths are left out when dotf walks or copies a directory tree. The
+// patterns follow the format of gitignore:
+//
+//   - Blank lines and lines starting with '#' are skipped.
+//   - A pattern starting with '!' includes a path again that was excluded by an earlier pattern.
+//   - A pattern ending with '/' only matches directories.
+//   - A pattern containing a '/' anywhere else is matched against the path relative to the
+//     directory of the ignore file. Otherwise it is matched against the name of the path at any
+//     depth.
+//   - '*', '?' and '[]' match within a single path component, '**' matches any number of them.
+//
+// The last matching pattern decides whether a path is ignored. Everything inside an ignored
+// directory is ignored as well. A nil IgnoreMatcher ignores nothing.
+type IgnoreMatcher struct {
+	rules []*ignoreRule
+}
+
+// An ignoreRule is a single pattern and the directories it is relative to.
+type ignoreRule struct {
+	bases    []string // Absolute directories the pattern is relative to. The first containing a path is used.
+	segments []string // Pattern split into path components
+	negate   bool     // Whether a match includes the path again
+	dirOnly  bool     // Whether the pattern only matches directories
+	anchored bool     // Whether the pattern is matched against the full relative path
+}
+
+// NewIgnoreMatcher returns a matcher of 'patterns' relative to the directories 'bases'. Paths are
+// matched relative to the first of 'bases' containing them.
+func NewIgnoreMatcher(bases []string, patterns ...string) *IgnoreMatcher {
+	m := &IgnoreMatcher{}
+	m.add(absoluteBases(bases), patterns)
+	return m
+}
+
+// LoadIgnoreMatcher reads the ignore files found in 'syncDir' and in the dotfiles directory, which
+// is the most specific of 'layers'. The patterns of the dotfiles directory apply to every layer and
+// to the equal locations in userspace, so files are also left out when added from userspace. Missing
+// ignore files are skipped.
+func LoadIgnoreMatcher(syncDir, userspaceDir string, layers Layers) (*IgnoreMatcher, error) {
+	dotfilesBases := absoluteBases(append(append([]string{}, layers...), userspaceDir))
+	syncBases := absoluteBases([]string{syncDir})
+
+	m := &IgnoreMatcher{}
+	m.add(append(append([]string{}, dotfilesBases...), syncBases...), defaultIgnorePatterns)
+
+	if len(syncBases) > 0 {
+		if err := m.addIgnoreFile(syncBases[0], syncBases); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(layers) > 0 && layers[len(layers)-1] != "" {
+		dotfilesDir, err := getAbsolutePath(layers[len(layers)-1])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.addIgnoreFile(dotfilesDir, dotfilesBases); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Exclude adds 'paths' to the matcher, so they are ignored together with everything below them. Used
+// for files and directories of dotf itself that may be placed inside the dotfiles directory.
+func (m *IgnoreMatcher) Exclude(paths ...string) {
+	for _, p := range absoluteBases(paths) {
+		m.rules = append(m.rules, &ignoreRule{
+			bases:    []string{filepath.Dir(p)},
+			segments: []string{globEscaper.Replace(filepath.Base(p))},
+			anchored: true,
+		})
+	}
+}
+
+// Returns a copy of the matcher that also applies the default patterns and the ignore file of
+// 'dotfilesDir' to it and to 'userspaceDir'. Used for dotfiles directories other than the
+// configured one.
+func (m *IgnoreMatcher) withDotfilesDir(dotfilesDir, userspaceDir string) (*IgnoreMatcher, error) {
+	bases := absoluteBases([]string{dotfilesDir, userspaceDir})
+	if len(bases) == 0 {
+		return m, nil
+	}
+
+	ext := &IgnoreMatcher{}
+	if m != nil {
+		ext.rules = append(ext.rules, m.rules...)
+	}
+	ext.add(bases, defaultIgnorePatterns)
+	if err := ext.addIgnoreFile(bases[0], bases); err != nil {
+		return nil, err
+	}
+	return ext, nil
+}
+
+// Match returns true if the absolute 'path' is ignored. 'isDir' tells whether the path is a
+// directory.
+func (m *IgnoreMatcher) Match(path string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+
+	// Contents of an ignored directory cannot be included again
+	var parents []string
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		parents = append(parents, dir)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		if m.matchPath(parents[i], true) {
+			return true
+		}
+	}
+	return m.matchPath(path, isDir)
+}
+
+// Returns whether the last rule matching 'path' excludes it. Parent directories are not considered.
+func (m *IgnoreMatcher) matchPath(path string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.matches(path, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// Returns whether the rule matches 'path' relative to the first base containing it.
+func (r *ignoreRule) matches(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	for _, base := range r.bases {
+		rel, err := filepath.Rel(base, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		components := strings.Split(filepath.ToSlash(rel), "/")
+		if !r.anchored {
+			components = components[len(components)-1:]
+		}
+		return matchSegments(r.segments, components)
+	}
+	return false
+}
+
+// Adds a rule relative to 'bases' for every pattern.
+func (m *IgnoreMatcher) add(bases []string, patterns []string) {
+	if len(bases) == 0 {
+		return
+	}
+	for _, p := range patterns {
+		if rule := parseIgnorePattern(p); rule != nil {
+			rule.bases = bases
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// Adds the patterns of the ignore file in 'dir' relative to 'bases'. A missing file is skipped.
+func (m *IgnoreMatcher) addIgnoreFile(dir string, bases []string) error {
+	patterns, err := readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return err
+	}
+	m.add(bases, patterns)
+	return nil
+}
+
+// Parses a single line of an ignore file. Nil is returned for blank lines and comments.
+func parseIgnorePattern(line string) *ignoreRule {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	rule := &ignoreRule{}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// Escaped '#' or '!' at the start of the pattern
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	rule.segments = strings.Split(line, "/")
+	return rule
+}
+
+// Matches the path components 'components' against the pattern components 'segments', where '**'
+// matches any number of components.
+func matchSegments(segments, components []string) bool {
+	if len(segments) == 0 {
+		return len(components) == 0
+	}
+
+	if segments[0] == "**" {
+		for i := 0; i <= len(components); i++ {
+			if matchSegments(segments[1:], components[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(components) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(segments[0], components[0]); !ok {
+		return false
+	}
+	return matchSegments(segments[1:], components[1:])
+}
+
+// Reads the patterns of the ignore file at 'file'. A missing file has no patterns.
+func readIgnoreFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	return patterns, nil
+}
+
+// Returns the non-empty 'dirs' as absolute paths.
+func absoluteBases(dirs []string) []string {
+	var bases []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if abs, err := getAbsolutePath(dir); err == nil {
+			bases = append(bases, abs)
+		}
+	}
+	return bases
+}
+
+// Returns whether the existing 'path' is ignored by 'ignore'.
+func isIgnored(ignore *IgnoreMatcher, path string) bool {
+	if ignore == nil {
+		return false
+	}
+	isDir := false
+	if info, err := os.Stat(path); err == nil {
+		isDir = info.IsDir()
+	}
+	return ignore.Match(path, isDir)
+}
+
+// Returns the value that makes filepath.WalkDir leave out the entry 'd' including its contents.
+func skipEntry(d fs.DirEntry) error {
+	if d.IsDir() {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// IgnoredPaths walks 'root' and returns the paths that are ignored by 'ignore'. Ignored directories
+// are returned without their contents.
+func IgnoredPaths(root string, ignore *IgnoreMatcher) ([]string, error) {
+	absRoot, err := GetAndValidateAbsolutePath(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var ignored []string
+	err = filepath.WalkDir(absRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == absRoot || !ignore.Match(p, d.IsDir()) {
+			return nil
+		}
+
+		ignored = append(ignored, p)
+		return skipEntry(d)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ignored, nil
+}
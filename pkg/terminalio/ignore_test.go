@@ -0,0 +1,213 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_IgnoreMatcher_Match(t *testing.T) {
+	base := "/dotfiles"
+
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{"*.swp"}, ".config/nvim/init.lua.swp", false, true},
+		{[]string{"*.swp"}, ".config/nvim/init.lua", false, false},
+		{[]string{"cache/"}, ".config/app/cache", true, true},
+		{[]string{"cache/"}, ".config/app/cache", false, false},
+		{[]string{"cache/"}, ".config/app/cache/data", false, true},
+		{[]string{"/.bashrc"}, ".bashrc", false, true},
+		{[]string{"/.bashrc"}, "nested/.bashrc", false, false},
+		{[]string{".config/app"}, ".config/app", true, true},
+		{[]string{".config/app"}, "other/.config/app", true, false},
+		{[]string{"**/logs"}, "a/b/logs", true, true},
+		{[]string{".config/**/*.log"}, ".config/a/b/c.log", false, true},
+		{[]string{".config/**/*.log"}, ".config/c.log", false, true},
+		{[]string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{[]string{"logs/", "!logs/keep.log"}, "logs/keep.log", false, true},
+		{[]string{"# comment", ""}, "# comment", false, false},
+		{[]string{`\#file`}, "#file", false, true},
+		{[]string{"*"}, "/elsewhere/file", false, false},
+	}
+
+	for _, tc := range tests {
+		m := NewIgnoreMatcher([]string{base}, tc.patterns...)
+
+		path := tc.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(base, path)
+		}
+
+		if got := m.Match(path, tc.isDir); got != tc.want {
+			t.Errorf("patterns %q on %s: have %t, want %t", tc.patterns, tc.path, got, tc.want)
+		}
+	}
+}
+
+func Test_IgnoreMatcher_nil_ignores_nothing(t *testing.T) {
+	var m *IgnoreMatcher
+	if m.Match("/dotfiles/.git", true) {
+		t.Error("nil matcher should not ignore anything")
+	}
+}
+
+func Test_LoadIgnoreMatcher_applies_dotfiles_patterns_to_userspace(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	if err := os.WriteFile(filepath.Join(dfiles, IgnoreFileName), []byte("cache/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadIgnoreMatcher("", uspace, Layers{dfiles})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	ignored := []string{
+		filepath.Join(dfiles, ".config/app/cache"),
+		filepath.Join(uspace, ".config/app/cache"),
+		filepath.Join(dfiles, ".git"),
+		filepath.Join(dfiles, IgnoreFileName),
+	}
+	for _, p := range ignored {
+		if !m.Match(p, true) {
+			t.Errorf("expected path to be ignored: %s", p)
+		}
+	}
+
+	if m.Match(filepath.Join(uspace, ".config/app"), true) {
+		t.Error("expected directory containing the ignored directory not to be ignored")
+	}
+}
+
+func Test_copyDir_leaves_out_ignored_paths(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	src := env.UserspaceDir.AddTempDir("app")
+	kept := src.AddTempFile()
+	src.AddTempDir("cache").AddTempFile()
+
+	dst := filepath.Join(env.DotfilesDir.Path, "app")
+	ignore := NewIgnoreMatcher([]string{env.DotfilesDir.Path}, "cache/")
+
+	if _, err := copyDir(src.Path, dst, ignore); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	if exists, _ := checkIfPathExists(filepath.Join(dst, kept.Name)); !exists {
+		t.Errorf("expected file to be copied: %s", kept.Name)
+	}
+	if exists, _ := checkIfPathExists(filepath.Join(dst, "cache")); exists {
+		t.Error("expected ignored directory not to be copied")
+	}
+}
+
+func Test_AddDotfile_refuses_directory_with_ignored_paths(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	writeLayerFile(t, uspace, ".config/nvim/init.lua", "set number\n")
+	head := writeLayerFile(t, uspace, ".config/nvim/.git/HEAD", "ref: refs/heads/main\n")
+
+	ignore, err := LoadIgnoreMatcher("", uspace, Layers{dfiles})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	op := NewOperation("add", OperationOptions{BackupDir: t.TempDir(), Ignore: ignore})
+
+	err = AddDotfile(op, filepath.Join(uspace, ".config/nvim"), uspace, dfiles)
+	if _, ok := err.(*ErrIgnoredPathsInside); !ok {
+		test.FailHard(err, &ErrIgnoredPathsInside{}, t)
+	}
+
+	if exists, _ := checkIfPathExists(head); !exists {
+		t.Errorf("expected ignored file to be kept: %s", head)
+	}
+	if exists, _ := checkIfPathExists(filepath.Join(dfiles, ".config/nvim")); exists {
+		t.Error("expected copy in dotfiles to be rolled back")
+	}
+}
+
+func Test_backupFile_keeps_ignored_paths(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	uspace := env.UserspaceDir.Path
+	writeLayerFile(t, uspace, "app/.git/HEAD", "ref: refs/heads/main\n")
+
+	op := NewOperation("test", OperationOptions{
+		BackupDir: t.TempDir(),
+		Ignore:    NewIgnoreMatcher([]string{uspace}, ".git"),
+	})
+
+	backup, err := op.backupFile(filepath.Join(uspace, "app"))
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if exists, _ := checkIfPathExists(filepath.Join(backup, ".git/HEAD")); !exists {
+		t.Error("expected ignored file to be backed up")
+	}
+}
+
+func Test_installing_copy_keeps_ignored_paths_in_userspace(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	writeLayerFile(t, dfiles, ".app/config", "new\n")
+	writeLayerFile(t, dfiles, ".app/plugins/a", "new\n")
+	writeLayerFile(t, uspace, ".app/config", "old\n")
+	writeLayerFile(t, uspace, ".app/stale", "old\n")
+	writeLayerFile(t, uspace, ".app/plugins/a", "old\n")
+	cache := writeLayerFile(t, uspace, ".app/plugins/cache/index", "keep\n")
+
+	op := NewOperation("sync", OperationOptions{
+		BackupDir: t.TempDir(),
+		Ignore:    NewIgnoreMatcher([]string{dfiles, uspace}, "cache/"),
+		Manifest:  &Manifest{Files: map[string]*ManifestEntry{".app": {Mode: ModeCopy}}},
+	})
+
+	if err := InstallDotfile(op, filepath.Join(dfiles, ".app"), uspace, dfiles, true); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	for rel, want := range map[string]string{".app/config": "new\n", ".app/plugins/a": "new\n"} {
+		contents, err := os.ReadFile(filepath.Join(uspace, rel))
+		if err != nil {
+			test.FailHard(err, "No error should have happened", t)
+		}
+		test.AssertEqual(want, string(contents), t)
+	}
+	if exists, _ := checkIfPathExists(cache); !exists {
+		t.Errorf("expected ignored file to be kept: %s", cache)
+	}
+	if exists, _ := checkIfPathExists(filepath.Join(uspace, ".app/stale")); exists {
+		t.Error("expected file missing from dotfiles to be removed")
+	}
+
+	// Undone by restoring the userspace directory as it was
+	if err := op.Rollback(os.ErrInvalid); err != os.ErrInvalid {
+		test.FailHard(err, os.ErrInvalid, t)
+	}
+	contents, _ := os.ReadFile(filepath.Join(uspace, ".app/config"))
+	test.AssertEqual("old\n", string(contents), t)
+	if exists, _ := checkIfPathExists(cache); !exists {
+		t.Errorf("expected ignored file to be kept: %s", cache)
+	}
+}
@@ -0,0 +1,341 @@
+package terminalio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+// A journalEntry records a single step taken by an Operation and how the step is undone.
+type journalEntry struct {
+	description string       // Human readable description of the step
+	path        string       // Path changed by the step. Empty if it changes nothing of interest.
+	undo        func() error // Reverts the step. Nil if the step does not need to be undone.
+}
+
+// Records a step changing 'path' in the journal of the operation.
+func (op *Operation) record(path string, undo func() error, description ...any) {
+	op.journal = append(op.journal, &journalEntry{
+		description: fmt.Sprint(description...),
+		path:        path,
+		undo:        undo,
+	})
+}
+
+// Runs 'fn' as a single unit. If 'fn' fails, all steps it recorded are undone and the state of the
+// file system is returned to what it was before 'fn' was run. Steps recorded before are kept.
+func (op *Operation) atomic(fn func() error) error {
+	mark := len(op.journal)
+	if err := fn(); err != nil {
+		return op.rollbackTo(mark, err)
+	}
+	return nil
+}
+
+// Undoes steps in reverse order until only 'mark' steps are left in the journal. The given cause is
+// returned if all steps were undone and otherwise an ErrRollbackFailed wrapping the cause.
+func (op *Operation) rollbackTo(mark int, cause error) error {
+	if len(op.journal) > mark {
+		logging.Warn("Rolling back changes because of error:", cause)
+	}
+
+	var failures []error
+	for i := len(op.journal) - 1; i >= mark; i-- {
+		entry := op.journal[i]
+		if entry.undo == nil {
+			continue
+		}
+
+		logging.Info("Undoing:", entry.description)
+		if err := entry.undo(); err != nil {
+			logging.Error("Failed to undo:", entry.description, err)
+			failures = append(failures, err)
+		}
+	}
+	op.journal = op.journal[:mark]
+
+	if len(failures) > 0 {
+		return &ErrRollbackFailed{Cause: cause, Failures: failures}
+	}
+	return cause
+}
+
+// Copies src to dst leaving out ignored paths. Undone by deleting dst. It is an error if dst already
+// exists.
+func (op *Operation) copyFileOrDir(src, dst string) (string, error) {
+	exists, err := op.pathExists(dst)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", &ErrFileAlreadyExists{dst}
+	}
+
+	if op.dryRun {
+		op.planStep(dst, true, "copy ", src, " -> ", dst)
+		return dst, nil
+	}
+
+	path, err := copyFileOrDir(src, dst, op.ignore)
+	if err != nil {
+		// Remove whatever was copied before the failure.
+		if exists, _ := checkIfPathExists(dst); exists {
+			deleteFileOrDir(dst)
+		}
+		return "", err
+	}
+
+	op.record(path, func() error {
+		return deleteFileOrDir(path)
+	}, "copy ", src, " -> ", path)
+
+	return path, nil
+}
+
+// Deletes the file, directory or symlink at path. A symlink is undone by recreating it with the
+// same target. Files and directories are backed up before deletion and undone by restoring the
+// backup.
+func (op *Operation) deleteFileOrDir(path string) error {
+	ignored, err := op.ignoredPathsInside(path)
+	if err != nil {
+		return err
+	}
+	if len(ignored) > 0 {
+		return &ErrIgnoredPathsInside{path, ignored}
+	}
+
+	if op.dryRun {
+		// Files and directories already found on disk are planned to be backed up
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink == 0 {
+			if _, err := op.backupFile(path); err != nil {
+				return err
+			}
+		}
+		op.planStep(path, false, "delete ", path)
+		return nil
+	}
+
+	ok, err := IsFileSymlink(path)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("failed to read symlink: %w", err)
+		}
+
+		if err := deleteFile(path); err != nil {
+			return err
+		}
+
+		op.record(path, func() error {
+			return createSymlink(path, target)
+		}, "delete symlink ", path, " -> ", target)
+		return nil
+	}
+
+	backup, err := op.backupFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteFileOrDir(path); err != nil {
+		return err
+	}
+
+	op.record(path, func() error {
+		_, err := copyFileOrDir(backup, path, nil)
+		return err
+	}, "delete ", path)
+	return nil
+}
+
+// Returns the paths excluded by the ignore files inside the directory at 'path'. Nothing is returned
+// if 'path' is not a directory.
+func (op *Operation) ignoredPathsInside(path string) ([]string, error) {
+	info, err := os.Lstat(path)
+	if op.ignore == nil || err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	return IgnoredPaths(path, op.ignore)
+}
+
+// Replaces the contents of the directory 'dst' with a copy of the contents of the directory 'src'
+// entry by entry. Paths inside 'dst' excluded by the ignore files are left in place together with
+// the directories containing them. If 'src' is empty the contents of 'dst' are only deleted.
+func (op *Operation) replaceDirContents(src, dst string) error {
+	var srcEntries []os.DirEntry
+	if src != "" {
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		srcEntries = entries
+	}
+
+	dstEntries, err := os.ReadDir(dst)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range dstEntries {
+		d := filepath.Join(dst, e.Name())
+		if isIgnored(op.ignore, d) {
+			continue
+		}
+
+		ignored, err := op.ignoredPathsInside(d)
+		if err != nil {
+			return err
+		}
+		if len(ignored) == 0 {
+			if err := op.deleteFileOrDir(d); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Directories keeping ignored paths are replaced by their contents as well
+		s := ""
+		if src != "" {
+			s = filepath.Join(src, e.Name())
+			if isDir, err := isDirectory(s); err != nil || !isDir {
+				if exists, _ := checkIfPathExists(s); exists {
+					return &ErrIgnoredPathsInside{d, ignored}
+				}
+				s = ""
+			}
+		}
+		if err := op.replaceDirContents(s, d); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range srcEntries {
+		s, d := filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())
+
+		// Left in place above
+		exists, err := op.pathExists(d)
+		if err != nil {
+			return err
+		}
+		if exists || isIgnored(op.ignore, s) {
+			continue
+		}
+
+		if _, err := op.copyFileOrDir(s, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a symlink at 'symlinkDest' pointing to 'fileSrc'. The target is made relative to the
+// symlink if the operation creates relative symlinks. Undone by removing the symlink.
+func (op *Operation) createSymlink(symlinkDest, fileSrc string) error {
+	fileSrc, err := op.symlinkTarget(symlinkDest, fileSrc)
+	if err != nil {
+		return err
+	}
+
+	if op.dryRun {
+		op.planStep(symlinkDest, true, "create symlink ", symlinkDest, " -> ", fileSrc)
+		return nil
+	}
+
+	if err := createSymlink(symlinkDest, fileSrc); err != nil {
+		return err
+	}
+
+	op.record(symlinkDest, func() error {
+		return deleteFile(symlinkDest)
+	}, "create symlink ", symlinkDest, " -> ", fileSrc)
+	return nil
+}
+
+// Changes an existing symlink at 'fromDest' to point to 'toFile'.
+func (op *Operation) updateSymlink(fromDest, toFile string) error {
+	if err := op.deleteFileOrDir(fromDest); err != nil {
+		return err
+	}
+	return op.createSymlink(fromDest, toFile)
+}
+
+// Writes contents to a new file at path with the permissions 'perm'. Undone by deleting the file. It
+// is an error if the file already exists.
+func (op *Operation) writeFile(path string, contents []byte, perm os.FileMode) error {
+	exists, err := op.pathExists(path)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return &ErrFileAlreadyExists{path}
+	}
+
+	if op.dryRun {
+		op.planStep(path, true, "write ", path)
+		return nil
+	}
+
+	if err := writeFile(path, contents, perm); err != nil {
+		return err
+	}
+
+	op.record(path, func() error {
+		return deleteFile(path)
+	}, "write ", path)
+	return nil
+}
+
+// Creates the directory 'dir' including missing parents. Undone by removing the directories that
+// were created, as long as they are still empty.
+func (op *Operation) mkdirAll(dir string) error {
+	if op.dryRun {
+		exists, err := op.pathExists(dir)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			op.planStep(dir, true, "create directory ", dir)
+		}
+		return nil
+	}
+
+	var created []string
+	for p := dir; ; p = filepath.Dir(p) {
+		_, err := os.Stat(p)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		created = append(created, p)
+		if p == filepath.Dir(p) {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directories: %s: %w", dir, err)
+	}
+
+	if len(created) > 0 {
+		// Created directories only contain other changed paths
+		op.record("", func() error {
+			// Deepest directory first
+			for _, d := range created {
+				if err := os.Remove(d); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, "create directory ", dir)
+	}
+	return nil
+}
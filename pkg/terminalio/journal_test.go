@@ -0,0 +1,157 @@
+package terminalio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_atomic_undoes_add_steps_when_a_later_step_fails(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := newTestOperation(t)
+	userspaceFile := env.UserspaceDir.AddTempFile().Path
+	contents := []byte("precious config\n")
+	if err := os.WriteFile(userspaceFile, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dotfile := filepath.Join(env.DotfilesDir.Path, "nested", filepath.Base(userspaceFile))
+
+	stepErr := errors.New("symlink failed")
+
+	// Replays the steps of AddDotfile and fails at the last one.
+	err := op.atomic(func() error {
+		if _, err := op.backupFile(userspaceFile); err != nil {
+			return err
+		}
+		if err := op.mkdirAll(filepath.Dir(dotfile)); err != nil {
+			return err
+		}
+		if _, err := op.copyFileOrDir(userspaceFile, dotfile); err != nil {
+			return err
+		}
+		if err := op.deleteFileOrDir(userspaceFile); err != nil {
+			return err
+		}
+		return stepErr
+	})
+
+	if !errors.Is(err, stepErr) {
+		test.FailHard(err, stepErr, t)
+	}
+
+	// Userspace file is restored with its contents
+	actual, err := os.ReadFile(userspaceFile)
+	if err != nil {
+		test.FailHard(err, "Userspace file should have been restored", t)
+	}
+	if diff := cmp.Diff(actual, contents); diff != "" {
+		t.Errorf("have: %s\nwant: %s\ndiff: %s", actual, contents, diff)
+	}
+
+	// Copy in dotfiles and the created directory are removed
+	if exists, _ := checkIfPathExists(filepath.Dir(dotfile)); exists {
+		test.Fail(exists, "Directory created in dotfiles should have been removed", t)
+	}
+
+	if len(op.journal) != 0 {
+		test.Fail(len(op.journal), 0, t)
+	}
+}
+
+func Test_Rollback_undoes_symlink_steps_since_last_commit(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := newTestOperation(t)
+	target1 := env.DotfilesDir.AddTempFile().Path
+	target2 := env.DotfilesDir.AddTempFile().Path
+	committedLink := filepath.Join(env.UserspaceDir.Path, "committed")
+	updatedLink := filepath.Join(env.UserspaceDir.Path, "updated")
+
+	if err := op.createSymlink(committedLink, target1); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.createSymlink(updatedLink, target1); err != nil {
+		t.Fatal(err)
+	}
+	op.Commit()
+
+	if err := op.updateSymlink(updatedLink, target2); err != nil {
+		t.Fatal(err)
+	}
+
+	cause := errors.New("later step failed")
+	if err := op.Rollback(cause); err != cause {
+		test.FailHard(err, cause, t)
+	}
+
+	// Committed symlink is left alone
+	if ok, err := IsFileSymlink(committedLink); !ok || err != nil {
+		test.Fail(err, "Committed symlink should still exist", t)
+	}
+
+	// Updated symlink points to its original target again
+	actual, err := os.Readlink(updatedLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != target1 {
+		test.Fail(actual, target1, t)
+	}
+}
+
+func Test_copyFileOrDir_refuses_to_overwrite_existing_file(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := newTestOperation(t)
+	src := env.UserspaceDir.AddTempFile().Path
+	dst := env.DotfilesDir.AddTempFile().Path
+
+	_, err := op.copyFileOrDir(src, dst)
+
+	var existsErr *ErrFileAlreadyExists
+	if !errors.As(err, &existsErr) {
+		test.Fail(err, existsErr, t)
+	}
+}
+
+func Test_AddDotfile_in_dry_run_mode_only_plans_steps(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	op := NewOperation("add", OperationOptions{BackupDir: env.BackupDir.Path, DryRun: true})
+	userspaceFile := env.UserspaceDir.AddTempFile().Path
+	dotfile := filepath.Join(env.DotfilesDir.Path, filepath.Base(userspaceFile))
+
+	if err := AddDotfile(op, userspaceFile, env.UserspaceDir.Path, env.DotfilesDir.Path); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	expected := []string{
+		"copy " + userspaceFile + " -> " + dotfile,
+		"backup " + userspaceFile,
+		"delete " + userspaceFile,
+		"create symlink " + userspaceFile + " -> " + dotfile,
+	}
+	if diff := cmp.Diff(op.Plan(), expected); diff != "" {
+		t.Errorf("have: %v\nwant: %v\ndiff: %s", op.Plan(), expected, diff)
+	}
+
+	// Nothing is changed on disk
+	if ok, _ := IsFileSymlink(userspaceFile); ok {
+		test.Fail(ok, "Userspace file should not have been replaced by a symlink", t)
+	}
+	if exists, _ := checkIfPathExists(dotfile); exists {
+		test.Fail(exists, "Dotfile should not have been created", t)
+	}
+	if op.generation != nil {
+		test.Fail(op.generation.Id, "No backup generation should have been created", t)
+	}
+}
@@ -0,0 +1,188 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Layers is an ordered list of dotfiles directories that are installed into the same userspace. The
+// list is ordered from the least to the most specific layer, e.g. a layer shared by all machines
+// followed by the distribution of the current machine. If a file exists in more than one layer the
+// most specific layer wins.
+type Layers []string
+
+// Returns the layers as validated absolute paths.
+func (l Layers) absolute() (Layers, error) {
+	abs := make(Layers, 0, len(l))
+	for _, layer := range l {
+		absLayer, err := GetAndValidateAbsolutePath(layer)
+		if err != nil {
+			return nil, err
+		}
+		abs = append(abs, absLayer)
+	}
+	return abs, nil
+}
+
+// Returns the location of 'file' and the layer it belongs to. A file inside one of the layers
+// belongs to that layer. A file in userspace belongs to the most specific layer that contains it or
+// to the most specific layer if none do. The layers must be absolute.
+func (l Layers) locate(file, userspaceDir string) (*fileLocationInfo, string, error) {
+	if len(l) == 0 {
+		return nil, "", &ErrFileNotFound{file}
+	}
+
+	absFile, err := getAbsolutePath(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := len(l) - 1; i >= 0; i-- {
+		if isInsideDir(absFile, l[i]) {
+			info, err := getFileLocationInfo(absFile, userspaceDir, l[i])
+			return info, l[i], err
+		}
+	}
+
+	absUserspaceDir, err := GetAndValidateAbsolutePath(userspaceDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rel, err := filepath.Rel(absUserspaceDir, absFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	layer := l[len(l)-1]
+	for i := len(l) - 1; i >= 0; i-- {
+		exists, _ := checkIfPathExists(filepath.Join(l[i], rel))
+		for _, suffix := range []string{TemplateSuffix, SecretSuffix} {
+			if !exists {
+				exists, _ = checkIfPathExists(filepath.Join(l[i], rel+suffix))
+			}
+		}
+		if exists {
+			layer = l[i]
+			break
+		}
+	}
+
+	info, err := getFileLocationInfo(absFile, userspaceDir, layer)
+	return info, layer, err
+}
+
+// Returns whether the directory 'rel' must be created as a regular directory in userspace with its
+// contents installed individually. This is the case if it is found in more than one layer, as no
+// single layer owns it, or if it contains templates or secrets, as they are written instead of
+// symlinked. The layers must be absolute.
+func (l Layers) expands(rel string, ignore *IgnoreMatcher) bool {
+	return l.isShared(rel) || l.containsGenerated(rel, ignore)
+}
+
+// Returns whether 'rel' is a directory in more than one layer. The layers must be absolute.
+func (l Layers) isShared(rel string) bool {
+	count := 0
+	for _, layer := range l {
+		if isDir, _ := isDirectory(filepath.Join(layer, rel)); isDir {
+			count++
+		}
+	}
+	return count > 1
+}
+
+// A layeredEntry is a path found in at least one layer.
+type layeredEntry struct {
+	layer string // Most specific layer containing the path
+	isDir bool   // Whether the path is a directory in the most specific layer
+}
+
+// Walks the subtree 'rel' in every layer and returns all paths found relative to the root of the
+// layers. Paths ignored by 'ignore' are left out. The layers must be absolute.
+func (l Layers) walk(rel string, ignore *IgnoreMatcher) (map[string]*layeredEntry, error) {
+	entries := make(map[string]*layeredEntry)
+
+	for i := len(l) - 1; i >= 0; i-- {
+		layer := l[i]
+		root := filepath.Join(layer, rel)
+
+		exists, err := checkIfPathExists(root)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			r, err := filepath.Rel(layer, p)
+			if err != nil {
+				return err
+			}
+			if r == "." {
+				return nil
+			}
+			if ignore.Match(p, d.IsDir()) {
+				return skipEntry(d)
+			}
+
+			if _, ok := entries[r]; !ok {
+				entries[r] = &layeredEntry{layer: layer, isDir: d.IsDir()}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Works like walk but only walks the subtrees inside 'rel' managed in each layer according to
+// 'manifest'.
+func (l Layers) walkManaged(rel string, ignore *IgnoreMatcher, manifest *Manifest) (map[string]*layeredEntry, error) {
+	entries := make(map[string]*layeredEntry)
+	for i := len(l) - 1; i >= 0; i-- {
+		for _, root := range manifest.roots(l[i], rel) {
+			found, err := l[i:i+1].walk(root, ignore)
+			if err != nil {
+				return nil, err
+			}
+			for p, entry := range found {
+				// Paths of more specific layers take precedence
+				if _, ok := entries[p]; !ok {
+					entries[p] = entry
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Returns the keys of 'entries' in the order they are visited when walking a directory tree.
+func sortedPaths(entries map[string]*layeredEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for p := range entries {
+		paths = append(paths, p)
+	}
+
+	// Comparing with the separator as the lowest character puts a directory right before its
+	// contents, e.g. 'a' < 'a/b' < 'a.b'.
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.ReplaceAll(paths[i], string(filepath.Separator), "\x00") <
+			strings.ReplaceAll(paths[j], string(filepath.Separator), "\x00")
+	})
+	return paths
+}
+
+// Returns whether 'path' is 'dir' or inside of it. Both paths must be absolute.
+func isInsideDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,118 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+// Creates the file 'rel' with 'contents' inside 'dir' including missing parents.
+func writeLayerFile(t *testing.T, dir, rel, contents string) string {
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_GetLayeredDotfilesStatus_reports_most_specific_layer(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	common := t.TempDir()
+	host := env.DotfilesDir.Path
+	layers := Layers{common, host}
+
+	shared := writeLayerFile(t, common, ".bashrc", "common")
+	overridden := writeLayerFile(t, common, ".config/nvim/init.lua", "common")
+	override := writeLayerFile(t, host, ".config/nvim/init.lua", "host")
+	hostOnly := writeLayerFile(t, host, ".zshrc", "host")
+
+	statuses, err := GetLayeredDotfilesStatus(env.UserspaceDir.Path, layers, nil, nil)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	want := map[string]string{
+		shared:   common,
+		override: host,
+		hostOnly: host,
+	}
+
+	if len(statuses) != len(want) {
+		test.FailHardMsg("Unexpected number of entries", len(statuses), len(want), t)
+	}
+
+	for _, s := range statuses {
+		if s.DotfilesFile == overridden {
+			t.Errorf("overridden dotfile was reported: %s", s.DotfilesFile)
+		}
+		layer, ok := want[s.DotfilesFile]
+		if !ok {
+			t.Errorf("unexpected entry in status: %s", s.DotfilesFile)
+			continue
+		}
+		if s.Layer != layer {
+			test.FailMsg("Layer of "+s.DotfilesFile, s.Layer, layer, t)
+		}
+		if s.State != StateMissing {
+			test.FailMsg("State of "+s.DotfilesFile, s.State, StateMissing, t)
+		}
+	}
+}
+
+func Test_InstallLayeredDotfile_installs_contents_of_shared_directory(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	common := t.TempDir()
+	host := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	commonOnly := writeLayerFile(t, common, ".config/nvim/lua/plugins.lua", "common")
+	writeLayerFile(t, common, ".config/nvim/init.lua", "common")
+	override := writeLayerFile(t, host, ".config/nvim/init.lua", "host")
+
+	// Symlink of the whole directory from before the layers were introduced is in the way
+	if err := os.MkdirAll(filepath.Join(uspace, ".config"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	userspaceDir := filepath.Join(uspace, ".config/nvim")
+	if err := createSymlink(userspaceDir, filepath.Join(host, ".config/nvim")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := InstallLayeredDotfile(newTestOperation(t), userspaceDir, uspace, Layers{common, host}, false)
+	if _, ok := err.(*ErrAbortOnOverwrite); !ok {
+		test.FailHard(err, &ErrAbortOnOverwrite{}, t)
+	}
+
+	err = InstallLayeredDotfile(newTestOperation(t), userspaceDir, uspace, Layers{common, host}, true)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	if ok, _ := IsFileSymlink(userspaceDir); ok {
+		t.Errorf("shared directory should be a regular directory in userspace: %s", userspaceDir)
+	}
+
+	want := map[string]string{
+		filepath.Join(userspaceDir, "init.lua"): override,
+		filepath.Join(userspaceDir, "lua"):      filepath.Dir(commonOnly),
+	}
+	for link, target := range want {
+		actual, err := os.Readlink(link)
+		if err != nil {
+			t.Errorf("expected symlink at %s: %v", link, err)
+			continue
+		}
+		if actual != target {
+			test.FailMsg("Target of "+link, actual, target, t)
+		}
+	}
+}
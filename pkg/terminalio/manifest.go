@@ -0,0 +1,480 @@
+package terminalio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ManifestName is the name of the manifest found in the root of the sync directory.
+const ManifestName = "dotf.toml"
+
+// InstallMode tells how a dotfile is installed into userspace.
+type InstallMode string
+
+const (
+	ModeSymlink InstallMode = "symlink" // A symlink in userspace points to the dotfile
+	ModeCopy    InstallMode = "copy"    // The dotfile is copied into userspace and changes are synced back
+	// The dotfile is a template or secret rendered or decrypted into userspace as a regular file
+	ModeGenerated InstallMode = "generated"
+)
+
+// ManifestEntry contains the settings of a single path managed by dotf.
+type ManifestEntry struct {
+	Mode   InstallMode `toml:"mode,omitempty"`
+	Perm   string      `toml:"perm,omitempty"`   // Octal permissions of the path in userspace when it was added
+	Distro string      `toml:"distro,omitempty"` // Name of the dotfiles directory of a path recorded in 'files' by earlier versions
+	Added  time.Time   `toml:"added,omitempty"`  // When dotf started to manage the path
+}
+
+// A Manifest records the paths managed by dotf and their settings. Paths are relative to the root of
+// the dotfiles directories, which equals their location relative to userspace, and use '/' as
+// separator. The settings of a directory apply to everything inside it. A nil Manifest has no
+// entries.
+//
+// The manifest is a TOML file with a table for each path. The paths managed in a dotfiles directory
+// are recorded in 'distros' under its path relative to the sync directory, while the settings in
+// 'files' apply to every dotfiles directory:
+//
+//	[files.".ssh"]
+//	mode = "copy"
+//
+//	[distros."distros/laptop".".ssh/config"]
+//	perm = "0600"
+//	added = 2023-05-01T12:00:00Z
+//
+// Paths are recorded by dotf when they are added and removed again when they are reverted. Once any
+// path of a dotfiles directory has been recorded, only its recorded paths are managed. Until then
+// everything found in it is managed.
+type Manifest struct {
+	path    string
+	Files   map[string]*ManifestEntry            `toml:"files,omitempty"`
+	Distros map[string]map[string]*ManifestEntry `toml:"distros,omitempty"`
+}
+
+// LoadManifest reads the manifest in 'syncDir'. An empty manifest is returned if there is none.
+func LoadManifest(syncDir string) (*Manifest, error) {
+	m := &Manifest{
+		Files:   make(map[string]*ManifestEntry),
+		Distros: make(map[string]map[string]*ManifestEntry),
+	}
+	if syncDir == "" {
+		return m, nil
+	}
+	m.path = filepath.Join(syncDir, ManifestName)
+
+	contents, err := os.ReadFile(m.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m, nil
+		}
+		return nil, err
+	}
+
+	if _, err := toml.Decode(string(contents), m); err != nil {
+		return nil, &ErrMalformedManifest{m.path, err.Error()}
+	}
+
+	if m.Files, err = m.validate(m.Files); err != nil {
+		return nil, err
+	}
+	for name, entries := range m.Distros {
+		if m.Distros[name], err = m.validate(entries); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Returns the entries of 'files' keyed by their cleaned paths or an error if any of them is invalid.
+func (m *Manifest) validate(files map[string]*ManifestEntry) (map[string]*ManifestEntry, error) {
+	valid := make(map[string]*ManifestEntry, len(files))
+	for p, entry := range files {
+		key := filepath.ToSlash(filepath.Clean(p))
+		if filepath.IsAbs(p) || key == "." || key == ".." || strings.HasPrefix(key, "../") {
+			return nil, &ErrMalformedManifest{m.path, "path must be relative to the dotfiles directory: " + p}
+		}
+		if entry == nil {
+			entry = &ManifestEntry{}
+		}
+		switch entry.Mode {
+		case "", ModeSymlink, ModeCopy:
+		case ModeGenerated:
+			if !strings.HasSuffix(key, TemplateSuffix) && !strings.HasSuffix(key, SecretSuffix) {
+				return nil, &ErrMalformedManifest{m.path, "only templates and secrets are generated: " + p}
+			}
+		default:
+			return nil, &ErrMalformedManifest{m.path, "unknown install mode of " + p + ": " + string(entry.Mode)}
+		}
+		if entry.Perm != "" {
+			if _, err := strconv.ParseUint(entry.Perm, 8, 32); err != nil {
+				return nil, &ErrMalformedManifest{m.path, "permissions of " + p + " are not octal: " + entry.Perm}
+			}
+		}
+		valid[key] = entry
+	}
+	return valid, nil
+}
+
+// Returns the key the paths of the dotfiles directory 'layer' are recorded under, which is its path
+// relative to the sync directory. Dotfiles directories sharing a name are told apart this way. The
+// absolute path is used if the manifest has no sync directory.
+func (m *Manifest) distroKey(layer string) string {
+	if abs, err := filepath.Abs(layer); err == nil {
+		layer = abs
+	}
+	if m.path != "" {
+		if syncDir, err := filepath.Abs(filepath.Dir(m.path)); err == nil {
+			if rel, err := filepath.Rel(syncDir, layer); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	return filepath.ToSlash(layer)
+}
+
+// Returns the paths recorded for the dotfiles directory 'layer'. Until any of them is changed, the
+// paths recorded in 'files' under the name of the directory by earlier versions of dotf are used.
+func (m *Manifest) recorded(layer string) map[string]*ManifestEntry {
+	if recorded := m.Distros[m.distroKey(layer)]; len(recorded) > 0 {
+		return recorded
+	}
+	return m.legacy(layer)
+}
+
+// Returns the paths recorded in 'files' for the dotfiles directory 'layer' by earlier versions of
+// dotf, which only recorded its name.
+func (m *Manifest) legacy(layer string) map[string]*ManifestEntry {
+	name := filepath.Base(m.distroKey(layer))
+	legacy := make(map[string]*ManifestEntry)
+	for key, entry := range m.Files {
+		if entry.Distro == name {
+			legacy[key] = entry
+		}
+	}
+	return legacy
+}
+
+// Returns the paths recorded for the dotfiles directory 'layer', which are created if missing. Paths
+// recorded for it by earlier versions of dotf are moved out of 'files' first.
+func (m *Manifest) distro(layer string) map[string]*ManifestEntry {
+	key := m.distroKey(layer)
+	if m.Distros[key] == nil {
+		m.Distros[key] = make(map[string]*ManifestEntry)
+	}
+	for p, entry := range m.legacy(layer) {
+		delete(m.Files, p)
+		if _, ok := m.Distros[key][p]; !ok {
+			entry.Distro = ""
+			m.Distros[key][p] = entry
+		}
+	}
+	return m.Distros[key]
+}
+
+// Mode returns the install mode of the dotfile at 'rel' relative to the root of the dotfiles
+// directory 'layer'. The mode of the closest parent directory found in the manifest applies to paths
+// not found themselves, and the paths recorded for 'layer' take precedence over the settings of every
+// dotfiles directory. Paths not found at all are symlinked.
+func (m *Manifest) Mode(layer, rel string) InstallMode {
+	if m == nil {
+		return ModeSymlink
+	}
+	recorded := m.recorded(layer)
+	for p := filepath.Clean(rel); p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+		key := filepath.ToSlash(p)
+		if entry, ok := recorded[key]; ok && entry.Mode != "" {
+			return entry.Mode
+		}
+		if entry, ok := m.Files[key]; ok && entry.Mode != "" && entry.Distro == "" {
+			return entry.Mode
+		}
+	}
+	return ModeSymlink
+}
+
+// Returns true if any path is installed by copying it.
+func (m *Manifest) hasCopies() bool {
+	if m == nil {
+		return false
+	}
+	for _, entry := range m.Files {
+		if entry.Mode == ModeCopy {
+			return true
+		}
+	}
+	for _, entries := range m.Distros {
+		for _, entry := range entries {
+			if entry.Mode == ModeCopy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the install mode of 'dotfile' found in the dotfiles directory 'layer'.
+func (m *Manifest) modeOf(dotfile, layer string) InstallMode {
+	if m == nil {
+		return ModeSymlink
+	}
+	rel, err := filepath.Rel(layer, dotfile)
+	if err != nil {
+		return ModeSymlink
+	}
+	return m.Mode(layer, rel)
+}
+
+// Returns true if dotf records the paths managed in the dotfiles directory 'layer', which means that
+// its paths not found in the manifest are not managed.
+func (m *Manifest) tracking(layer string) bool {
+	return m != nil && len(m.recorded(layer)) > 0
+}
+
+// Returns the subtrees of the dotfiles directory 'layer' that must be walked to find the managed
+// paths inside 'rel'. That is 'rel' itself unless the manifest records the managed paths of 'layer',
+// in which case it is the recorded paths inside 'rel', or 'rel' if it is inside a recorded path.
+func (m *Manifest) roots(layer, rel string) []string {
+	rel = filepath.Clean(rel)
+	if !m.tracking(layer) {
+		return []string{rel}
+	}
+
+	recorded := m.recorded(layer)
+	keys := make([]string, 0, len(recorded))
+	for key := range recorded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var roots []string
+	for _, key := range keys {
+		p := filepath.FromSlash(key)
+		switch {
+		case isInsideRel(rel, p):
+			return []string{rel}
+		case isInsideRel(p, rel) && !insideAny(p, roots):
+			// Paths inside another root are walked along with it
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
+
+// Returns whether the relative path 'p' is 'dir' or inside of it. A 'dir' of "." contains everything.
+func isInsideRel(p, dir string) bool {
+	return dir == "." || p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// Returns whether the relative path 'p' is inside one of 'dirs'.
+func insideAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if isInsideRel(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Records 'rel' as a path managed in the dotfiles directory 'layer' with the settings of 'entry'. An
+// install mode already recorded for the path is kept if 'entry' does not set one.
+func (m *Manifest) track(layer, rel string, entry *ManifestEntry) {
+	recorded := m.distro(layer)
+	key := filepath.ToSlash(filepath.Clean(rel))
+	if existing, ok := recorded[key]; ok && entry.Mode == "" {
+		entry.Mode = existing.Mode
+	}
+	recorded[key] = entry
+}
+
+// Removes 'rel' and the paths inside it from the paths managed in the dotfiles directory 'layer'.
+func (m *Manifest) untrack(layer, rel string) {
+	recorded := m.distro(layer)
+	key := filepath.ToSlash(filepath.Clean(rel))
+	for p := range recorded {
+		if p == key || strings.HasPrefix(p, key+"/") {
+			delete(recorded, p)
+		}
+	}
+	if len(recorded) == 0 {
+		delete(m.Distros, m.distroKey(layer))
+	}
+}
+
+// Returns a copy of the entries of the manifest.
+func (m *Manifest) clone() *Manifest {
+	cloneEntries := func(entries map[string]*ManifestEntry) map[string]*ManifestEntry {
+		clone := make(map[string]*ManifestEntry, len(entries))
+		for p, entry := range entries {
+			e := *entry
+			clone[p] = &e
+		}
+		return clone
+	}
+
+	c := &Manifest{path: m.path, Files: cloneEntries(m.Files), Distros: make(map[string]map[string]*ManifestEntry)}
+	for name, entries := range m.Distros {
+		c.Distros[name] = cloneEntries(entries)
+	}
+	return c
+}
+
+// Returns the manifest encoded as TOML with a blank line between the tables of the paths.
+func (m *Manifest) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(m); err != nil {
+		return nil, err
+	}
+
+	// Tables only containing other tables, like 'files' and each distro, are implied by their paths
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("# Paths managed by dotf. Maintained by 'dotf add' and 'dotf revert'.\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "[") {
+			if i+1 == len(lines) || strings.HasPrefix(lines[i+1], "[") {
+				continue
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes(), nil
+}
+
+// Returns a new entry recording that the path at 'path' in userspace was added with the install
+// 'mode'.
+func newManifestEntry(path string, mode InstallMode) *ManifestEntry {
+	entry := &ManifestEntry{
+		Added: time.Now().UTC().Truncate(time.Second),
+	}
+	if mode != ModeSymlink {
+		entry.Mode = mode
+	}
+	if info, err := os.Stat(path); err == nil {
+		entry.Perm = "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8)
+	}
+	return entry
+}
+
+// Records 'dotfile' in the dotfiles directory 'dotfilesDir' as a managed path with the settings of
+// 'entry'. Both paths must be absolute.
+func (op *Operation) trackDotfile(dotfile, dotfilesDir string, entry *ManifestEntry) error {
+	rel, err := filepath.Rel(dotfilesDir, dotfile)
+	if err != nil {
+		return err
+	}
+	return op.updateManifest(func(m *Manifest) {
+		m.track(dotfilesDir, rel, entry)
+	})
+}
+
+// Removes the reverted 'dotfile' in the dotfiles directory 'dotfilesDir' from the paths managed in
+// it. Both paths must be absolute.
+func (op *Operation) untrackDotfile(dotfile, dotfilesDir string) error {
+	rel, err := filepath.Rel(dotfilesDir, dotfile)
+	if err != nil {
+		return err
+	}
+	return op.updateManifest(func(m *Manifest) {
+		m.untrack(dotfilesDir, rel)
+	})
+}
+
+// Changes the manifest of the operation with 'fn' and writes it to the sync directory. Undone by
+// restoring the previous manifest both on disk and in memory. Nothing is done if the operation has
+// no manifest.
+func (op *Operation) updateManifest(fn func(m *Manifest)) error {
+	m := op.manifest
+	if m == nil || m.path == "" {
+		return nil
+	}
+
+	previous := m.clone()
+	fn(m)
+
+	contents, err := m.encode()
+	if err != nil {
+		m.Files, m.Distros = previous.Files, previous.Distros
+		return err
+	}
+
+	if op.dryRun {
+		op.planStep(m.path, true, "update manifest ", m.path)
+		return nil
+	}
+
+	old, err := os.ReadFile(m.path)
+	existed := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.Files, m.Distros = previous.Files, previous.Distros
+		return err
+	}
+
+	if err := os.WriteFile(m.path, contents, 0644); err != nil {
+		m.Files, m.Distros = previous.Files, previous.Distros
+		return err
+	}
+
+	op.record(m.path, func() error {
+		m.Files, m.Distros = previous.Files, previous.Distros
+		if existed {
+			return os.WriteFile(m.path, old, 0644)
+		}
+		return deleteFile(m.path)
+	}, "update manifest ", m.path)
+	return nil
+}
+
+// Records every entry at the root of the dotfiles directory 'dotfilesDir' in the manifest of the
+// operation, if it does not record the paths managed in it yet. This keeps the paths managed once the
+// manifest is written, so it must be called before the operation changes the dotfiles directory. The
+// manifest is only changed in memory. Paths left out by the operation are not recorded.
+func (op *Operation) prepareManifest(dotfilesDir string) error {
+	m := op.manifest
+	if m == nil || m.path == "" || m.tracking(dotfilesDir) {
+		return nil
+	}
+
+	absDotfilesDir, err := getAbsolutePath(dotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	ignore := op.ignore
+	if ignore == nil {
+		ignore = NewIgnoreMatcher(Layers{absDotfilesDir}, defaultIgnorePatterns...)
+	}
+
+	entries, err := os.ReadDir(absDotfilesDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		p := filepath.Join(absDotfilesDir, e.Name())
+		if ignore.Match(p, e.IsDir()) || p == m.path {
+			continue
+		}
+		m.track(absDotfilesDir, e.Name(), &ManifestEntry{Added: time.Now().UTC().Truncate(time.Second)})
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_Manifest_roots_walks_recorded_paths(t *testing.T) {
+	syncDir := t.TempDir()
+	added := &ManifestEntry{Added: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)}
+	m := &Manifest{
+		path:  filepath.Join(syncDir, ManifestName),
+		Files: map[string]*ManifestEntry{".ssh": {Mode: ModeCopy}},
+		Distros: map[string]map[string]*ManifestEntry{"distros/laptop": {
+			".config/nvim":      added,
+			".config/nvim/lua":  added,
+			".config/nvim.bak":  added,
+			".zshrc":            added,
+			".ssh/config":       {Mode: ModeCopy},
+			".config/fish/conf": added,
+		}},
+	}
+	laptop := filepath.Join(syncDir, "distros", "laptop")
+
+	test.AssertEqual([]string{".config/fish/conf", ".config/nvim", ".config/nvim.bak", ".ssh/config", ".zshrc"}, m.roots(laptop, "."), t)
+	test.AssertEqual([]string{".config/fish/conf", ".config/nvim", ".config/nvim.bak"}, m.roots(laptop, ".config"), t)
+	test.AssertEqual([]string{".config/nvim/lua/init.lua"}, m.roots(laptop, ".config/nvim/lua/init.lua"), t)
+	test.AssertEqual(0, len(m.roots(laptop, ".vimrc")), t)
+
+	// Paths recorded in another dotfiles directory and settings written by hand do not record the
+	// managed paths
+	test.AssertEqual([]string{"."}, m.roots(filepath.Join(syncDir, "distros", "server"), "."), t)
+	test.AssertEqual([]string{"."}, m.roots(filepath.Join(syncDir, "laptop"), "."), t)
+}
+
+func Test_manifest_tells_apart_dotfiles_directories_sharing_a_name(t *testing.T) {
+	syncDir := t.TempDir()
+	uspace := t.TempDir()
+	manifest, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	op := NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: manifest})
+
+	a := filepath.Join(syncDir, "a", "common")
+	b := filepath.Join(syncDir, "b", "common")
+	writeLayerFile(t, b, ".bashrc", "set -o vi\n")
+	if err := os.MkdirAll(a, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	zshrc := writeLayerFile(t, uspace, ".zshrc", "bindkey -v\n")
+	if err := AddDotfile(op, zshrc, uspace, a); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	loaded, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".zshrc"}, sortedKeys(loaded.Distros["a/common"]), t)
+	test.AssertEqual(0, len(loaded.Distros["b/common"]), t)
+
+	// Nothing has been recorded for the other directory, so everything in it is still managed
+	test.AssertEqual(false, loaded.tracking(b), t)
+	test.AssertEqual([]string{"."}, loaded.roots(b, "."), t)
+}
+
+func Test_manifest_moves_paths_recorded_by_name_to_distros(t *testing.T) {
+	syncDir := t.TempDir()
+	writeLayerFile(t, syncDir, ManifestName, `
+[files.".ssh"]
+mode = "copy"
+
+[files.".zshrc"]
+distro = "laptop"
+added = 2023-05-01T12:00:00Z
+
+[files.".vimrc"]
+mode = "copy"
+distro = "desktop"
+added = 2023-05-01T12:00:00Z
+
+[distros."distros/server".".bashrc"]
+added = 2023-05-01T12:00:00Z
+`)
+
+	m, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	laptop := filepath.Join(syncDir, "distros", "laptop")
+	server := filepath.Join(syncDir, "distros", "server")
+	test.AssertEqual([]string{".zshrc"}, manifestPaths(m, laptop), t)
+	test.AssertEqual([]string{".bashrc"}, manifestPaths(m, server), t)
+
+	// The settings of every dotfiles directory apply to both, but not paths recorded for another
+	test.AssertEqual(ModeCopy, m.Mode(laptop, ".ssh/config"), t)
+	test.AssertEqual(ModeCopy, m.Mode(server, ".ssh/config"), t)
+	test.AssertEqual(ModeSymlink, m.Mode(laptop, ".vimrc"), t)
+
+	// The paths recorded by name are moved once the directory is changed
+	m.track(laptop, ".inputrc", &ManifestEntry{Added: time.Date(2023, 5, 2, 12, 0, 0, 0, time.UTC)})
+
+	contents, err := m.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Paths managed by dotf. Maintained by 'dotf add' and 'dotf revert'.
+
+[files.".ssh"]
+mode = "copy"
+
+[files.".vimrc"]
+mode = "copy"
+distro = "desktop"
+added = 2023-05-01T12:00:00Z
+
+[distros."distros/laptop".".inputrc"]
+added = 2023-05-02T12:00:00Z
+
+[distros."distros/laptop".".zshrc"]
+added = 2023-05-01T12:00:00Z
+
+[distros."distros/server".".bashrc"]
+added = 2023-05-01T12:00:00Z
+`
+	if diff := cmp.Diff(want, string(contents)); diff != "" {
+		t.Errorf("unexpected manifest:\n%s", diff)
+	}
+}
+
+func Test_manifest_only_limits_the_dotfiles_directories_it_records(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	// The sync directory is shared by both machines
+	syncDir := t.TempDir()
+	laptop := env.DotfilesDir.AddTempDir("laptop").Path
+	server := env.DotfilesDir.AddTempDir("server").Path
+	uspace := env.UserspaceDir.Path
+
+	writeLayerFile(t, server, ".bashrc", "set -o vi\n")
+	writeLayerFile(t, laptop, ".vimrc", "set number\n")
+
+	manifest, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	op := NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: manifest})
+	zshrc := writeLayerFile(t, uspace, ".zshrc", "bindkey -v\n")
+	if err := AddDotfile(op, zshrc, uspace, laptop); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	loaded, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".vimrc", ".zshrc"}, manifestPaths(loaded, laptop), t)
+
+	// Nothing has been recorded for the server, so everything in it is still managed
+	writeLayerFile(t, server, ".inputrc", "set editing-mode vi\n")
+	statuses, err := GetLayeredDotfilesStatus(uspace, Layers{server}, nil, loaded)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	var reported []string
+	for _, s := range statuses {
+		rel, _ := filepath.Rel(server, s.DotfilesFile)
+		reported = append(reported, rel)
+	}
+	test.AssertEqual([]string{".bashrc", ".inputrc"}, reported, t)
+
+	// The same path is recorded separately for each dotfiles directory
+	serverUspace := t.TempDir()
+	op = NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: loaded})
+	zshrc = writeLayerFile(t, serverUspace, ".zshrc", "bindkey -e\n")
+	if err := AddDotfile(op, zshrc, serverUspace, server); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".bashrc", ".inputrc", ".zshrc"}, manifestPaths(loaded, server), t)
+
+	op = NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: loaded})
+	if err := RevertDotfile(op, zshrc, serverUspace, server); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".bashrc", ".inputrc"}, manifestPaths(loaded, server), t)
+	test.AssertEqual([]string{".vimrc", ".zshrc"}, manifestPaths(loaded, laptop), t)
+}
+
+func Test_add_and_revert_maintain_manifest(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	syncDir := t.TempDir()
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	// Found in the dotfiles directory before the manifest records anything
+	writeLayerFile(t, dfiles, ".vimrc", "set number\n")
+
+	manifest, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	newOp := func() *Operation {
+		return NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: manifest})
+	}
+
+	script := writeLayerFile(t, uspace, "bin/script", "#!/bin/sh\n")
+	if err := os.Chmod(script, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDotfile(newOp(), script, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	sshConfig := writeLayerFile(t, uspace, ".ssh/config", "Host example\n")
+	if err := AddCopyDotfile(newOp(), sshConfig, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	// The manifest on disk is read the same way
+	loaded, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".ssh/config", ".vimrc", "bin/script"}, manifestPaths(loaded, dfiles), t)
+	test.AssertEqual(0, len(loaded.Files), t)
+
+	entry := loaded.Distros[loaded.distroKey(dfiles)]["bin/script"]
+	test.AssertEqual("0750", entry.Perm, t)
+	test.AssertEqual(ModeSymlink, loaded.Mode(dfiles, "bin/script"), t)
+	test.AssertEqual(ModeCopy, loaded.Mode(dfiles, ".ssh/config"), t)
+	if entry.Added.IsZero() {
+		test.Fail(entry.Added, "Time added should be recorded", t)
+	}
+
+	// Only recorded paths are managed
+	writeLayerFile(t, dfiles, ".unmanaged", "dropped in by hand\n")
+	statuses, err := GetLayeredDotfilesStatus(uspace, Layers{dfiles}, nil, loaded)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	var reported []string
+	for _, s := range statuses {
+		rel, _ := filepath.Rel(dfiles, s.DotfilesFile)
+		reported = append(reported, rel+": "+s.State.String())
+	}
+	want := []string{".ssh/config: installed", ".vimrc: missing", "bin/script: installed"}
+	if diff := cmp.Diff(want, reported); diff != "" {
+		t.Errorf("unexpected statuses:\n%s", diff)
+	}
+
+	_, err = GetLayeredDotfilesStatusAt(filepath.Join(dfiles, ".unmanaged"), uspace, Layers{dfiles}, nil, loaded)
+	if _, ok := err.(*ErrFileNotManaged); !ok {
+		test.Fail(err, &ErrFileNotManaged{}, t)
+	}
+
+	if err := RevertDotfile(newOp(), script, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".ssh/config", ".vimrc"}, manifestPaths(manifest, dfiles), t)
+
+	loaded, err = LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual([]string{".ssh/config", ".vimrc"}, manifestPaths(loaded, dfiles), t)
+}
+
+func Test_failed_add_restores_manifest(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	syncDir := t.TempDir()
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	manifest, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	op := NewOperation("test", OperationOptions{BackupDir: t.TempDir(), Manifest: manifest})
+
+	file := writeLayerFile(t, uspace, ".zshrc", "export EDITOR=vim\n")
+	if err := AddDotfile(op, file, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if err := op.Rollback(os.ErrInvalid); err != os.ErrInvalid {
+		test.FailHard(err, os.ErrInvalid, t)
+	}
+
+	test.AssertEqual(0, len(manifest.Distros), t)
+	if exists, _ := checkIfPathExists(filepath.Join(syncDir, ManifestName)); exists {
+		test.Fail(exists, "Manifest should have been removed", t)
+	}
+}
+
+// Returns the paths 'm' records for the dotfiles directory 'layer' in sorted order.
+func manifestPaths(m *Manifest, layer string) []string {
+	return sortedKeys(m.recorded(layer))
+}
+
+// Returns the paths of 'entries' in sorted order.
+func sortedKeys(entries map[string]*ManifestEntry) []string {
+	var paths []string
+	for p := range entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,177 @@
+package terminalio
+
+import (
+	"fmt"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+// An Operation groups the changes made to the file system by a single dotf command. All files
+// backed up while the operation runs are put into the same backup generation, which is created
+// the first time a file is backed up.
+//
+// Every step changing the file system is recorded in a journal together with how to undo it. The
+// exported functions of this package are atomic and undo their own steps if they fail. Steps from
+// functions that succeeded are kept in the journal until Commit is called, so the caller can use
+// Rollback to undo the whole operation if a later step fails.
+//
+// In dry-run mode no steps are carried out. Instead they are added to a plan of what would have
+// been done, which can be shown to the user.
+type Operation struct {
+	command    string
+	backups    *BackupStore
+	generation *BackupGeneration
+	journal    []*journalEntry
+	dryRun     bool
+	plan       []string        // Steps planned in dry-run mode
+	planned    map[string]bool // Paths created (true) or deleted (false) by planned steps
+	ignore     *IgnoreMatcher  // Paths left out when walking or copying directories
+	changed    []string        // Paths changed by committed steps
+	keyFile    string          // Path to the key of secrets
+	key        []byte          // Key of secrets once it has been read
+	relative   bool            // Create symlinks with targets relative to the symlink
+	manifest   *Manifest       // Settings of the managed paths
+}
+
+// OperationOptions configures how an Operation handles files.
+type OperationOptions struct {
+	BackupDir        string         // Root of the backup store
+	DryRun           bool           // Plan steps instead of carrying them out
+	Ignore           *IgnoreMatcher // Paths left out when walking or copying directories. Nil ignores nothing.
+	KeyFile          string         // Path to the key used to encrypt and decrypt secrets
+	RelativeSymlinks bool           // Create symlinks with targets relative to the symlink instead of absolute
+	Manifest         *Manifest      // Settings of the managed paths. Nil installs everything by symlinks.
+}
+
+func NewOperation(command string, opts OperationOptions) *Operation {
+	return &Operation{
+		command:  command,
+		backups:  NewBackupStore(opts.BackupDir),
+		dryRun:   opts.DryRun,
+		planned:  map[string]bool{},
+		ignore:   opts.Ignore,
+		keyFile:  opts.KeyFile,
+		relative: opts.RelativeSymlinks,
+		manifest: opts.Manifest,
+	}
+}
+
+// DryRun returns true if the operation only plans its steps.
+func (op *Operation) DryRun() bool {
+	return op.dryRun
+}
+
+// Plan returns the steps planned by the operation in dry-run mode in the order they were planned.
+func (op *Operation) Plan() []string {
+	return op.plan
+}
+
+// Ignore returns the matcher of paths left out by the operation. It may be nil.
+func (op *Operation) Ignore() *IgnoreMatcher {
+	return op.ignore
+}
+
+// Manifest returns the settings of the managed paths used by the operation. It may be nil.
+func (op *Operation) Manifest() *Manifest {
+	return op.manifest
+}
+
+// Returns the key used to encrypt and decrypt secrets. The key file is read the first time.
+func (op *Operation) secretKey() ([]byte, error) {
+	if op.key != nil {
+		return op.key, nil
+	}
+	if op.keyFile == "" {
+		return nil, &ErrKeyNotFound{op.keyFile}
+	}
+
+	key, err := readKeyFile(expandTilde(op.keyFile))
+	if err != nil {
+		return nil, err
+	}
+	op.key = key
+	return key, nil
+}
+
+// Backups returns the backup store used by the operation.
+func (op *Operation) Backups() *BackupStore {
+	return op.backups
+}
+
+// Commit makes all steps recorded so far permanent, so they are no longer undone by Rollback.
+func (op *Operation) Commit() {
+	seen := make(map[string]bool, len(op.changed))
+	for _, p := range op.changed {
+		seen[p] = true
+	}
+	for _, entry := range op.journal {
+		if entry.path != "" && !seen[entry.path] {
+			seen[entry.path] = true
+			op.changed = append(op.changed, entry.path)
+		}
+	}
+	op.journal = nil
+}
+
+// Changed returns the paths changed by committed steps in the order they were first changed. In
+// dry-run mode nothing is changed.
+func (op *Operation) Changed() []string {
+	return op.changed
+}
+
+// Atomic runs 'fn' as a single unit. If 'fn' fails, the steps it recorded are undone while steps
+// recorded before are kept.
+func (op *Operation) Atomic(fn func() error) error {
+	return op.atomic(fn)
+}
+
+// Rollback undoes all steps recorded since the last Commit in reverse order. The given cause of the
+// rollback is returned if everything was undone and otherwise an ErrRollbackFailed wrapping it.
+func (op *Operation) Rollback(cause error) error {
+	return op.rollbackTo(0, cause)
+}
+
+// Adds a step to the plan of the operation. If 'path' is not empty it is remembered whether the
+// step creates or deletes the path, so later steps can take it into account.
+func (op *Operation) planStep(path string, exists bool, description ...any) {
+	op.plan = append(op.plan, fmt.Sprint(description...))
+	if path != "" {
+		op.planned[path] = exists
+	}
+}
+
+// Checks if a file, directory or symlink exists at path. In dry-run mode paths created or deleted
+// by planned steps are taken into account.
+func (op *Operation) pathExists(path string) (bool, error) {
+	if exists, ok := op.planned[path]; ok {
+		return exists, nil
+	}
+	return checkIfPathExists(path)
+}
+
+// Backs up file and returns the path to the backed up version of the file. The given path should
+// be made absolute by the caller.
+func (op *Operation) backupFile(file string) (string, error) {
+	if op.dryRun {
+		op.planStep("", false, "backup ", file)
+		return "", nil
+	}
+
+	if op.generation == nil {
+		gen, err := op.backups.newGeneration(op.command)
+		if err != nil {
+			return "", err
+		}
+		op.generation = gen
+	}
+
+	logging.Info("Creating backup in generation", op.generation.Id)
+	path, err := op.generation.add(file)
+	if err != nil {
+		return "", err
+	}
+
+	// Backups are kept even when the operation is rolled back.
+	op.record("", nil, "backup ", file, " -> ", path)
+	return path, nil
+}
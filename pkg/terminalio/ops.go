@@ -9,13 +9,17 @@ import (
 // Copies file from userspace to the dotfiles directory and creates symlink from userspace file into
 // the newly copied file in the dotfiles dirctory. The identical relative path is used for both
 // 'homeDir' and 'dotfilesDir'.
-func AddDotfile(userspaceFile, userspaceHomedir, dotfilesDir string) error {
+func AddDotfile(op *Operation, userspaceFile, userspaceHomedir, dotfilesDir string) error {
 	absUserspaceFile, err := GetAndValidateAbsolutePath(userspaceFile)
 	if err != nil {
 
 		return err
 	}
 
+	if isIgnored(op.ignore, absUserspaceFile) {
+		return &ErrPathIgnored{absUserspaceFile}
+	}
+
 	absHomedir, err := GetAndValidateAbsolutePath(userspaceHomedir)
 	if err != nil {
 		return err
@@ -33,7 +37,7 @@ func AddDotfile(userspaceFile, userspaceHomedir, dotfilesDir string) error {
 	}
 
 	// Assert a file is not already in dotfiles dir at location
-	exists, err := CheckIfFileExists(absNewDotFile)
+	exists, err := op.pathExists(absNewDotFile)
 	if err != nil {
 		return err
 	}
@@ -41,29 +45,31 @@ func AddDotfile(userspaceFile, userspaceHomedir, dotfilesDir string) error {
 		return &ErrFileAlreadyExists{absNewDotFile}
 	}
 
-	// Backup file before copying it
-	_, err = backupFile(absUserspaceFile)
-	if err != nil {
+	if err := op.prepareManifest(absDotfilesDir); err != nil {
 		return err
 	}
 
-	// Copy file to dotfiles
-	_, err = copyFileOrDir(absUserspaceFile, absNewDotFile)
-	if err != nil {
-		return err
-	}
+	// Recorded before the file in userspace is replaced by a symlink
+	entry := newManifestEntry(absUserspaceFile, ModeSymlink)
 
-	// Remove file in userspace
-	if err := deleteFileOrDir(absUserspaceFile); err != nil {
-		return err
-	}
+	return op.atomic(func() error {
+		// Copy file to dotfiles
+		if _, err := op.copyFileOrDir(absUserspaceFile, absNewDotFile); err != nil {
+			return err
+		}
 
-	// Create symlink from userspace to the newly created file in dotfiles
-	if err := createSymlink(absUserspaceFile, absNewDotFile); err != nil {
-		return err
-	}
+		// Remove file in userspace
+		if err := op.deleteFileOrDir(absUserspaceFile); err != nil {
+			return err
+		}
+
+		// Create symlink from userspace to the newly created file in dotfiles
+		if err := op.createSymlink(absUserspaceFile, absNewDotFile); err != nil {
+			return err
+		}
 
-	return nil
+		return op.trackDotfile(absNewDotFile, absDotfilesDir, entry)
+	})
 }
 
 // Copies a file from an external location into current dotfiles directory. E.g. fromdir can be the
@@ -74,7 +80,7 @@ func AddDotfile(userspaceFile, userspaceHomedir, dotfilesDir string) error {
 // If the file to be copied is a symlink, a symlink will be created in todir pointing back to the
 // symlink in fromdir. This is to keep the semantics, that userspace links always point into their
 // own dotfiles dir.
-func CopyExternalDotfile(fpath, fromdir, todir string, confirm bool) (string, error) {
+func CopyExternalDotfile(op *Operation, fpath, fromdir, todir string, confirm bool) (string, error) {
 	absfilepath, err := GetAndValidateAbsolutePath(fpath)
 	if err != nil {
 		return "", err
@@ -102,7 +108,7 @@ func CopyExternalDotfile(fpath, fromdir, todir string, confirm bool) (string, er
 	}
 
 	// Assert a file is not already in dotfiles dir at location.
-	exists, err := CheckIfFileExists(absNewDotfile)
+	exists, err := op.pathExists(absNewDotfile)
 	if err != nil {
 		return "", err
 	}
@@ -110,6 +116,10 @@ func CopyExternalDotfile(fpath, fromdir, todir string, confirm bool) (string, er
 		return "", &ErrFileAlreadyExists{absNewDotfile}
 	}
 
+	if err := op.prepareManifest(absDotfilesDir); err != nil {
+		return "", err
+	}
+
 	// Determine whether given file is a symlink.
 	ok, err := IsFileSymlink(absfilepath)
 	if err != nil {
@@ -132,70 +142,90 @@ func CopyExternalDotfile(fpath, fromdir, todir string, confirm bool) (string, er
 			return "", err
 		}
 
-		// Create potential missing folder paths.
-		if err := os.MkdirAll(absNewDotfilePath, os.ModePerm); err != nil {
-			return "", fmt.Errorf("didn't create nested path for dotfiles file: %v", err)
-		}
+		err = op.atomic(func() error {
+			// Create potential missing folder paths.
+			if err := op.mkdirAll(absNewDotfilePath); err != nil {
+				return fmt.Errorf("didn't create nested path for dotfiles file: %v", err)
+			}
+
+			// We can now create a symlink pointing to the file pointed to by the symlink.
+			if err := op.createSymlink(absNewDotfile, relSrcFilePath); err != nil {
+				return err
+			}
 
-		// We can now create a symlink pointing to the file pointed to by the symlink.
-		if err := createSymlink(absNewDotfile, relSrcFilePath); err != nil {
+			entry := newManifestEntry(absfilepath, ModeSymlink)
+			return op.trackDotfile(absNewDotfile, absDotfilesDir, entry)
+		})
+		if err != nil {
 			return "", err
 		}
 		return absNewDotfile, nil
 	}
 
-	// Backup file before copying it
-	_, err = backupFile(absfilepath)
+	var dst string
+	err = op.atomic(func() error {
+		// Backup file before copying it
+		if _, err := op.backupFile(absfilepath); err != nil {
+			return err
+		}
+
+		// Copy file to dotfiles
+		dst, err = op.copyFileOrDir(absfilepath, absNewDotfile)
+		if err != nil {
+			return err
+		}
+
+		entry := newManifestEntry(absfilepath, ModeSymlink)
+		return op.trackDotfile(absNewDotfile, absDotfilesDir, entry)
+	})
 	if err != nil {
 		return "", err
 	}
-
-	// Copy file to dotfiles
-	return copyFileOrDir(absfilepath, absNewDotfile)
+	return dst, nil
 }
 
 // Writes a file to disk
-func WriteFile(fpath string, contents []byte, overwrite bool) error {
-	exists, err := CheckIfFileExists(fpath)
+func WriteFile(op *Operation, file string, contents []byte, overwrite bool) error {
+	fpath, err := getAbsolutePath(file)
 	if err != nil {
 		return err
 	}
 
-	if exists {
-		if !overwrite {
-			return &ErrAbortOnOverwrite{fpath}
-		}
-
-		// Backup file before deleting it
-		if _, err = backupFile(fpath); err != nil {
-			return err
-		}
-
-		// Delete file
-		if err := deleteFile(fpath); err != nil {
-			return err
-		}
+	exists, err := op.pathExists(fpath)
+	if err != nil {
+		return err
 	}
 
-	// Create new file
-	if err := writeFile(fpath, contents); err != nil {
-		return err
+	if exists && !overwrite {
+		return &ErrAbortOnOverwrite{fpath}
 	}
 
-	return nil
+	return op.atomic(func() error {
+		if exists {
+			// Delete file
+			if err := op.deleteFileOrDir(fpath); err != nil {
+				return err
+			}
+		}
+
+		// Create new file
+		return op.writeFile(fpath, contents, 0644)
+	})
 }
 
 // Installs a dotfile into its relative equal location in userspace by way of a symlink in userspace
-// pointing back to the file in dotfiles. The userspace file will be removed if 'overwrite' is true.
-// Both the filepath inside dotfile as well as in userspace can be given.
-func InstallDotfile(file, userspaceDir, dotfilesDir string, overwrite bool) error {
+// pointing back to the file in dotfiles. Templates are rendered and secrets decrypted into userspace
+// instead, and dotfiles with the install mode ModeCopy in the manifest of the operation are copied.
+// The userspace file will be removed if 'overwrite' is true. Both the filepath inside dotfile as
+// well as in userspace can be given.
+func InstallDotfile(op *Operation, file, userspaceDir, dotfilesDir string, overwrite bool) error {
 	info, err := getFileLocationInfo(file, userspaceDir, dotfilesDir)
 	if err != nil {
 		return err
 	}
 
 	// Check whether dotfile exists
-	exists, err := CheckIfFileExists(info.dotfilesFile)
+	exists, err := op.pathExists(info.dotfilesFile)
 	if err != nil {
 		return err
 	}
@@ -203,55 +233,196 @@ func InstallDotfile(file, userspaceDir, dotfilesDir string, overwrite bool) erro
 		return &ErrFileNotFound{info.dotfilesFile}
 	}
 
-	// Check whtether userspace file already exists
-	exists, err = CheckIfFileExists(info.userspaceFile)
+	absDotfilesDir, err := getAbsolutePath(dotfilesDir)
 	if err != nil {
 		return err
 	}
-	if exists {
-		if !overwrite {
-			return &ErrAbortOnOverwrite{info.userspaceFile}
+
+	if isTemplate(info.dotfilesFile) {
+		return installTemplate(op, info, Layers{absDotfilesDir}, overwrite)
+	}
+
+	if isSecret(info.dotfilesFile) {
+		return installSecret(op, info, overwrite)
+	}
+
+	if op.manifest.modeOf(info.dotfilesFile, absDotfilesDir) == ModeCopy {
+		return installCopy(op, info, overwrite)
+	}
+
+	// Check whtether userspace file or a possibly dangling symlink already exists
+	exists, err = op.pathExists(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+	if exists && !overwrite {
+		return &ErrAbortOnOverwrite{info.userspaceFile}
+	}
+
+	return op.atomic(func() error {
+		if exists {
+			// Remove file in userspace. Symlinks are removed without backup as the file they point
+			// to is left untouched, other files are backed up first.
+			if err := op.deleteFileOrDir(info.userspaceFile); err != nil {
+				return err
+			}
 		}
 
-		// Backup file before copying it
-		if _, err = backupFile(info.userspaceFile); err != nil {
+		// Create potential missing folder paths.
+		if err := op.mkdirAll(filepath.Dir(info.userspaceFile)); err != nil {
+			return fmt.Errorf("didn't create nested path for userspace file: %v", err)
+		}
+
+		// Create symlink in userspace pointing to dotfile
+		return op.createSymlink(info.userspaceFile, info.dotfilesFile)
+	})
+}
+
+// InstallLayeredDotfile works like InstallDotfile for dotfiles spread over several 'layers'. A file
+// in userspace is installed from the most specific layer containing it and templates are rendered
+// with the variables of all layers. A directory found in more than one layer or containing templates
+// is created as a regular directory in userspace and its contents are installed individually.
+func InstallLayeredDotfile(op *Operation, file, userspaceDir string, layers Layers, overwrite bool) error {
+	absLayers, err := layers.absolute()
+	if err != nil {
+		return err
+	}
+
+	info, layer, err := absLayers.locate(file, userspaceDir)
+	if err != nil {
+		return err
+	}
+
+	if isIgnored(op.ignore, info.dotfilesFile) {
+		return &ErrPathIgnored{info.dotfilesFile}
+	}
+
+	rel, err := filepath.Rel(layer, info.dotfilesFile)
+	if err != nil {
+		return err
+	}
+
+	if isTemplate(info.dotfilesFile) {
+		if exists, _ := checkIfPathExists(info.dotfilesFile); !exists {
+			return &ErrFileNotFound{info.dotfilesFile}
+		}
+		return installTemplate(op, info, absLayers, overwrite)
+	}
+
+	if isSecret(info.dotfilesFile) {
+		if exists, _ := checkIfPathExists(info.dotfilesFile); !exists {
+			return &ErrFileNotFound{info.dotfilesFile}
+		}
+		return installSecret(op, info, overwrite)
+	}
+
+	if rel != "." && !absLayers.expands(rel, op.ignore) {
+		return InstallDotfile(op, info.dotfilesFile, userspaceDir, layer, overwrite)
+	}
+
+	// Anything but a regular directory is in the way of the contents of the expanded directory
+	isDir := false
+	if ufile, err := os.Lstat(info.userspaceFile); err == nil {
+		isDir = ufile.IsDir()
+	}
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+	replace := exists && !isDir
+	if replace && !overwrite {
+		return &ErrAbortOnOverwrite{info.userspaceFile}
+	}
+
+	return op.atomic(func() error {
+		if replace {
+			if err := op.deleteFileOrDir(info.userspaceFile); err != nil {
+				return err
+			}
+		}
+
+		if err := op.mkdirAll(info.userspaceFile); err != nil {
 			return err
 		}
 
-		// Remove file in userspace
-		if err := deleteFile(info.userspaceFile); err != nil {
+		statuses, err := GetLayeredDotfilesStatusAt(info.userspaceFile, userspaceDir, absLayers, op.ignore, op.manifest)
+		if err != nil {
 			return err
 		}
+
+		for _, s := range statuses {
+			if s.State == StateInstalled || s.UserspaceFile == info.userspaceFile {
+				continue
+			}
+			// Everything below a replaced file was removed along with it
+			if err := InstallLayeredDotfile(op, s.DotfilesFile, userspaceDir, absLayers, overwrite || replace); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Removes the symlink in userspace pointing to the dotfile or the file written from it if it is a
+// template, a secret or a copy. The dotfile itself is left untouched. Both the filepath inside dotfiles as well as in
+// userspace can be given.
+func UninstallDotfile(op *Operation, file, userspaceDir, dotfilesDir string) error {
+	info, err := getFileLocationInfo(file, userspaceDir, dotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	absDotfilesDir, err := getAbsolutePath(dotfilesDir)
+	if err != nil {
+		return err
 	}
+	isCopy := op.manifest.modeOf(info.dotfilesFile, absDotfilesDir) == ModeCopy
 
-	// Create potential missing folder paths.
-	if err := os.MkdirAll(filepath.Dir(info.dotfilesFile), os.ModePerm); err != nil {
-		return fmt.Errorf("didn't create nested path for dotfiles file: %v", err)
+	if isGenerated(info.dotfilesFile) || isCopy {
+		ufile, err := os.Lstat(info.userspaceFile)
+		if err != nil {
+			return &ErrFileNotFound{info.userspaceFile}
+		}
+		if ufile.Mode().IsRegular() || (isCopy && ufile.IsDir()) {
+			return op.atomic(func() error {
+				return op.deleteFileOrDir(info.userspaceFile)
+			})
+		}
 	}
 
-	if err := os.MkdirAll(filepath.Dir(info.userspaceFile), os.ModePerm); err != nil {
-		return fmt.Errorf("didn't create nested path for userspace file: %v", err)
+	ok, err := IsFileSymlink(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &ErrSymlinkNotFound{info.userspaceFile}
 	}
 
-	// Create symlink in userspace pointing to dotfile
-	if err := createSymlink(info.userspaceFile, info.dotfilesFile); err != nil {
+	target, err := resolveSymlink(info.userspaceFile)
+	if err != nil {
 		return err
 	}
+	if target != filepath.Clean(info.dotfilesFile) {
+		return &ErrSymlinkNotFound{info.userspaceFile}
+	}
 
-	return nil
+	return op.atomic(func() error {
+		return op.deleteFileOrDir(info.userspaceFile)
+	})
 }
 
 // Reverts the insertion of a file into the dotfiles directory and return it to its original
 // location in userspace. The symlink is removed first. The operation can be applied both to the
-// symlink in userspace and the actual file in the dotfiles directory.
-func RevertDotfile(file, userspaceDir, dotfilesDir string) error {
+// symlink in userspace and the actual file in the dotfiles directory. A dotfile installed by copying
+// it is reverted by keeping the copy in userspace. The file is no longer recorded in the manifest
+// afterwards, unless it is still found in another dotfiles directory.
+func RevertDotfile(op *Operation, file, userspaceDir, dotfilesDir string) error {
 	info, err := getFileLocationInfo(file, userspaceDir, dotfilesDir)
 	if err != nil {
 		return err
 	}
 
 	dotfile := info.dotfilesFile
-	usersymlink := info.userspaceFile
 
 	// Check whtether file and symlink exists
 	ok, err := CheckIfFileExists(dotfile)
@@ -262,7 +433,42 @@ func RevertDotfile(file, userspaceDir, dotfilesDir string) error {
 		return &ErrFileNotFound{dotfile}
 	}
 
-	ok, err = IsFileSymlink(usersymlink)
+	absDotfilesDir, err := getAbsolutePath(dotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	if err := op.prepareManifest(absDotfilesDir); err != nil {
+		return err
+	}
+
+	return op.atomic(func() error {
+		var err error
+		switch {
+		case isTemplate(dotfile):
+			err = revertTemplate(op, info, dotfilesDir)
+		case isSecret(dotfile):
+			err = revertSecret(op, info)
+		case op.manifest.modeOf(dotfile, absDotfilesDir) == ModeCopy:
+			err = revertCopy(op, info)
+		default:
+			err = revertSymlink(op, info)
+		}
+		if err != nil {
+			return err
+		}
+
+		return op.untrackDotfile(dotfile, absDotfilesDir)
+	})
+}
+
+// Reverts a dotfile installed by a symlink by replacing the symlink in userspace with the dotfile
+// and removing the dotfile from dotfiles.
+func revertSymlink(op *Operation, info *fileLocationInfo) error {
+	dotfile := info.dotfilesFile
+	usersymlink := info.userspaceFile
+
+	ok, err := IsFileSymlink(usersymlink)
 	if err != nil {
 		return err
 	}
@@ -270,25 +476,123 @@ func RevertDotfile(file, userspaceDir, dotfilesDir string) error {
 		return &ErrSymlinkNotFound{usersymlink}
 	}
 
-	// Backup file before copying it
-	if _, err = backupFile(dotfile); err != nil {
+	return op.atomic(func() error {
+		// Remove symlink in userspace
+		if err := op.deleteFileOrDir(usersymlink); err != nil {
+			return err
+		}
+
+		// Copy dotfile back to userspace
+		if _, err := op.copyFileOrDir(dotfile, usersymlink); err != nil {
+			return err
+		}
+
+		// Remove file in dotfiles
+		return op.deleteFileOrDir(dotfile)
+	})
+}
+
+// Reverts a template by keeping the file rendered from it in userspace, or rendering it if it is
+// missing, and removing the template from dotfiles.
+func revertTemplate(op *Operation, info *fileLocationInfo, dotfilesDir string) error {
+	absDotfilesDir, err := getAbsolutePath(dotfilesDir)
+	if err != nil {
 		return err
 	}
 
-	// Remove symlink in userspace
-	if err := deleteFile(usersymlink); err != nil {
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
 		return err
 	}
 
-	// Copy dotfile back to userspace
-	if _, err = copyFileOrDir(dotfile, usersymlink); err != nil {
+	return op.atomic(func() error {
+		if !exists {
+			data, err := loadTemplateData(Layers{absDotfilesDir})
+			if err != nil {
+				return err
+			}
+			rendered, err := renderTemplate(info.dotfilesFile, data)
+			if err != nil {
+				return err
+			}
+			if err := op.mkdirAll(filepath.Dir(info.userspaceFile)); err != nil {
+				return err
+			}
+			if err := op.writeFile(info.userspaceFile, rendered, 0644); err != nil {
+				return err
+			}
+		}
+
+		// Remove file in dotfiles
+		return op.deleteFileOrDir(info.dotfilesFile)
+	})
+}
+
+// Reverts a secret by keeping the file decrypted from it in userspace, or decrypting it if it is
+// missing, and removing the secret from dotfiles.
+func revertSecret(op *Operation, info *fileLocationInfo) error {
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
 		return err
 	}
 
-	// Remove file in dotfiles
-	if err := deleteFileOrDir(dotfile); err != nil {
+	return op.atomic(func() error {
+		if !exists {
+			if err := installSecret(op, info, false); err != nil {
+				return err
+			}
+		}
+
+		// Remove file in dotfiles
+		return op.deleteFileOrDir(info.dotfilesFile)
+	})
+}
+
+// Restores files from the backup generation with the given 'id' to their original location. If
+// 'file' is not empty only the entry backing up that path is restored. Files currently found at the
+// original location are backed up as part of 'op' before they are replaced.
+func RestoreBackup(op *Operation, id, file string) error {
+	gen, err := op.Backups().GetGeneration(id)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	entries := gen.Entries
+	if file != "" {
+		absFile, err := getAbsolutePath(file)
+		if err != nil {
+			return err
+		}
+		entry := gen.find(absFile)
+		if entry == nil {
+			return &ErrFileNotFound{absFile}
+		}
+		entries = []*BackupEntry{entry}
+	}
+
+	return op.atomic(func() error {
+		for _, e := range entries {
+			exists, err := op.pathExists(e.Original)
+			if err != nil {
+				return err
+			}
+
+			// Symlinks are removed without backup as the file they point to is left untouched,
+			// other files are backed up first.
+			if exists {
+				if err := op.deleteFileOrDir(e.Original); err != nil {
+					return err
+				}
+			}
+
+			if err := op.mkdirAll(filepath.Dir(e.Original)); err != nil {
+				return err
+			}
+
+			if _, err := op.copyFileOrDir(e.Backup, e.Original); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -16,6 +16,11 @@ import (
 * assertion. This requires that all units are tested individually.
  */
 
+// Returns an operation that keeps its backups in a temporary directory.
+func newTestOperation(t *testing.T) *Operation {
+	return NewOperation("test", OperationOptions{BackupDir: t.TempDir()})
+}
+
 func Test_WriteFile(t *testing.T) {
 	env := test.NewTestEnvironment()
 	defer env.Cleanup()
@@ -23,7 +28,8 @@ func Test_WriteFile(t *testing.T) {
 	expected := []byte("hello my friend\n")
 
 	t.Run("File is written and backed up successfully", func(t *testing.T) {
-		err := WriteFile(file.Path, expected, true)
+		op := newTestOperation(t)
+		err := WriteFile(op, file.Path, expected, true)
 		if err != nil {
 			t.Errorf("failed running code under test: %v", err)
 		}
@@ -40,7 +46,7 @@ func Test_WriteFile(t *testing.T) {
 		}
 
 		// Assert on backup
-		_, err = os.ReadFile("/tmp/dotf-go/backups/" + file.Path)
+		_, err = os.ReadFile(op.generation.backupPath(file.Path))
 		if err != nil {
 			t.Errorf("failed reading backup: %v", err)
 		}
@@ -73,7 +79,7 @@ func Test_InstallDotfile_creates_existing_symlink_in_userspace_with_overwrite(t
 		test.FailHardMsg("This file should at this point", exists, true, t)
 	}
 
-	err = InstallDotfile(dsomefile.Path, uspace.Path, dfiles.Path, true)
+	err = InstallDotfile(newTestOperation(t), dsomefile.Path, uspace.Path, dfiles.Path, true)
 	if err != nil {
 		test.FailHard(err, "No error should have happened", t)
 	}
@@ -105,7 +111,7 @@ func Test_InstallDotfile_creates_existing_symlink_in_userspace_no_overwrite(t *t
 		t.Fatal()
 	}
 
-	err = InstallDotfile(dsomefile.Path, uspace.Path, dfiles.Path, false)
+	err = InstallDotfile(newTestOperation(t), dsomefile.Path, uspace.Path, dfiles.Path, false)
 	if err != nil {
 		var abortErr *ErrAbortOnOverwrite
 		if !errors.As(err, &abortErr) {
@@ -133,7 +139,7 @@ func Test_InstallDotfile_creates_not_existing_symlink_in_userspace_no_overwrite(
 	dsomefile := dfiles.AddTempFile()
 	uspaceSymlinkPath := filepath.Join(uspace.Path, filepath.Base(dsomefile.Path))
 
-	err := InstallDotfile(dsomefile.Path, uspace.Path, dfiles.Path, false)
+	err := InstallDotfile(newTestOperation(t), dsomefile.Path, uspace.Path, dfiles.Path, false)
 	if err != nil {
 		test.FailHard(err, "No error should have happened", t)
 	}
@@ -173,7 +179,7 @@ func Test_RevertDotfile_deletes_symlink_and_moves_file_back_userspace(t *testing
 	}
 
 	// Actual test call
-	err = RevertDotfile(uspaceSymlinkPath, uspace.Path, dfiles.Path)
+	err = RevertDotfile(newTestOperation(t), uspaceSymlinkPath, uspace.Path, dfiles.Path)
 	if err != nil {
 		test.FailHard(err, "No error should have happened", t)
 	}
@@ -222,7 +228,7 @@ func Test_RevertDotfile_deletes_symlink_and_moves_file_back_dotfiles(t *testing.
 	}
 
 	// Actual test call
-	err = RevertDotfile(dsomefile.Path, uspace.Path, dfiles.Path)
+	err = RevertDotfile(newTestOperation(t), dsomefile.Path, uspace.Path, dfiles.Path)
 	if err != nil {
 		test.FailHard(err, "No error should have happened", t)
 	}
@@ -252,7 +258,7 @@ func Test_AddFileToDotfiles_unknown_path_gives_error(t *testing.T) {
 	dotfilesdir := "adsf"
 
 	expected := &ErrFileNotFound{}
-	actual := AddDotfile(file, userspacefile, dotfilesdir)
+	actual := AddDotfile(newTestOperation(t), file, userspacefile, dotfilesdir)
 
 	if !errors.As(actual, &expected) {
 		test.Fail(actual, expected, t)
@@ -272,13 +278,14 @@ func Test_AddFileToDotfiles_successfully_copies_file_creates_symlink(t *testing.
 	userspaceFile := dir.AddTempFile()
 
 	// Function under test
-	err := AddDotfile(userspaceFile.Path, userspacedir.Path, dfilesdir.Path)
+	op := newTestOperation(t)
+	err := AddDotfile(op, userspaceFile.Path, userspacedir.Path, dfilesdir.Path)
 	if err != nil {
 		test.Fail(err, "No error should have happened", t)
 	}
 
 	expectedDotfilesFile := filepath.Join(dfilesdir.Path, userdirpath, filepath.Base(userspaceFile.Path))
-	expectedBackupFile := filepath.Join("/tmp/dotf-go/backups", userspaceFile.Path)
+	expectedBackupFile := op.generation.backupPath(userspaceFile.Path)
 
 	// check if new file in dotfiles exist
 	if exists, _ := CheckIfFileExists(expectedDotfilesFile); !exists {
@@ -316,13 +323,14 @@ func Test_CopyDotfile_successfully_copies_file_into_dotfiles(t *testing.T) {
 	userspaceFile := dir.AddTempFile()
 
 	// Function under test
-	dst, err := CopyExternalDotfile(userspaceFile.Path, userspacedir.Path, dfilesdir.Path, false)
+	op := newTestOperation(t)
+	dst, err := CopyExternalDotfile(op, userspaceFile.Path, userspacedir.Path, dfilesdir.Path, false)
 	if err != nil {
 		test.Fail(err, "No error should have happened", t)
 	}
 
 	expectedDotfilesFile := filepath.Join(dfilesdir.Path, userdirpath, filepath.Base(userspaceFile.Path))
-	expectedBackupFile := filepath.Join("/tmp/dotf-go/backups", userspaceFile.Path)
+	expectedBackupFile := op.generation.backupPath(userspaceFile.Path)
 
 	// check if new file in dotfiles exist
 	if exists, _ := CheckIfFileExists(expectedDotfilesFile); !exists {
@@ -0,0 +1,279 @@
+package terminalio
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mortenskoett/dotf-go/pkg/logging"
+)
+
+// SecretSuffix marks a dotfile as encrypted. A secret is decrypted into userspace without the
+// suffix instead of being symlinked, e.g. '.netrc.dotfsecret' is decrypted to '.netrc'.
+const SecretSuffix = ".dotfsecret"
+
+// Header of encrypted dotfiles. The rest of the file is the base64 encoded nonce and ciphertext.
+const secretHeader = "dotf-secret:v1:"
+
+// Permissions of files decrypted into userspace and of the key file.
+const secretPerm os.FileMode = 0600
+
+// Size in bytes of the AES-256 key.
+const keySize = 32
+
+// Returns true if the dotfile at 'path' is encrypted.
+func isSecret(path string) bool {
+	return strings.HasSuffix(path, SecretSuffix) && len(filepath.Base(path)) > len(SecretSuffix)
+}
+
+// Returns true if the dotfile at 'path' is written into userspace as a regular file instead of being
+// symlinked, which is the case for templates and secrets.
+func isGenerated(path string) bool {
+	return isTemplate(path) || isSecret(path)
+}
+
+// Returns the path of the file in userspace for the dotfile 'path' by removing the suffix of
+// templates and secrets.
+func trimDotfileSuffix(path string) string {
+	if isTemplate(path) {
+		return strings.TrimSuffix(path, TemplateSuffix)
+	}
+	if isSecret(path) {
+		return strings.TrimSuffix(path, SecretSuffix)
+	}
+	return path
+}
+
+// Reads the hex encoded key used to encrypt secrets from 'path'.
+func readKeyFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &ErrKeyNotFound{path}
+		}
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(key) != keySize {
+		return nil, &ErrInvalidKey{path}
+	}
+	return key, nil
+}
+
+// Creates a new random key and writes it hex encoded to 'path' readable only by the user.
+func createKeyFile(op *Operation, path string) ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if err := op.mkdirAll(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if err := op.writeFile(path, []byte(hex.EncodeToString(key)+"\n"), secretPerm); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypts 'plaintext' using AES-256-GCM with 'key'.
+func encryptSecret(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return []byte(secretHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// Decrypts the contents of the encrypted dotfile at 'path' using 'key'.
+func decryptSecret(key []byte, path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, ok := strings.CutPrefix(string(bytes.TrimSpace(contents)), secretHeader)
+	if !ok {
+		return nil, &ErrDecryptSecret{path}
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, &ErrDecryptSecret{path}
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, &ErrDecryptSecret{path}
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, &ErrDecryptSecret{path}
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypts a file from userspace into the dotfiles directory. The file in userspace is kept as it
+// is, because a symlink would point to the encrypted file. The key is created if it does not exist.
+func AddSecretDotfile(op *Operation, userspaceFile, userspaceHomedir, dotfilesDir string) error {
+	absUserspaceFile, err := GetAndValidateAbsolutePath(userspaceFile)
+	if err != nil {
+		return err
+	}
+
+	if isIgnored(op.ignore, absUserspaceFile) {
+		return &ErrPathIgnored{absUserspaceFile}
+	}
+
+	ufile, err := os.Lstat(absUserspaceFile)
+	if err != nil {
+		return err
+	}
+	if !ufile.Mode().IsRegular() {
+		return &ErrSecretNotRegularFile{absUserspaceFile}
+	}
+
+	absHomedir, err := GetAndValidateAbsolutePath(userspaceHomedir)
+	if err != nil {
+		return err
+	}
+
+	absDotfilesDir, err := GetAndValidateAbsolutePath(dotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	absNewDotFile, err := replacePrefixPath(absUserspaceFile, absHomedir, absDotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	// Neither a plain nor an encrypted version may already be in dotfiles
+	for _, existing := range []string{absNewDotFile, absNewDotFile + SecretSuffix} {
+		exists, err := op.pathExists(existing)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return &ErrFileAlreadyExists{existing}
+		}
+	}
+
+	if err := op.prepareManifest(absDotfilesDir); err != nil {
+		return err
+	}
+
+	plaintext, err := os.ReadFile(absUserspaceFile)
+	if err != nil {
+		return err
+	}
+
+	return op.atomic(func() error {
+		key, err := op.secretKey()
+		var notFound *ErrKeyNotFound
+		if errors.As(err, &notFound) {
+			logging.Info("Creating key for secrets at", op.keyFile)
+			key, err = createKeyFile(op, op.keyFile)
+		}
+		if err != nil {
+			return err
+		}
+
+		encrypted, err := encryptSecret(key, plaintext)
+		if err != nil {
+			return err
+		}
+
+		if err := op.mkdirAll(filepath.Dir(absNewDotFile)); err != nil {
+			return fmt.Errorf("didn't create nested path for dotfile: %v", err)
+		}
+		if err := op.writeFile(absNewDotFile+SecretSuffix, encrypted, 0644); err != nil {
+			return err
+		}
+
+		entry := newManifestEntry(absUserspaceFile, ModeGenerated)
+		return op.trackDotfile(absNewDotFile+SecretSuffix, absDotfilesDir, entry)
+	})
+}
+
+// Decrypts the secret described by 'info' into userspace readable only by the user. The file in
+// userspace will be removed if 'overwrite' is true.
+func installSecret(op *Operation, info *fileLocationInfo, overwrite bool) error {
+	key, err := op.secretKey()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := decryptSecret(key, info.dotfilesFile)
+	if err != nil {
+		return err
+	}
+
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+	if exists && !overwrite {
+		return &ErrAbortOnOverwrite{info.userspaceFile}
+	}
+
+	return op.atomic(func() error {
+		if exists {
+			if err := op.deleteFileOrDir(info.userspaceFile); err != nil {
+				return err
+			}
+		}
+
+		if err := op.mkdirAll(filepath.Dir(info.userspaceFile)); err != nil {
+			return fmt.Errorf("didn't create nested path for userspace file: %v", err)
+		}
+
+		return op.writeFile(info.userspaceFile, plaintext, secretPerm)
+	})
+}
+
+// Returns the files in 'files' relative to 'repoPath' that are plaintext copies of an encrypted
+// dotfile next to them. Files that were removed are not copies.
+func plaintextSecrets(repoPath string, files []string) []string {
+	var plaintext []string
+	for _, f := range files {
+		if isSecret(f) {
+			continue
+		}
+		if exists, _ := checkIfPathExists(filepath.Join(repoPath, f)); !exists {
+			continue
+		}
+		if exists, _ := checkIfPathExists(filepath.Join(repoPath, f+SecretSuffix)); exists {
+			plaintext = append(plaintext, f)
+		}
+	}
+	return plaintext
+}
@@ -0,0 +1,134 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_decryptSecret_fails_with_other_key(t *testing.T) {
+	key := make([]byte, keySize)
+	other := make([]byte, keySize)
+	other[0] = 1
+
+	encrypted, err := encryptSecret(key, []byte("machine example.com password hunter2\n"))
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	file := writeLayerFile(t, t.TempDir(), ".netrc"+SecretSuffix, string(encrypted))
+
+	plaintext, err := decryptSecret(key, file)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual("machine example.com password hunter2\n", string(plaintext), t)
+
+	_, err = decryptSecret(other, file)
+	if _, ok := err.(*ErrDecryptSecret); !ok {
+		test.FailHard(err, &ErrDecryptSecret{}, t)
+	}
+}
+
+func Test_AddSecretDotfile_encrypts_and_InstallDotfile_decrypts(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+	keyFile := filepath.Join(t.TempDir(), "key")
+	newOp := func() *Operation {
+		return NewOperation("test", OperationOptions{BackupDir: t.TempDir(), KeyFile: keyFile})
+	}
+
+	secret := "machine example.com password hunter2\n"
+	ufile := writeLayerFile(t, uspace, ".netrc", secret)
+
+	if err := AddSecretDotfile(newOp(), ufile, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	encrypted, err := os.ReadFile(filepath.Join(dfiles, ".netrc"+SecretSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encrypted) == secret {
+		t.Error("expected the dotfile to be encrypted")
+	}
+	if _, err := readKeyFile(keyFile); err != nil {
+		test.FailHard(err, "Expected key to be created", t)
+	}
+
+	if err := os.Remove(ufile); err != nil {
+		t.Fatal(err)
+	}
+
+	// The secret is found from its location in userspace
+	if err := InstallDotfile(newOp(), ufile, uspace, dfiles, false); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	info, err := os.Lstat(ufile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(secretPerm, info.Mode().Perm(), t)
+
+	contents, err := os.ReadFile(ufile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(secret, string(contents), t)
+}
+
+func Test_AddSecretDotfile_records_generated_mode(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	syncDir := t.TempDir()
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	manifest, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	op := NewOperation("test", OperationOptions{
+		BackupDir: t.TempDir(),
+		KeyFile:   filepath.Join(t.TempDir(), "key"),
+		Manifest:  manifest,
+	})
+
+	ufile := writeLayerFile(t, uspace, ".netrc", "machine example.com password hunter2\n")
+	if err := AddSecretDotfile(op, ufile, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	loaded, err := LoadManifest(syncDir)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual(ModeGenerated, loaded.Mode(dfiles, ".netrc"+SecretSuffix), t)
+
+	// Only templates and secrets are generated
+	writeLayerFile(t, syncDir, ManifestName, "[files.\".netrc\"]\nmode = \"generated\"\n")
+	if _, err := LoadManifest(syncDir); err == nil {
+		test.FailHard(err, &ErrMalformedManifest{}, t)
+	}
+}
+
+func Test_plaintextSecrets_finds_copies_next_to_secrets(t *testing.T) {
+	repo := t.TempDir()
+	writeLayerFile(t, repo, "host/.netrc"+SecretSuffix, "encrypted")
+	writeLayerFile(t, repo, "host/.netrc", "plaintext")
+	writeLayerFile(t, repo, "host/.bashrc", "plaintext")
+
+	files := []string{"host/.netrc" + SecretSuffix, "host/.netrc", "host/.bashrc", "host/.removed"}
+	plaintext := plaintextSecrets(repo, files)
+
+	if len(plaintext) != 1 {
+		test.FailHardMsg("Unexpected number of plaintext secrets", len(plaintext), 1, t)
+	}
+	test.AssertEqual("host/.netrc", plaintext[0], t)
+}
@@ -0,0 +1,273 @@
+package terminalio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// DotfileState describes how a file inside the dotfiles directory is wired into userspace.
+type DotfileState int
+
+const (
+	StateInstalled      DotfileState = iota // Symlink in userspace points to the dotfile
+	StateMissing                            // No file exists at the location in userspace
+	StateConflicting                        // A regular file or directory is in the way in userspace
+	StateForeignSymlink                     // Symlink in userspace points to some other file
+	StateDangling                           // Symlink in userspace points to a file that does not exist
+	StateDrifted                            // File rendered from a template differs from the template
+	StateModified                           // Copy in userspace was changed after the dotfile
+	StateOutdated                           // Dotfile was changed after its copy in userspace
+)
+
+func (s DotfileState) String() string {
+	switch s {
+	case StateInstalled:
+		return "installed"
+	case StateMissing:
+		return "missing"
+	case StateConflicting:
+		return "conflicting"
+	case StateForeignSymlink:
+		return "foreign symlink"
+	case StateDangling:
+		return "dangling"
+	case StateDrifted:
+		return "drifted"
+	case StateModified:
+		return "modified"
+	case StateOutdated:
+		return "outdated"
+	}
+	return "unknown"
+}
+
+// DotfileStatus contains the state of a single entry in the dotfiles directory.
+type DotfileStatus struct {
+	State         DotfileState
+	DotfilesFile  string // Absolute path to file in dotfiles
+	UserspaceFile string // Absolute path to file in userspace
+	LinkTarget    string // Target of the symlink in userspace if there is one
+	Layer         string // Absolute path to the dotfiles directory (layer) containing the file
+}
+
+// GetDotfilesStatus walks the dotfiles directory and determines for each entry how it is wired into
+// userspace. Directories that also exist as regular directories in userspace are descended into and
+// not reported themselves, as they only contain other entries. Directories that are symlinked or
+// missing as a whole are reported as a single entry.
+func GetDotfilesStatus(userspaceDir, dotfilesDir string) ([]*DotfileStatus, error) {
+	return GetDotfilesStatusAt(dotfilesDir, userspaceDir, dotfilesDir)
+}
+
+// GetDotfilesStatusAt works like GetDotfilesStatus but only walks the subtree given by 'path'. The
+// path can point both inside dotfiles and to the equal location in userspace. Only the paths that
+// are always ignored are left out.
+func GetDotfilesStatusAt(path, userspaceDir, dotfilesDir string) ([]*DotfileStatus, error) {
+	ignore := NewIgnoreMatcher([]string{dotfilesDir}, defaultIgnorePatterns...)
+	return GetLayeredDotfilesStatusAt(path, userspaceDir, Layers{dotfilesDir}, ignore, nil)
+}
+
+// GetLayeredDotfilesStatus works like GetDotfilesStatus for dotfiles spread over several 'layers'.
+// Every dotfile is reported once, from the most specific layer containing it. Paths ignored by
+// 'ignore' are not reported. Dotfiles installed by copying them according to 'manifest' are compared
+// with their copy in userspace.
+func GetLayeredDotfilesStatus(userspaceDir string, layers Layers, ignore *IgnoreMatcher, manifest *Manifest) ([]*DotfileStatus, error) {
+	if len(layers) == 0 {
+		return nil, nil
+	}
+	return GetLayeredDotfilesStatusAt(layers[len(layers)-1], userspaceDir, layers, ignore, manifest)
+}
+
+// GetLayeredDotfilesStatusAt works like GetLayeredDotfilesStatus but only walks the subtree given by
+// 'path'. The path can point inside any of the layers or to the equal location in userspace.
+// Directories found in more than one layer or containing templates or secrets are never reported as
+// missing, as their contents are installed individually. Templates are installed if the file in
+// userspace equals the rendered template and drifted otherwise. Secrets are installed if a regular
+// file is found in userspace, as they cannot be compared without the key. Copies are installed if
+// they equal the dotfile and otherwise modified or outdated depending on which side changed last.
+func GetLayeredDotfilesStatusAt(path, userspaceDir string, layers Layers, ignore *IgnoreMatcher, manifest *Manifest) ([]*DotfileStatus, error) {
+	absLayers, err := layers.absolute()
+	if err != nil {
+		return nil, err
+	}
+
+	rootinfo, rootlayer, err := absLayers.locate(path, userspaceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(rootlayer, rootinfo.dotfilesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := absLayers.walkManaged(rel, ignore, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 && rel != "." {
+		if exists, _ := checkIfPathExists(rootinfo.dotfilesFile); exists && manifest.tracking(rootlayer) {
+			return nil, &ErrFileNotManaged{rootinfo.dotfilesFile}
+		}
+		return nil, &ErrFileNotFound{rootinfo.dotfilesFile}
+	}
+
+	data, err := loadTemplateData(absLayers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories containing templates or secrets cannot be symlinked as a whole
+	withGenerated := make(map[string]bool)
+	for p, entry := range entries {
+		if !entry.isDir && isGenerated(p) {
+			for dir := filepath.Dir(p); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+				withGenerated[dir] = true
+			}
+		}
+	}
+
+	var statuses []*DotfileStatus
+	reported := make(map[string]bool) // Directories reported as a whole
+
+	for _, p := range sortedPaths(entries) {
+		if insideReported(p, reported) {
+			continue
+		}
+		entry := entries[p]
+
+		info, err := getFileLocationInfo(filepath.Join(entry.layer, p), userspaceDir, entry.layer)
+		if err != nil {
+			return nil, err
+		}
+
+		status, err := getDotfileStatus(info, data, manifest.Mode(entry.layer, p), ignore)
+		if err != nil {
+			return nil, err
+		}
+
+		// Directory exists in both places so only its contents are of interest.
+		if status == nil {
+			continue
+		}
+
+		if entry.isDir && (withGenerated[p] || absLayers.isShared(p)) {
+			// Contents of a missing expanded directory are reported individually
+			if status.State == StateMissing {
+				continue
+			}
+			// Anything but a regular directory is in the way of the contents
+			status.State = StateConflicting
+		}
+
+		status.Layer = entry.layer
+		statuses = append(statuses, status)
+
+		if entry.isDir {
+			reported[p] = true
+		}
+	}
+
+	return statuses, nil
+}
+
+// Returns whether one of the parent directories of 'path' is found in 'reported'.
+func insideReported(path string, reported map[string]bool) bool {
+	for dir := filepath.Dir(path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if reported[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines the state of the dotfile described by 'info'. If both the dotfile and the userspace
+// file are regular directories nil is returned, because the directory merely contains other
+// dotfiles. Templates are rendered with 'data' to determine whether they have drifted. Dotfiles
+// with the install 'mode' ModeCopy are compared with their copy, leaving out paths ignored by
+// 'ignore'.
+func getDotfileStatus(info *fileLocationInfo, data *TemplateData, mode InstallMode, ignore *IgnoreMatcher) (*DotfileStatus, error) {
+	status := &DotfileStatus{
+		DotfilesFile:  info.dotfilesFile,
+		UserspaceFile: info.userspaceFile,
+	}
+
+	ufile, err := os.Lstat(info.userspaceFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			status.State = StateMissing
+			return status, nil
+		}
+		return nil, err
+	}
+
+	ok, err := IsFileSymlink(info.userspaceFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		linkTarget, err := os.Readlink(info.userspaceFile)
+		if err != nil {
+			return nil, err
+		}
+		status.LinkTarget = linkTarget
+		target := resolveTarget(info.userspaceFile, linkTarget)
+
+		exists, err := CheckIfFileExists(target)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !exists:
+			status.State = StateDangling
+		case target == filepath.Clean(info.dotfilesFile) && mode == ModeCopy:
+			// The symlink is in the way of the copy
+			status.State = StateConflicting
+		case target == filepath.Clean(info.dotfilesFile):
+			status.State = StateInstalled
+		default:
+			status.State = StateForeignSymlink
+		}
+		return status, nil
+	}
+
+	if mode == ModeCopy && (ufile.Mode().IsRegular() || ufile.IsDir()) {
+		status.State, err = copyState(info.dotfilesFile, info.userspaceFile, ignore)
+		if err != nil {
+			return nil, err
+		}
+		return status, nil
+	}
+
+	isDir, err := isDirectory(info.dotfilesFile)
+	if err != nil {
+		return nil, err
+	}
+	if isDir && ufile.IsDir() {
+		return nil, nil
+	}
+
+	// Templates are rendered into a regular file in userspace
+	if !isDir && isTemplate(info.dotfilesFile) && ufile.Mode().IsRegular() {
+		rendered, err := renderTemplate(info.dotfilesFile, data)
+		if err != nil {
+			return nil, err
+		}
+		status.State, err = renderedState(info.userspaceFile, rendered)
+		if err != nil {
+			return nil, err
+		}
+		return status, nil
+	}
+
+	// Secrets are decrypted into a regular file in userspace
+	if !isDir && isSecret(info.dotfilesFile) && ufile.Mode().IsRegular() {
+		status.State = StateInstalled
+		return status, nil
+	}
+
+	status.State = StateConflicting
+	return status, nil
+}
@@ -0,0 +1,75 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_GetDotfilesStatus_puts_entries_into_expected_states(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir
+	uspace := env.UserspaceDir
+
+	installed := dfiles.AddTempFile()
+	missing := dfiles.AddTempFile()
+	conflicting := dfiles.AddTempFile()
+	foreign := dfiles.AddTempFile()
+	dangling := dfiles.AddTempFile()
+
+	// Nested file inside a directory that exists in both places
+	dfiles.AddTempDir("container")
+	uspace.AddTempDir("container")
+	nested := dfiles.AddTempDir("container").AddTempFile()
+
+	// Directory that does not exist in userspace at all
+	missingdir := dfiles.AddTempDir("missingdir")
+	missingdir.AddTempFile()
+
+	if err := createSymlink(filepath.Join(uspace.Path, installed.Name), installed.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(uspace.Path, conflicting.Name), []byte("in the way"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := createSymlink(filepath.Join(uspace.Path, foreign.Name), uspace.AddTempFile().Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := createSymlink(filepath.Join(uspace.Path, dangling.Name), filepath.Join(uspace.Path, "nothing-here")); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := GetDotfilesStatus(uspace.Path, dfiles.Path)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	want := map[string]DotfileState{
+		installed.Path:   StateInstalled,
+		missing.Path:     StateMissing,
+		conflicting.Path: StateConflicting,
+		foreign.Path:     StateForeignSymlink,
+		dangling.Path:    StateDangling,
+		nested.Path:      StateMissing,
+		missingdir.Path:  StateMissing,
+	}
+
+	if len(statuses) != len(want) {
+		test.FailHardMsg("Unexpected number of entries", len(statuses), len(want), t)
+	}
+
+	for _, s := range statuses {
+		state, ok := want[s.DotfilesFile]
+		if !ok {
+			t.Errorf("unexpected entry in status: %s", s.DotfilesFile)
+			continue
+		}
+		if s.State != state {
+			test.FailMsg("State of "+s.DotfilesFile, s.State, state, t)
+		}
+	}
+}
@@ -11,10 +11,13 @@ import (
 
 // UpdateSymlinks walks over files and folders in the dotfiles dir, while updating their respective
 // symlinks in userspace relative to the placement in the dotfiles directory. If a matching symlink
-// is not found in userspace, the file is ignored.
+// is not found in userspace, the file is ignored. Paths excluded by the ignore files of the operation
+// or of the dotfiles dir are skipped. If the manifest of the operation records the paths managed in
+// the dotfiles dir, only those are walked.
 // `dotfilesDirPath` denotes the path to the dotfiles directory.
 // `userSpacePath` denotes the root of where the symlinks can be found.
-func UpdateSymlinks(userSpaceDir, dotfilesDir string) error {
+// If a symlink fails to be updated, all symlinks updated by the call are changed back.
+func UpdateSymlinks(op *Operation, userSpaceDir, dotfilesDir string) error {
 	absUserSpaceDir, err := getAbsolutePath(userSpaceDir)
 	if err != nil {
 		return err
@@ -25,9 +28,18 @@ func UpdateSymlinks(userSpaceDir, dotfilesDir string) error {
 		return err
 	}
 
+	// The dotfiles dir may have been moved from the configured location
+	ignore, err := op.ignore.withDotfilesDir(absDotfilesDir, absUserSpaceDir)
+	if err != nil {
+		return err
+	}
+
 	// Walkdir traverses the dotfiles dir with `p` denoting each file or directory in the dotfiles
 	// directory and can be either a file or directory.
-	return filepath.WalkDir(dotfilesDir, func(p string, d fs.DirEntry, err error) error {
+	visit := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 		if p == dotfilesDir {
 			return nil
 		}
@@ -37,12 +49,17 @@ func UpdateSymlinks(userSpaceDir, dotfilesDir string) error {
 			return err
 		}
 
+		if ignore.Match(absFilePath, d.IsDir()) {
+			return skipEntry(d)
+		}
+
 		fileInUserspace, err := replacePrefixPath(absFilePath, absDotfilesDir, absUserSpaceDir)
 		if err != nil {
 			return err
 		}
 
-		exists, err := CheckIfFileExists(fileInUserspace)
+		// Symlinks to the previous location of the dotfiles are dangling and must be found too
+		exists, err := checkIfPathExists(fileInUserspace)
 		if err != nil {
 			return err
 		}
@@ -55,18 +72,76 @@ func UpdateSymlinks(userSpaceDir, dotfilesDir string) error {
 		if err != nil {
 			return err
 		}
+		if !ok {
+			return nil
+		}
+
+		// Symlinks already pointing to the dotfile are only changed to the configured form
+		target, err := os.Readlink(fileInUserspace)
+		if err != nil {
+			return err
+		}
+		if resolveTarget(fileInUserspace, target) == absFilePath && filepath.IsAbs(target) != op.relative {
+			return nil
+		}
 
-		if ok {
-			err = updateSymlink(fileInUserspace, absFilePath)
-			if err != nil {
+		return op.updateSymlink(fileInUserspace, absFilePath)
+	}
+
+	// Only the paths recorded in the manifest are visited if it records the paths of the directory
+	return op.atomic(func() error {
+		for _, root := range op.manifest.roots(absDotfilesDir, ".") {
+			p := dotfilesDir
+			if root != "." {
+				p = filepath.Join(dotfilesDir, root)
+				// The recorded path may have been removed by hand
+				if exists, _ := checkIfPathExists(p); !exists {
+					continue
+				}
+			}
+			if err := filepath.WalkDir(p, visit); err != nil {
 				return err
 			}
 		}
-
 		return nil
 	})
 }
 
+// Returns the absolute path the symlink at 'path' points to without following any further
+// symlinks. Both absolute and relative symlinks are understood.
+func resolveSymlink(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	return resolveTarget(path, target), nil
+}
+
+// Returns the absolute path of the 'target' of the symlink at 'path'. A relative target is relative
+// to the directory containing the symlink.
+func resolveTarget(path, target string) string {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return filepath.Clean(target)
+}
+
+// Returns the target written to a symlink at 'symlinkDest' pointing to 'fileSrc'. If the operation
+// creates relative symlinks an absolute 'fileSrc' is made relative to the directory of the symlink.
+// The relative target is computed from the paths as given, so it keeps working when a directory
+// containing both the symlink and the file is moved.
+func (op *Operation) symlinkTarget(symlinkDest, fileSrc string) (string, error) {
+	if !op.relative || !filepath.IsAbs(fileSrc) {
+		return fileSrc, nil
+	}
+
+	absDest, err := filepath.Abs(symlinkDest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(filepath.Dir(absDest), filepath.Clean(fileSrc))
+}
+
 // IsFileSymlink returns true if the given path is an existing symlink.
 func IsFileSymlink(file string) (bool, error) {
 	fileInfo, err := os.Lstat(file)
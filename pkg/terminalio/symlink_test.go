@@ -2,6 +2,7 @@ package terminalio
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -46,7 +47,7 @@ func Test_UpdateSymlinks_recursively_changes_symlinks_in_userspace(t *testing.T)
 		test.FailHardMsg("This symlink should point to file in userspace", pathToLinkedFile, usomefile, t)
 	}
 
-	err = UpdateSymlinks(userspace.Path, dotfiles.Path)
+	err = UpdateSymlinks(newTestOperation(t), userspace.Path, dotfiles.Path)
 	if err != nil {
 		test.Fail(err, "Should not fail", t)
 	}
@@ -228,3 +229,80 @@ func Test_isFileSymlink_determines_correctly_a_symlink(t *testing.T) {
 		}
 	}
 }
+
+func Test_relative_symlinks_are_installed_and_understood(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+	dotfile := writeLayerFile(t, dfiles, ".config/app.conf", "managed")
+	link := filepath.Join(uspace, ".config/app.conf")
+
+	op := NewOperation("test", OperationOptions{BackupDir: t.TempDir(), RelativeSymlinks: true})
+	if err := InstallDotfile(op, dotfile, uspace, dfiles, false); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := filepath.Rel(filepath.Dir(link), dotfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(want, target, t)
+
+	statuses, err := GetDotfilesStatus(uspace, dfiles)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if len(statuses) != 1 {
+		test.FailHardMsg("Unexpected number of entries", len(statuses), 1, t)
+	}
+	test.AssertEqual(StateInstalled, statuses[0].State, t)
+
+	// Left alone as it already points to the dotfile
+	if err := UpdateSymlinks(op, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	target, err = os.Readlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(want, target, t)
+
+	if err := UninstallDotfile(op, link, uspace, dfiles); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		test.FailHard(err, "Expected the symlink to be removed", t)
+	}
+}
+
+func Test_UpdateSymlinks_updates_dangling_symlinks(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	uspace := env.UserspaceDir.Path
+	moved := t.TempDir()
+	dotfile := writeLayerFile(t, moved, ".zshrc", "managed")
+
+	// Points to where the dotfiles were before they were moved
+	link := filepath.Join(uspace, ".zshrc")
+	if err := os.Symlink(filepath.Join(env.DotfilesDir.Path, ".zshrc"), link); err != nil {
+		t.Fatal(err)
+	}
+
+	op := NewOperation("test", OperationOptions{BackupDir: t.TempDir(), RelativeSymlinks: true})
+	if err := UpdateSymlinks(op, uspace, moved); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	target, err := resolveSymlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual(dotfile, target, t)
+}
@@ -0,0 +1,133 @@
+package terminalio
+
+import "sort"
+
+// SyncStrategy integrates the commits fetched from the remote branch into the local branch. Local
+// changes have been committed before the strategy is used.
+type SyncStrategy interface {
+	// Name used to select the strategy in the configuration and on the command line.
+	Name() string
+
+	// Integrate brings the commits of the remote branch given by 'opts' into the local branch of
+	// the repository at 'repoPath'. Conflicting files are resolved if requested by 'opts',
+	// otherwise the repository is returned to its state before and an ErrMergeConflict is
+	// returned.
+	Integrate(op *Operation, repoPath string, opts SyncOptions) error
+}
+
+// Available sync strategies by name.
+var syncStrategies = map[string]SyncStrategy{
+	MergeStrategy{}.Name():  MergeStrategy{},
+	RebaseStrategy{}.Name(): RebaseStrategy{},
+}
+
+// GetSyncStrategy returns the sync strategy with the given name.
+func GetSyncStrategy(name string) (SyncStrategy, error) {
+	strategy, ok := syncStrategies[name]
+	if !ok {
+		return nil, &ErrUnknownSyncStrategy{name}
+	}
+	return strategy, nil
+}
+
+// SyncStrategyNames returns the names of all sync strategies sorted alphabetically.
+func SyncStrategyNames() []string {
+	names := make([]string, 0, len(syncStrategies))
+	for name := range syncStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MergeStrategy merges the remote branch into the local branch creating a merge commit when both
+// have new commits.
+type MergeStrategy struct{}
+
+func (MergeStrategy) Name() string {
+	return "merge"
+}
+
+func (MergeStrategy) Integrate(op *Operation, repoPath string, opts SyncOptions) error {
+	if _, err := op.execute(repoPath, gitMerge(opts.Remote, opts.Branch)); err == nil {
+		return nil
+	}
+
+	// Nothing was merged if the merge failed without conflicts
+	conflicts, err := conflictingFiles(repoPath)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return &ErrMergeFail{repoPath}
+	}
+
+	if opts.Resolve != ResolveNone {
+		return resolveConflicts(op, repoPath, opts.Resolve)
+	}
+
+	if _, err := op.execute(repoPath, gitAbortMerge); err != nil {
+		return err
+	}
+	return &ErrMergeConflict{Directory: repoPath, Conflicts: mapConflicts(repoPath, conflicts, opts)}
+}
+
+// RebaseStrategy replays the local commits on top of the remote branch, which keeps the history
+// linear.
+type RebaseStrategy struct{}
+
+func (RebaseStrategy) Name() string {
+	return "rebase"
+}
+
+func (RebaseStrategy) Integrate(op *Operation, repoPath string, opts SyncOptions) error {
+	if _, err := op.execute(repoPath, gitRebase(opts.Remote, opts.Branch)); err == nil {
+		return nil
+	}
+
+	// While rebasing the sides are swapped. The remote branch is 'ours' and the local commit being
+	// replayed is 'theirs'.
+	side := ResolveTheirs
+	if opts.Resolve == ResolveTheirs {
+		side = ResolveOurs
+	}
+
+	// Every replayed commit can stop the rebase with new conflicts
+	for {
+		conflicts, err := conflictingFiles(repoPath)
+		if err != nil {
+			return abortRebase(op, repoPath, err)
+		}
+		if len(conflicts) == 0 {
+			return abortRebase(op, repoPath, &ErrRebaseFail{repoPath})
+		}
+
+		if opts.Resolve == ResolveNone {
+			return abortRebase(op, repoPath,
+				&ErrMergeConflict{Directory: repoPath, Conflicts: mapConflicts(repoPath, conflicts, opts)})
+		}
+
+		if err := resolveConflictingFiles(op, repoPath, side); err != nil {
+			return abortRebase(op, repoPath, err)
+		}
+
+		if _, err := op.execute(repoPath, gitContinue); err == nil {
+			return nil
+		}
+
+		// A commit left empty by the resolution is dropped
+		if remaining, err := conflictingFiles(repoPath); err == nil && len(remaining) == 0 {
+			if _, err := op.execute(repoPath, gitSkip); err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Aborts the rebase in progress and returns 'cause'.
+func abortRebase(op *Operation, repoPath string, cause error) error {
+	if _, err := op.execute(repoPath, gitAbortRebase); err != nil {
+		return err
+	}
+	return cause
+}
@@ -0,0 +1,102 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_GetSyncStrategy(t *testing.T) {
+	for _, name := range []string{"merge", "rebase"} {
+		strategy, err := GetSyncStrategy(name)
+		if err != nil {
+			test.FailHard(err, "No error should have happened", t)
+		}
+		if strategy.Name() != name {
+			test.Fail(strategy.Name(), name, t)
+		}
+	}
+
+	if _, err := GetSyncStrategy("squash"); err == nil {
+		test.Fail(err, &ErrUnknownSyncStrategy{"squash"}, t)
+	}
+}
+
+func Test_Integrate_aborts_on_conflict(t *testing.T) {
+	for _, strategy := range []SyncStrategy{MergeStrategy{}, RebaseStrategy{}} {
+		t.Run(strategy.Name(), func(t *testing.T) {
+			local := newConflictingRepo(t)
+			head := runGit(t, local, "rev-parse", "HEAD")
+
+			op := NewOperation("sync", OperationOptions{BackupDir: t.TempDir()})
+			err := strategy.Integrate(op, local, SyncOptions{Remote: "origin", Branch: "main"})
+
+			conflict, ok := err.(*ErrMergeConflict)
+			if !ok {
+				test.FailHard(err, &ErrMergeConflict{}, t)
+			}
+			test.AssertEqual([]MergeConflict{{File: ".zshrc"}}, conflict.Conflicts, t)
+
+			// The repository is left as it was before
+			test.AssertEqual(head, runGit(t, local, "rev-parse", "HEAD"), t)
+			test.AssertEqual("", runGit(t, local, "status", "--porcelain"), t)
+			test.AssertEqual("local 2\n", readTestFile(t, local, ".zshrc"), t)
+		})
+	}
+}
+
+func Test_Integrate_resolves_conflicts(t *testing.T) {
+	for _, tc := range []struct {
+		strategy SyncStrategy
+		resolve  ConflictResolution
+		expected string
+	}{
+		{MergeStrategy{}, ResolveOurs, "local 2\n"},
+		{MergeStrategy{}, ResolveTheirs, "remote\n"},
+		{RebaseStrategy{}, ResolveOurs, "local 2\n"},
+		// The rebase stops at both local commits
+		{RebaseStrategy{}, ResolveTheirs, "remote\n"},
+	} {
+		t.Run(tc.strategy.Name()+"/"+string(tc.resolve), func(t *testing.T) {
+			local := newConflictingRepo(t)
+
+			op := NewOperation("sync", OperationOptions{BackupDir: t.TempDir()})
+			err := tc.strategy.Integrate(op, local, SyncOptions{Remote: "origin", Branch: "main", Resolve: tc.resolve})
+			if err != nil {
+				test.FailHard(err, "No error should have happened", t)
+			}
+
+			test.AssertEqual(tc.expected, readTestFile(t, local, ".zshrc"), t)
+			test.AssertEqual("", runGit(t, local, "status", "--porcelain"), t)
+
+			// The remote commits are part of the local branch
+			runGit(t, local, "merge-base", "--is-ancestor", "origin/main", "HEAD")
+		})
+	}
+}
+
+// Returns a clone in which two local commits and a commit fetched from the remote all change
+// .zshrc.
+func newConflictingRepo(t *testing.T) string {
+	remote := newTestRemote(t)
+	local := cloneTestRemote(t, remote)
+	other := cloneTestRemote(t, remote)
+
+	commitTestFile(t, other, ".zshrc", "remote\n")
+	runGit(t, other, "push", "--quiet", "origin", "main")
+
+	commitTestFile(t, local, ".zshrc", "local 1\n")
+	commitTestFile(t, local, ".zshrc", "local 2\n")
+	runGit(t, local, "fetch", "--quiet", "origin")
+	return local
+}
+
+func readTestFile(t *testing.T, dir, name string) string {
+	contents, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
@@ -0,0 +1,198 @@
+package terminalio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateSuffix marks a dotfile as a template. A template is rendered into userspace without the
+// suffix instead of being symlinked, e.g. '.gitconfig.dotftmpl' is rendered to '.gitconfig'.
+const TemplateSuffix = ".dotftmpl"
+
+// VarsFileName is the name of the file in a dotfiles directory containing variables for templates.
+const VarsFileName = ".dotfvars"
+
+// TemplateData is available to templates when they are rendered.
+type TemplateData struct {
+	Host   string            // Hostname of the machine
+	Distro string            // Name of the most specific dotfiles directory
+	Env    map[string]string // Environment variables
+	Vars   map[string]string // Variables from the .dotfvars files of the dotfiles directories
+}
+
+// Returns true if the dotfile at 'path' is a template.
+func isTemplate(path string) bool {
+	return strings.HasSuffix(path, TemplateSuffix) && len(filepath.Base(path)) > len(TemplateSuffix)
+}
+
+// Returns the data available to templates of 'layers'. Variables of more specific layers override
+// those of less specific layers. The layers must be absolute.
+func loadTemplateData(layers Layers) (*TemplateData, error) {
+	data := &TemplateData{
+		Env:  map[string]string{},
+		Vars: map[string]string{},
+	}
+
+	data.Host, _ = os.Hostname()
+	if len(layers) > 0 {
+		data.Distro = filepath.Base(layers[len(layers)-1])
+	}
+
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			data.Env[k] = v
+		}
+	}
+
+	for _, layer := range layers {
+		vars, err := readVarsFile(filepath.Join(layer, VarsFileName))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range vars {
+			data.Vars[k] = v
+		}
+	}
+	return data, nil
+}
+
+// Reads the variables of the file at 'path' given as 'key = value' lines. Blank lines and lines
+// starting with '#' are skipped. A missing file has no variables.
+func readVarsFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	linenum := 0
+	for scanner.Scan() {
+		linenum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, &ErrMalformedVarsFile{path, linenum}
+		}
+		vars[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// Renders the template at 'path' with 'data'. Using a variable that does not exist is an error.
+func renderTemplate(path string, data *TemplateData) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(path).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, &ErrTemplate{path, err}
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, &ErrTemplate{path, err}
+	}
+	return b.Bytes(), nil
+}
+
+// Returns the state of the file 'userspaceFile' rendered from a template. It is installed if its
+// contents equal the rendered template and drifted if they differ.
+func renderedState(userspaceFile string, rendered []byte) (DotfileState, error) {
+	contents, err := os.ReadFile(userspaceFile)
+	if err != nil {
+		return 0, err
+	}
+	if bytes.Equal(contents, rendered) {
+		return StateInstalled, nil
+	}
+	return StateDrifted, nil
+}
+
+// Renders the template described by 'info' with the variables of 'layers' into userspace. The
+// file in userspace will be removed if 'overwrite' is true. The rendered file gets the permissions
+// of the template.
+func installTemplate(op *Operation, info *fileLocationInfo, layers Layers, overwrite bool) error {
+	data, err := loadTemplateData(layers)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderTemplate(info.dotfilesFile, data)
+	if err != nil {
+		return err
+	}
+
+	tmplInfo, err := os.Stat(info.dotfilesFile)
+	if err != nil {
+		return err
+	}
+
+	exists, err := op.pathExists(info.userspaceFile)
+	if err != nil {
+		return err
+	}
+	if exists && !overwrite {
+		return &ErrAbortOnOverwrite{info.userspaceFile}
+	}
+
+	return op.atomic(func() error {
+		if exists {
+			if err := op.deleteFileOrDir(info.userspaceFile); err != nil {
+				return err
+			}
+		}
+
+		if err := op.mkdirAll(filepath.Dir(info.userspaceFile)); err != nil {
+			return fmt.Errorf("didn't create nested path for userspace file: %v", err)
+		}
+
+		return op.writeFile(info.userspaceFile, rendered, tmplInfo.Mode().Perm())
+	})
+}
+
+// Returns true if a template or a secret is found below 'rel' in any of 'layers'. Paths ignored by
+// 'ignore' are not considered. The layers must be absolute.
+func (l Layers) containsGenerated(rel string, ignore *IgnoreMatcher) bool {
+	found := errors.New("generated file found")
+
+	for _, layer := range l {
+		root := filepath.Join(layer, rel)
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ignore.Match(p, d.IsDir()) {
+				return skipEntry(d)
+			}
+			if !d.IsDir() && isGenerated(p) {
+				return found
+			}
+			return nil
+		})
+		if err == found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package terminalio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+func Test_loadTemplateData_lets_specific_layers_override_vars(t *testing.T) {
+	common := t.TempDir()
+	host := t.TempDir()
+
+	writeLayerFile(t, common, VarsFileName, "# comment\nemail = common@example.com\nname = \"Me\"\n")
+	writeLayerFile(t, host, VarsFileName, "email = host@example.com\n")
+
+	data, err := loadTemplateData(Layers{common, host})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	test.AssertEqual("host@example.com", data.Vars["email"], t)
+	test.AssertEqual("Me", data.Vars["name"], t)
+	test.AssertEqual(filepath.Base(host), data.Distro, t)
+}
+
+func Test_readVarsFile_fails_on_malformed_line(t *testing.T) {
+	file := writeLayerFile(t, t.TempDir(), VarsFileName, "email = a@b\nno value here\n")
+
+	_, err := readVarsFile(file)
+	var malformed *ErrMalformedVarsFile
+	if !errors.As(err, &malformed) {
+		test.FailHard(err, &ErrMalformedVarsFile{}, t)
+	}
+	test.AssertEqual(2, malformed.line, t)
+}
+
+func Test_renderTemplate_fails_on_missing_variable(t *testing.T) {
+	tmpl := writeLayerFile(t, t.TempDir(), ".gitconfig"+TemplateSuffix, "email = {{.Vars.email}}\n")
+
+	rendered, err := renderTemplate(tmpl, &TemplateData{Vars: map[string]string{"email": "a@b"}})
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual("email = a@b\n", string(rendered), t)
+
+	_, err = renderTemplate(tmpl, &TemplateData{Vars: map[string]string{}})
+	if _, ok := err.(*ErrTemplate); !ok {
+		test.FailHard(err, &ErrTemplate{}, t)
+	}
+}
+
+func Test_InstallDotfile_renders_template_and_status_detects_drift(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	writeLayerFile(t, dfiles, VarsFileName, "monitor = DP-1\n")
+	tmpl := writeLayerFile(t, dfiles, ".config/i3/config"+TemplateSuffix, "output {{.Vars.monitor}}\n")
+	rendered := filepath.Join(uspace, ".config/i3/config")
+
+	if err := InstallDotfile(newTestOperation(t), tmpl, uspace, dfiles, false); err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+
+	contents, err := os.ReadFile(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqual("output DP-1\n", string(contents), t)
+
+	assertState := func(want DotfileState) {
+		statuses, err := GetDotfilesStatus(uspace, dfiles)
+		if err != nil {
+			test.FailHard(err, "No error should have happened", t)
+		}
+		if len(statuses) != 1 {
+			test.FailHardMsg("Unexpected number of entries", len(statuses), 1, t)
+		}
+		test.AssertEqual(rendered, statuses[0].UserspaceFile, t)
+		if statuses[0].State != want {
+			test.FailMsg("State of "+rendered, statuses[0].State, want, t)
+		}
+	}
+
+	assertState(StateInstalled)
+
+	if err := os.WriteFile(rendered, []byte("output HDMI-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertState(StateDrifted)
+}
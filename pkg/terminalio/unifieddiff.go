@@ -0,0 +1,229 @@
+package terminalio
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around each change in a unified diff.
+const diffContext = 3
+
+// A diffLine is a single line of an edit script turning one text into another.
+type diffLine struct {
+	kind byte // ' ' if the line is kept, '-' if it is removed and '+' if it is added
+	text string
+}
+
+// UnifiedDiff returns the differences between 'a' and 'b' in the unified format used by 'diff -u'
+// and git. The names are shown in the header. An empty string is returned if the contents are equal.
+// Binary contents are not compared line by line.
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	if isBinary(a) || isBinary(b) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", aName, bName)
+	}
+
+	script := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	for _, h := range hunks(script) {
+		aStart, aLen, bStart, bLen := h.ranges()
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", formatRange(aStart, aLen), formatRange(bStart, bLen))
+		for _, l := range h.lines {
+			out.WriteByte(l.kind)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+// Returns true if 'contents' looks like a binary file, which is the case if it contains a NUL byte
+// in the first few kilobytes like git decides it.
+func isBinary(contents []byte) bool {
+	if len(contents) > 8000 {
+		contents = contents[:8000]
+	}
+	return bytes.IndexByte(contents, 0) >= 0
+}
+
+// Splits 'contents' into lines keeping the line endings. The last line has no line ending if the
+// contents do not end with one.
+func splitLines(contents []byte) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(contents), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Returns the shortest edit script turning 'a' into 'b' using the algorithm of Eugene W. Myers,
+// "An O(ND) Difference Algorithm and Its Variations".
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// The furthest reaching paths of every round are kept to find the way back. Round d only uses
+	// the diagonals -d to d.
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Down, i.e. insertion
+			} else {
+				x = v[offset+k-1] + 1 // Right, i.e. deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// Follows the paths in 'trace' back from the end of both texts and returns the edit script.
+func backtrack(trace [][]int, a, b []string) []diffLine {
+	x, y := len(a), len(b)
+	var script []diffLine
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, diffLine{' ', a[x]})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				script = append(script, diffLine{'+', b[prevY]})
+			} else {
+				script = append(script, diffLine{'-', a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	// The script was built from the end
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// A hunk is a group of changes close to each other together with the unchanged lines around them.
+type hunk struct {
+	aStart, bStart int // Line numbers starting at 1 of the first line in each text
+	lines          []diffLine
+}
+
+// Returns the start and length of the hunk in both texts.
+func (h *hunk) ranges() (aStart, aLen, bStart, bLen int) {
+	for _, l := range h.lines {
+		if l.kind != '+' {
+			aLen++
+		}
+		if l.kind != '-' {
+			bLen++
+		}
+	}
+	return h.aStart, aLen, h.bStart, bLen
+}
+
+// Groups the changes of 'script' into hunks. Changes separated by no more than twice the context
+// share a hunk.
+func hunks(script []diffLine) []*hunk {
+	var result []*hunk
+	var current *hunk
+	aLine, bLine := 1, 1
+	lastChange := -1
+
+	for i, l := range script {
+		if l.kind != ' ' {
+			// A hunk is closed once more than twice the context separates it from the next change
+			if current == nil {
+				start := i - diffContext
+				if start < 0 {
+					start = 0
+				}
+				// The leading context only contains unchanged lines
+				current = &hunk{
+					aStart: aLine - (i - start),
+					bStart: bLine - (i - start),
+					lines:  append([]diffLine(nil), script[start:i]...),
+				}
+				result = append(result, current)
+			} else {
+				current.lines = append(current.lines, script[lastChange+1:i]...)
+			}
+			current.lines = append(current.lines, l)
+			lastChange = i
+		} else if current != nil && i-lastChange > 2*diffContext {
+			// Trailing context of the previous hunk
+			current.lines = append(current.lines, script[lastChange+1:lastChange+1+diffContext]...)
+			current = nil
+		}
+
+		if l.kind != '+' {
+			aLine++
+		}
+		if l.kind != '-' {
+			bLine++
+		}
+	}
+
+	if current != nil {
+		end := lastChange + 1 + diffContext
+		if end > len(script) {
+			end = len(script)
+		}
+		current.lines = append(current.lines, script[lastChange+1:end]...)
+	}
+	return result
+}
+
+// Formats a range of a hunk header. An empty range starts at the line before it.
+func formatRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
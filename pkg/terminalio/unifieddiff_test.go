@@ -0,0 +1,67 @@
+package terminalio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_UnifiedDiff(t *testing.T) {
+	lines := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	longLines := lines + "11\n12\n"
+
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{"equal contents", lines, lines, ""},
+		{
+			"changed line shown with context",
+			lines,
+			strings.Replace(lines, "5\n", "five\n", 1),
+			"--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"distant changes in separate hunks",
+			lines,
+			strings.Replace(strings.Replace(lines, "1\n", "one\n", 1), "10\n", "ten\n", 1),
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			"changes exactly twice the context apart share a hunk",
+			longLines,
+			"one\n2\n3\n4\n5\n6\n7\neight\n9\n10\n11\n12\n",
+			"--- a\n+++ b\n@@ -1,11 +1,11 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n 11\n",
+		},
+		{
+			"changes more than twice the context apart in separate hunks",
+			longLines,
+			"one\n2\n3\n4\n5\n6\n7\n8\nnine\n10\n11\n12\n",
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -6,7 +6,7 @@\n 6\n 7\n 8\n-9\n+nine\n 10\n 11\n 12\n",
+		},
+		{
+			"lines added to empty file",
+			"",
+			"a\nb\n",
+			"--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			"missing newline at end of file",
+			"a\n",
+			"a",
+			"--- a\n+++ b\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n",
+		},
+		{"binary contents", "a\x00", "b\x00", "Binary files a and b differ\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := UnifiedDiff("a", "b", []byte(tt.a), []byte(tt.b))
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("have:\n%s\nwant:\n%s\ndiff: %s", actual, tt.expected, diff)
+			}
+		})
+	}
+}
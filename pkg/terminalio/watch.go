@@ -0,0 +1,233 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How long a symlink must be left alone before it is checked. Applications often replace a file in
+// more than one step, e.g. by deleting it and moving a new file into its place.
+const watchSettleDelay = 200 * time.Millisecond
+
+// ClobberKind tells what happened to a symlink in userspace pointing to a dotfile.
+type ClobberKind int
+
+const (
+	ClobberReplaced ClobberKind = iota // The symlink was replaced by a regular file or directory
+	ClobberDeleted                     // The symlink was deleted
+)
+
+func (k ClobberKind) String() string {
+	switch k {
+	case ClobberReplaced:
+		return "replaced"
+	case ClobberDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// A ClobberEvent reports a symlink to a dotfile that was replaced or deleted by another application.
+type ClobberEvent struct {
+	Kind          ClobberKind
+	DotfilesFile  string // Absolute path to the dotfile the symlink pointed to
+	UserspaceFile string // Absolute path to the symlink in userspace
+}
+
+// A SymlinkWatcher watches the symlinks in userspace pointing to dotfiles and reports when another
+// application replaces or deletes one of them. The parent directories of the symlinks are watched,
+// as a symlink itself cannot be watched without following it. A symlink is reported once each time
+// it is clobbered and again if it is clobbered in a different way.
+type SymlinkWatcher struct {
+	watcher *fsnotify.Watcher
+	events  chan *ClobberEvent
+	errors  chan error
+	settled chan string // Paths left alone for watchSettleDelay
+	done    chan struct{}
+
+	mu    sync.Mutex
+	links map[string]string // Symlinks in userspace and the dotfiles they point to
+	dirs  map[string]bool   // Watched parent directories of the symlinks
+
+	// Only used by the event loop
+	timers    map[string]*time.Timer
+	clobbered map[string]ClobberKind
+}
+
+// NewSymlinkWatcher starts a watcher that does not watch anything until Watch is called. It must be
+// closed by the caller.
+func NewSymlinkWatcher() (*SymlinkWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &SymlinkWatcher{
+		watcher:   watcher,
+		events:    make(chan *ClobberEvent),
+		errors:    make(chan error),
+		settled:   make(chan string),
+		done:      make(chan struct{}),
+		links:     make(map[string]string),
+		dirs:      make(map[string]bool),
+		timers:    make(map[string]*time.Timer),
+		clobbered: make(map[string]ClobberKind),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Watch replaces the watched symlinks by those in 'userspaceDir' currently pointing to dotfiles in
+// 'layers'. It should be called again when dotfiles have been installed or reverted. The number of
+// watched symlinks is returned.
+func (w *SymlinkWatcher) Watch(userspaceDir string, layers Layers, ignore *IgnoreMatcher) (int, error) {
+	statuses, err := GetLayeredDotfilesStatus(userspaceDir, layers, ignore, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	links := make(map[string]string)
+	dirs := make(map[string]bool)
+	for _, s := range statuses {
+		if s.State != StateInstalled {
+			continue
+		}
+		// Templates and secrets are installed as regular files
+		if isSymlink, err := IsFileSymlink(s.UserspaceFile); err != nil || !isSymlink {
+			continue
+		}
+		link := filepath.Clean(s.UserspaceFile)
+		links[link] = s.DotfilesFile
+		dirs[filepath.Dir(link)] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for dir := range dirs {
+		if !w.dirs[dir] {
+			if err := w.watcher.Add(dir); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			// The directory may have been deleted, which already stopped watching it
+			_ = w.watcher.Remove(dir)
+		}
+	}
+
+	w.links = links
+	w.dirs = dirs
+	return len(links), nil
+}
+
+// Events returns the channel receiving clobbered symlinks. It must be read for the watcher to
+// continue.
+func (w *SymlinkWatcher) Events() <-chan *ClobberEvent {
+	return w.events
+}
+
+// Errors returns the channel receiving errors from the underlying watcher.
+func (w *SymlinkWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close stops watching. No events are sent afterwards.
+func (w *SymlinkWatcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+// Handles events from the underlying watcher until the watcher is closed.
+func (w *SymlinkWatcher) loop() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.schedule(filepath.Clean(e.Name))
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			select {
+			case w.errors <- err:
+			case <-w.done:
+				return
+			}
+		case path := <-w.settled:
+			delete(w.timers, path)
+			event := w.check(path)
+			if event == nil {
+				continue
+			}
+			select {
+			case w.events <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Checks 'path' once it has been left alone for watchSettleDelay.
+func (w *SymlinkWatcher) schedule(path string) {
+	w.mu.Lock()
+	_, watched := w.links[path]
+	w.mu.Unlock()
+	if !watched {
+		return
+	}
+
+	if t, ok := w.timers[path]; ok {
+		t.Stop()
+	}
+	w.timers[path] = time.AfterFunc(watchSettleDelay, func() {
+		select {
+		case w.settled <- path:
+		case <-w.done:
+		}
+	})
+}
+
+// Returns an event if the symlink at 'path' has been clobbered in a way not reported yet.
+func (w *SymlinkWatcher) check(path string) *ClobberEvent {
+	w.mu.Lock()
+	dotfile, watched := w.links[path]
+	w.mu.Unlock()
+	if !watched {
+		return nil
+	}
+
+	kind, clobbered := clobberState(path)
+	if !clobbered {
+		delete(w.clobbered, path)
+		return nil
+	}
+	if reported, ok := w.clobbered[path]; ok && reported == kind {
+		return nil
+	}
+	w.clobbered[path] = kind
+	return &ClobberEvent{kind, dotfile, path}
+}
+
+// Returns how the symlink at 'path' was clobbered. False is returned if it is still a symlink.
+func clobberState(path string) (ClobberKind, bool) {
+	isSymlink, err := IsFileSymlink(path)
+	if err != nil {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return ClobberDeleted, true
+		}
+		return 0, false
+	}
+	return ClobberReplaced, !isSymlink
+}
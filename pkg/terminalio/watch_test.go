@@ -0,0 +1,71 @@
+package terminalio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mortenskoett/dotf-go/pkg/test"
+)
+
+// Returns the next event of 'w' or fails if none is received in time.
+func nextClobberEvent(t *testing.T, w *SymlinkWatcher) *ClobberEvent {
+	select {
+	case e := <-w.Events():
+		return e
+	case err := <-w.Errors():
+		test.FailHard(err, "No error should have happened", t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return nil
+}
+
+func Test_SymlinkWatcher_reports_replaced_and_deleted_symlinks(t *testing.T) {
+	env := test.NewTestEnvironment()
+	defer env.Cleanup()
+
+	dfiles := env.DotfilesDir.Path
+	uspace := env.UserspaceDir.Path
+
+	dotfile := writeLayerFile(t, dfiles, ".config/app.conf", "managed")
+	link := filepath.Join(uspace, ".config/app.conf")
+	if err := os.MkdirAll(filepath.Dir(link), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dotfile, link); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewSymlinkWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	count, err := w.Watch(uspace, Layers{dfiles}, nil)
+	if err != nil {
+		test.FailHard(err, "No error should have happened", t)
+	}
+	test.AssertEqual(1, count, t)
+
+	// Replaced the way many applications save a file
+	tmp := link + ".tmp"
+	if err := os.WriteFile(tmp, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &ClobberEvent{ClobberReplaced, dotfile, link}
+	test.AssertEqual(*want, *nextClobberEvent(t, w), t)
+
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+
+	want = &ClobberEvent{ClobberDeleted, dotfile, link}
+	test.AssertEqual(*want, *nextClobberEvent(t, w), t)
+}